@@ -0,0 +1,186 @@
+// Package audit is an append-only log of every change hookcmd makes in
+// Netbox and LibreNMS.  Each change is a line of JSON so the log can be
+// read with standard tools as well as queried with "hookcmd audit query".
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rsapc/hookcmd/config"
+)
+
+// Result values
+const (
+	ResultOK     = "ok"
+	ResultFailed = "failed"
+)
+
+// maxLine is the longest entry read back from the log
+const maxLine = 1024 * 1024
+
+// Entry is one change: a created or deleted object, or one changed field
+type Entry struct {
+	Time time.Time `json:"time"`
+	// RunID correlates the entries made by one run of hookcmd
+	RunID   string `json:"run_id"`
+	Command string `json:"command"`
+	// Event is the webhook event or arguments that triggered the run
+	Event  string `json:"event,omitempty"`
+	Action string `json:"action"`
+	System string `json:"system"`
+	// ObjectType is the Netbox object type (eg. dcim.device), or the
+	// system and model elsewhere (eg. librenms.device, dns.ptr)
+	ObjectType string `json:"object_type"`
+	Model      string `json:"model"`
+	ID         int64  `json:"id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Field      string `json:"field,omitempty"`
+	Old        any    `json:"old,omitempty"`
+	New        any    `json:"new,omitempty"`
+	Result     string `json:"result"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Object returns the object as type:id
+func (e Entry) Object() string {
+	if e.ID == 0 {
+		return e.ObjectType
+	}
+	return fmt.Sprintf("%s:%d", e.ObjectType, e.ID)
+}
+
+// NewRunID returns a new run ID.  IDs sort by the time they were made.
+func NewRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405.000000"), hex.EncodeToString(b))
+}
+
+// Filter selects entries.  Zero fields match every entry.
+type Filter struct {
+	ObjectType string
+	ID         int64
+	RunID      string
+	Since      time.Time
+}
+
+// ParseObject parses an object given as type or type:id (eg.
+// dcim.device:42) into the filter
+func (f *Filter) ParseObject(object string) error {
+	objectType, id, found := strings.Cut(object, ":")
+	if objectType == "" {
+		return fmt.Errorf("invalid object %q: expected type:id, eg. dcim.device:42", object)
+	}
+	f.ObjectType = strings.ToLower(objectType)
+	if !found {
+		return nil
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid object ID in %q: %w", object, err)
+	}
+	f.ID = n
+	return nil
+}
+
+// Match returns true if the entry is selected by the filter
+func (f Filter) Match(e Entry) bool {
+	switch {
+	case f.ObjectType != "" && f.ObjectType != e.ObjectType:
+	case f.ID != 0 && f.ID != e.ID:
+	case f.RunID != "" && f.RunID != e.RunID:
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+	default:
+		return true
+	}
+	return false
+}
+
+type Log struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Open creates the directory of the log if needed and returns the log
+func Open(cfg config.AuditConfig) (*Log, error) {
+	l := &Log{path: cfg.File}
+	if l.path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("could not determine the audit log file: %w", err)
+		}
+		l.path = filepath.Join(home, ".hookcmd", "audit.log")
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o750); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Append adds the entries to the log.  They are written with a single
+// write to a file opened for appending so runs in other processes do not
+// interleave with them.
+func (l *Log) Append(entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if e.Time.IsZero() {
+			e.Time = time.Now().UTC()
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Query returns the entries selected by the filter, oldest first.
+// Lines that cannot be decoded are skipped.
+func (l *Log) Query(f Filter) ([]Entry, error) {
+	file, err := os.Open(l.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLine)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if f.Match(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
@@ -4,9 +4,10 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"log"
+	"fmt"
 	"strconv"
 
+	"github.com/rsapc/hookcmd/service"
 	"github.com/spf13/cobra"
 )
 
@@ -17,31 +18,33 @@ var addLibreDeviceCmd = &cobra.Command{
 	Long: `Adds the IP address given to LibreNMS.  The Netbox model and ID
 	are then used to update the monitoring_id custom field and record 
 	status in the Journal for the device / VM.
+
+	With --probe the address is checked with ICMP, TCP and an SNMP GET
+	using the selected credential profile first, and the result is
+	written to the Journal.  --probe-only runs the checks without adding
+	the device.
 	`,
-	Args: cobra.ExactArgs(3),
+	Annotations: map[string]string{dedupeAnnotation: ""},
+	Args:        cobra.ExactArgs(3),
 	Run: func(cmd *cobra.Command, args []string) {
-		useHTML, _ := cmd.Flags().GetBool("html")
-		if useHTML {
-			startHTML("Adding %s:%s with IP %s to LibreNMS", args[1], args[2], args[0])
-		}
+		svc.Result().SetTitle("Adding %s:%s with IP %s to LibreNMS", args[1], args[2], args[0])
 		modelID, err := strconv.ParseInt(args[2], 0, 64)
 		if err != nil {
-			log.Fatalf("could not parse modelID: %v", err)
+			finish(cmd, usageError(fmt.Errorf("could not parse modelID: %w", err)))
 		}
 
-		if err = svc.AddToLibreNMS(args[0], args[1], modelID); err != nil {
-			if !useHTML {
-				log.Fatal(err)
-			}
-		}
-		if useHTML {
-			endHTML()
-		}
+		probe, _ := cmd.Flags().GetBool("probe")
+		probeOnly, _ := cmd.Flags().GetBool("probe-only")
+		opts := service.AddOptions{Probe: probe, ProbeOnly: probeOnly}
+		err = svc.AddToLibreNMS(args[0], args[1], modelID, opts)
+		finish(cmd, err)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(addLibreDeviceCmd)
 	addLibreDeviceCmd.Flags().BoolP("html", "x", false, "Return response as HTML")
+	addLibreDeviceCmd.Flags().Bool("probe", false, "Check the device answers SNMP before adding it")
+	addLibreDeviceCmd.Flags().Bool("probe-only", false, "Check the device answers SNMP without adding it")
 
 }
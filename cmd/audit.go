@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rsapc/hookcmd/models"
+	"github.com/spf13/cobra"
+)
+
+// auditCmd groups the audit log commands
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Query the log of the changes hookcmd has made",
+	Long: `Every change hookcmd makes in Netbox and LibreNMS is appended to the
+	audit log with the run, the command and event that triggered it, the
+	old and new values and whether it succeeded.  The log settings are in
+	the audit section of the HOOKCMD_CONFIG file.
+	`,
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+}
+
+// triggerEvent describes the event that started the command for the
+// audit log: the event and idempotency key of a webhook, else the
+// arguments
+func triggerEvent(cmd *cobra.Command, args []string) string {
+	if len(args) > 0 {
+		if hook, err := models.ParseWebhook(args[0]); err == nil && hook.Model != "" {
+			return fmt.Sprintf("%s %s", hook.Event, eventKey(cmd, args))
+		}
+	}
+	if key, _ := cmd.Flags().GetString("idempotency-key"); key != "" {
+		return key
+	}
+	return strings.Join(args, " ")
+}
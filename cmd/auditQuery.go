@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rsapc/hookcmd/audit"
+	"github.com/spf13/cobra"
+)
+
+// maxAuditValue is how much of an old or new value is shown
+const maxAuditValue = 40
+
+// auditQueryCmd represents the audit query command
+var auditQueryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "Lists the changes recorded in the audit log",
+	Long: `Lists the recorded changes, oldest first.  Select the object with
+	--object type:id using the Netbox object type (eg. dcim.device:42) or
+	librenms.device for LibreNMS devices.  --since takes a duration (eg.
+	24h) or a time.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var filter audit.Filter
+		if object, _ := cmd.Flags().GetString("object"); object != "" {
+			if err := filter.ParseObject(object); err != nil {
+				finish(cmd, usageError(err))
+			}
+		}
+		if since, _ := cmd.Flags().GetString("since"); since != "" {
+			t, err := parseSince(since)
+			if err != nil {
+				finish(cmd, usageError(err))
+			}
+			filter.Since = t
+		}
+		filter.RunID, _ = cmd.Flags().GetString("run")
+		log, err := svc.AuditLog()
+		if err != nil {
+			finish(cmd, fmt.Errorf("could not open audit log: %w", err))
+		}
+		entries, err := log.Query(filter)
+		if err != nil {
+			finish(cmd, err)
+		}
+		w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tRUN\tCOMMAND\tACTION\tOBJECT\tNAME\tFIELD\tOLD\tNEW\tRESULT")
+		for _, e := range entries {
+			result := e.Result
+			if e.Error != "" {
+				result += ": " + auditValue(e.Error)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format(time.DateTime), e.RunID,
+				e.Command, e.Action, e.Object(), e.Name, e.Field, auditValue(e.Old), auditValue(e.New), result)
+		}
+		w.Flush()
+		svc.Result().Summaryf("%d changes found", len(entries))
+		finish(cmd, nil)
+	},
+}
+
+func init() {
+	auditCmd.AddCommand(auditQueryCmd)
+	auditQueryCmd.Flags().String("object", "", "Only list changes to this object (eg. dcim.device:42)")
+	auditQueryCmd.Flags().String("since", "", "Only list changes since this duration ago (eg. 24h) or time")
+	auditQueryCmd.Flags().String("run", "", "Only list changes made by this run")
+}
+
+// parseSince returns the time given as a duration ago or a time
+func parseSince(since string) (time.Time, error) {
+	if d, err := time.ParseDuration(since); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, since, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: expected a duration (eg. 24h) or a time", since)
+}
+
+// auditValue formats an old or new value for the table
+func auditValue(v any) string {
+	if v == nil {
+		return ""
+	}
+	s := fmt.Sprint(v)
+	if len(s) > maxAuditValue {
+		s = s[:maxAuditValue] + "..."
+	}
+	return s
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// decommissionCmd represents the decommission command
+var decommissionCmd = &cobra.Command{
+	Use:   "decommission {webhook payload}",
+	Short: "Removes a decommissioned Netbox device or VM from LibreNMS",
+	Long: `Receives a Netbox device or virtualmachine webhook.  When the
+	status changes to one of the decommission statuses (decommissioning
+	by default), or the object is deleted, the LibreNMS device is
+	disabled or deleted as set in the librenms.decommission section of
+	the HOOKCMD_CONFIG file.  The
+	monitoring_id is cleared and the change is recorded in the Journal.
+	`,
+	Annotations: map[string]string{dedupeAnnotation: ""},
+	Args:        cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		finish(cmd, svc.Decommission(args[0]))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(decommissionCmd)
+}
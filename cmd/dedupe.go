@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/rsapc/hookcmd/dedupe"
+	"github.com/rsapc/hookcmd/jobs"
+	"github.com/rsapc/hookcmd/models"
+	"github.com/spf13/cobra"
+)
+
+// dedupeAnnotation marks the commands whose events are checked for
+// duplicates before they run
+const dedupeAnnotation = "dedupe"
+
+// the store and key of the event being run, forgotten if it fails
+var (
+	eventStore *dedupe.Store
+	eventID    string
+)
+
+// eventKey returns the idempotency key for the command.  For a Netbox
+// webhook payload this is the request_id with the model and object ID,
+// or a hash of the model, ID and snapshot when there is no request_id.
+// Other commands hash the command and its arguments.
+func eventKey(cmd *cobra.Command, args []string) string {
+	if key, _ := cmd.Flags().GetString("idempotency-key"); key != "" {
+		return key
+	}
+	if len(args) > 0 {
+		if hook, err := models.ParseWebhook(args[0]); err == nil && hook.Model != "" {
+			if hook.RequestID != "" {
+				return fmt.Sprintf("netbox:%s:%s:%d", hook.RequestID, hook.Model, hook.ID())
+			}
+			snapshot, _ := json.Marshal(hook.Post())
+			return fmt.Sprintf("netbox:%s:%d:%s", hook.Model, hook.ID(), hash(string(snapshot)))
+		}
+	}
+	return fmt.Sprintf("%s:%s", cmd.CommandPath(), hash(strings.Join(args, "\x00")))
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkDuplicate exits without running the command if its event has
+// already been seen.  The key is forgotten if the run fails so the event
+// can be retried; use --no-dedupe to run a successful event again.
+func checkDuplicate(cmd *cobra.Command, args []string) {
+	if _, ok := cmd.Annotations[dedupeAnnotation]; !ok {
+		return
+	}
+	if skip, _ := cmd.Flags().GetBool("no-dedupe"); skip {
+		return
+	}
+	store, err := dedupe.Open(svc.Config().Dedupe)
+	if err != nil {
+		log.Printf("could not open dedupe store, running anyway: %v", err)
+		return
+	}
+	store.Prune()
+	key := eventKey(cmd, args)
+	seen, err := store.Seen(key)
+	if err != nil {
+		log.Printf("could not check for duplicate event, running anyway: %v", err)
+		return
+	}
+	if seen {
+		svc.Result().Summaryf("duplicate event %s ignored", key)
+		fmt.Fprintf(stdout, "duplicate event %s ignored\n", key)
+		finish(cmd, nil)
+	}
+	eventStore, eventID = store, key
+}
+
+// forgetEvent removes the key of a failed run so a retry is not ignored
+func forgetEvent() {
+	if eventStore == nil {
+		return
+	}
+	if err := eventStore.Forget(eventID); err != nil {
+		log.Printf("could not forget event %s: %v", eventID, err)
+	}
+}
+
+// forgetJobEvent removes the key of a dead job's event so the event is
+// not ignored if it is sent again
+func forgetJobEvent(job jobs.Job) {
+	if job.DedupeKey == "" {
+		return
+	}
+	store, err := dedupe.Open(svc.Config().Dedupe)
+	if err == nil {
+		err = store.Forget(job.DedupeKey)
+	}
+	if err != nil {
+		log.Printf("could not forget event %s of job %s: %v", job.DedupeKey, job.ID, err)
+	}
+}
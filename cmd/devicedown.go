@@ -10,9 +10,10 @@ var devicedownCmd = &cobra.Command{
 	Short: "Sets the Netbox status to offline when it goes down in LibreNMS",
 	Long: `Receives an alert from LibreNMS and sets the corresponding device 
 	in Netbox to Offline`,
-	Args: cobra.ExactArgs(1),
+	Annotations: map[string]string{dedupeAnnotation: ""},
+	Args:        cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		svc.DeviceDown(args[0])
+		finish(cmd, svc.DeviceDown(args[0]))
 	},
 }
 
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// dnsCmd groups the DNS commands
+var dnsCmd = &cobra.Command{
+	Use:   "dns",
+	Short: "DNS reports for Netbox IP addresses",
+}
+
+func init() {
+	rootCmd.AddCommand(dnsCmd)
+}
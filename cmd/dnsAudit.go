@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// dnsAuditCmd represents the dns audit command
+var dnsAuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Generates a CSV of Netbox addresses with missing or mismatched DNS",
+	Long: `Does a forward-confirmed reverse DNS lookup for every Netbox IP
+	address in --prefix.  Addresses with no PTR record, a PTR that does
+	not resolve back to the address, or a dns_name that does not match
+	are reported.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		prefix, _ := cmd.Flags().GetString("prefix")
+		out, err := reportFile(cmd)
+		if err != nil {
+			finish(cmd, err)
+		}
+		err = svc.AuditDNS(out, prefix)
+		out.Close()
+		finish(cmd, err)
+	},
+}
+
+func init() {
+	dnsCmd.AddCommand(dnsAuditCmd)
+	dnsAuditCmd.Flags().StringP("file", "o", "-", "Output filename")
+	dnsAuditCmd.Flags().String("prefix", "", "Prefix to audit (eg. 10.0.0.0/24)")
+	dnsAuditCmd.MarkFlagRequired("prefix")
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// dnspushCmd represents the dnspush command
+var dnspushCmd = &cobra.Command{
+	Use:   "dnspush {webhook payload}",
+	Short: "Pushes a Netbox IP address dns_name change to DNS",
+	Long: `Receives a Netbox ipaddress webhook and sends RFC 2136 dynamic
+	updates so the A/AAAA and PTR records match the dns_name.  The
+	prechange snapshot is used to remove the old records on a rename,
+	address change or delete.  Zones, servers and TSIG keys are taken
+	from the dns.updates section of the HOOKCMD_CONFIG file.
+	`,
+	Annotations: map[string]string{dedupeAnnotation: ""},
+	Args:        cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		finish(cmd, svc.DNSPush(args[0]))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dnspushCmd)
+}
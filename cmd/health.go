@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// healthCmd represents the health command
+var healthCmd = &cobra.Command{
+	Use:   "health {monitoring_id}",
+	Short: "Summarises the LibreNMS health sensors on the Netbox device",
+	Long: `Reads the health sensors (temperatures, fans, PSU states, optics)
+	and storage usage of the LibreNMS device.  A summary and overall
+	status are written to the health and health_status custom fields and
+	a Journal entry is added when the summary changes.  Optic levels are
+	written to the optic_levels custom field of each interface.
+	`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		deviceID, err := strconv.ParseInt(args[0], 0, 0)
+		if err != nil {
+			finish(cmd, usageError(fmt.Errorf("could not parse device ID: %w", err)))
+		}
+		svc.Result().SetTitle("Syncing health of LibreNMS device %v", deviceID)
+		err = svc.SyncHealth(int(deviceID))
+		finish(cmd, err)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(healthCmd)
+	healthCmd.Flags().BoolP("html", "x", false, "Return response as HTML")
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// inventoryCmd represents the inventory command
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory {monitoring_id}",
+	Short: "Imports the LibreNMS inventory into Netbox inventory items and modules",
+	Long: `Reads the ENTITY-MIB inventory (chassis, modules, power supplies,
+	fans and transceivers) LibreNMS discovered on the device.  Modules are
+	installed where the Netbox module bay and module type exist; the rest
+	become inventory items with their part number and serial.  Items that
+	disappear are marked missing or deleted as set in the inventory
+	section of the HOOKCMD_CONFIG file.
+	`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		deviceID, err := strconv.ParseInt(args[0], 0, 0)
+		if err != nil {
+			finish(cmd, usageError(fmt.Errorf("could not parse device ID: %w", err)))
+		}
+		svc.Result().SetTitle("Importing inventory of LibreNMS device %v", deviceID)
+		err = svc.SyncInventory(int(deviceID))
+		finish(cmd, err)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inventoryCmd)
+	inventoryCmd.Flags().BoolP("html", "x", false, "Return response as HTML")
+}
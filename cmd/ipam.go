@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// ipamCmd groups the IPAM commands
+var ipamCmd = &cobra.Command{
+	Use:   "ipam",
+	Short: "IPAM reports and reconciliation between LibreNMS and Netbox",
+}
+
+func init() {
+	rootCmd.AddCommand(ipamCmd)
+}
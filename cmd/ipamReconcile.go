@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"github.com/rsapc/hookcmd/service"
+	"github.com/spf13/cobra"
+)
+
+// ipamReconcileCmd represents the ipam reconcile command
+var ipamReconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Generates a CSV comparing discovered networks with Netbox prefixes",
+	Long: `Derives the networks in use from the addresses LibreNMS has
+	discovered and compares them with the Netbox prefixes.  The report
+	lists discovered networks missing from Netbox, Netbox prefixes with
+	no live addresses, and the live vs Netbox address count per prefix.
+
+	With --create the missing networks within --parent are added to
+	Netbox as active prefixes and reported as created.  Networks from
+	the global context are added to --vrf when it is given; the others
+	are added to the VRF named after their LibreNMS context.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		out, err := reportFile(cmd)
+		if err != nil {
+			finish(cmd, err)
+		}
+		opts := service.IPAMReconcileOptions{}
+		opts.Create, _ = cmd.Flags().GetBool("create")
+		opts.Parent, _ = cmd.Flags().GetString("parent")
+		opts.VRF, _ = cmd.Flags().GetString("vrf")
+		err = svc.ReconcileIPAM(out, opts)
+		out.Close()
+		finish(cmd, err)
+	},
+}
+
+func init() {
+	ipamCmd.AddCommand(ipamReconcileCmd)
+	ipamReconcileCmd.Flags().StringP("file", "o", "-", "Output filename")
+	ipamReconcileCmd.Flags().Bool("create", false, "Add missing prefixes to Netbox")
+	ipamReconcileCmd.Flags().String("parent", "", "Only create prefixes within this parent prefix")
+	ipamReconcileCmd.Flags().String("vrf", "", "Netbox VRF for created prefixes from the global context")
+}
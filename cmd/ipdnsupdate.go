@@ -1,7 +1,7 @@
 package cmd
 
 import (
-	"log"
+	"errors"
 
 	"github.com/spf13/cobra"
 )
@@ -12,25 +12,30 @@ var ipdnsupdateCmd = &cobra.Command{
 	Short: "Updates the Netbox ipaddress with the DNS name for the IP",
 	Long: `Does a PTR lookup for the given IP address.  When found, the 
 	address is retrieved from Netbox and the dns_name field populated.
+
+	With --prefix every Netbox address in the prefix is updated, running
+	up to --concurrency lookups at a time.  Nameservers are taken from
+	the dns section of the HOOKCMD_CONFIG file.
 	`,
-	Args: cobra.ExactArgs(1),
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := svc.IPdnsUpdate(args[0]); err != nil {
-			log.Fatal(err)
+		prefix, _ := cmd.Flags().GetString("prefix")
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+		var err error
+		switch {
+		case prefix != "" && len(args) == 0:
+			err = svc.IPdnsUpdatePrefix(prefix, concurrency)
+		case prefix == "" && len(args) == 1:
+			err = svc.IPdnsUpdate(args[0])
+		default:
+			finish(cmd, usageError(errors.New("either an ipaddress or --prefix is required")))
 		}
+		finish(cmd, err)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(ipdnsupdateCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// ipdnsupdateCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// ipdnsupdateCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	ipdnsupdateCmd.Flags().String("prefix", "", "Update every Netbox address in the prefix")
+	ipdnsupdateCmd.Flags().Int("concurrency", 8, "Number of lookups to run at a time with --prefix")
 }
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/rsapc/hookcmd/jobs"
+	"github.com/rsapc/hookcmd/results"
+	"github.com/spf13/cobra"
+)
+
+// maxJobOutput is how much of a failed job's output is kept as its error
+const maxJobOutput = 2048
+
+// jobsCmd groups the job queue commands
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "Manage the queue of background webhook jobs",
+	Long: `Commands run with --queue are recorded as jobs and run in the
+	background.  Failed jobs are retried with backoff and marked dead
+	after the maximum attempts.  The queue settings are in the jobs
+	section of the HOOKCMD_CONFIG file.
+	`,
+}
+
+func init() {
+	rootCmd.AddCommand(jobsCmd)
+}
+
+func openQueue(cmd *cobra.Command) *jobs.Queue {
+	q, err := jobs.Open(svc.Config().Jobs)
+	if err != nil {
+		finish(cmd, fmt.Errorf("could not open job queue: %w", err))
+	}
+	return q
+}
+
+// enqueue records the current command line as a job, starts a background
+// worker and exits
+func enqueue(cmd *cobra.Command) {
+	var args []string
+	for _, arg := range os.Args[1:] {
+		if arg != "--queue" && arg != "--queue=true" {
+			args = append(args, arg)
+		}
+	}
+	// the event was checked when it was queued.  Its key is kept until
+	// the job is done or dead.
+	args = append(args, "--no-dedupe")
+	job, err := openQueue(cmd).Add(args, eventID)
+	if err != nil {
+		finish(cmd, fmt.Errorf("could not queue job: %w", err))
+	}
+	if err = startWorker(); err != nil {
+		log.Printf("job %s queued but the worker could not be started: %v", job.ID, err)
+	}
+	svc.Result().Summaryf("accepted job %s", job.ID)
+	fmt.Fprintf(stdout, "accepted job %s\n", job.ID)
+	finish(cmd, nil)
+}
+
+// startWorker runs "jobs run --wait" in the background.  Its output is
+// discarded so the webhook caller is not kept waiting.
+func startWorker() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	worker := exec.Command(exe, "jobs", "run", "--wait")
+	if err = worker.Start(); err != nil {
+		return err
+	}
+	return worker.Process.Release()
+}
+
+// runJob runs the job's command in a new process.  A command that exits
+// because of invalid input or a missing object is a permanent failure.
+func runJob(job jobs.Job) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	out, err := exec.Command(exe, job.Args...).CombinedOutput()
+	if err != nil {
+		output := strings.TrimSpace(string(out))
+		if len(output) > maxJobOutput {
+			output = output[len(output)-maxJobOutput:]
+		}
+		return jobError(err, output)
+	}
+	return nil
+}
+
+// jobError returns the error of a failed job command, marked permanent
+// for the exit codes retrying will not fix
+func jobError(err error, output string) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		switch exitErr.ExitCode() {
+		case results.ExitUsage, results.ExitNotFound:
+			return fmt.Errorf("%w (%v): %s", jobs.ErrPermanent, err, output)
+		}
+	}
+	return fmt.Errorf("%v: %s", err, output)
+}
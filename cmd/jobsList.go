@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// jobsListCmd represents the jobs list command
+var jobsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the queued jobs",
+	Run: func(cmd *cobra.Command, args []string) {
+		statuses, _ := cmd.Flags().GetStringSlice("status")
+		jobList, err := openQueue(cmd).List(statuses...)
+		if err != nil {
+			finish(cmd, err)
+		}
+		w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTATUS\tATTEMPTS\tNEXT ATTEMPT\tCOMMAND\tLAST ERROR")
+		for _, job := range jobList {
+			lastErr := strings.ReplaceAll(job.LastError, "\n", " ")
+			if len(lastErr) > 80 {
+				lastErr = lastErr[:80] + "..."
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d/%d\t%s\t%s\t%s\n", job.ID, job.Status, job.Attempts, job.MaxAttempts,
+				job.NextAttempt.Local().Format(time.DateTime), strings.Join(job.Args, " "), lastErr)
+		}
+		w.Flush()
+		finish(cmd, nil)
+	},
+}
+
+func init() {
+	jobsCmd.AddCommand(jobsListCmd)
+	jobsListCmd.Flags().StringSlice("status", nil, "Only list jobs with these statuses (pending, running, done, dead)")
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rsapc/hookcmd/jobs"
+	"github.com/spf13/cobra"
+)
+
+// jobsPurgeCmd represents the jobs purge command
+var jobsPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Removes finished jobs from the queue",
+	Long: `Removes jobs with the given statuses (done and dead by default)
+	that were last updated before --older-than.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		statuses, _ := cmd.Flags().GetStringSlice("status")
+		olderThan, _ := cmd.Flags().GetDuration("older-than")
+		q := openQueue(cmd)
+		jobList, err := q.List(statuses...)
+		if err != nil {
+			finish(cmd, err)
+		}
+		cutoff := time.Now().Add(-olderThan)
+		purged := 0
+		for _, job := range jobList {
+			if job.Updated.After(cutoff) {
+				continue
+			}
+			if err = q.Delete(job.ID); err != nil {
+				finish(cmd, fmt.Errorf("could not purge %s: %w", job.ID, err))
+			}
+			purged++
+		}
+		svc.Result().Summaryf("purged %d jobs", purged)
+		fmt.Fprintf(stdout, "purged %d jobs\n", purged)
+		finish(cmd, nil)
+	},
+}
+
+func init() {
+	jobsCmd.AddCommand(jobsPurgeCmd)
+	jobsPurgeCmd.Flags().StringSlice("status", []string{jobs.StatusDone, jobs.StatusDead}, "Statuses to purge")
+	jobsPurgeCmd.Flags().Duration("older-than", 0, "Only purge jobs last updated longer ago than this")
+}
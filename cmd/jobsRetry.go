@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/rsapc/hookcmd/jobs"
+	"github.com/spf13/cobra"
+)
+
+// jobsRetryCmd represents the jobs retry command
+var jobsRetryCmd = &cobra.Command{
+	Use:   "retry [job ID...]",
+	Short: "Resets jobs so they run again",
+	Long: `Resets the given jobs (or every dead job with --dead) to pending
+	with no attempts and starts a worker to run them.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		q := openQueue(cmd)
+		dead, _ := cmd.Flags().GetBool("dead")
+		ids := args
+		if dead {
+			deadJobs, err := q.List(jobs.StatusDead)
+			if err != nil {
+				finish(cmd, err)
+			}
+			for _, job := range deadJobs {
+				ids = append(ids, job.ID)
+			}
+		}
+		if len(ids) == 0 {
+			finish(cmd, usageError(errors.New("no jobs given to retry")))
+		}
+		for _, id := range ids {
+			if _, err := q.Retry(id); err != nil {
+				finish(cmd, fmt.Errorf("could not retry %s: %w", id, err))
+			}
+			svc.Result().Summaryf("retrying %s", id)
+			fmt.Fprintf(stdout, "retrying %s\n", id)
+		}
+		if err := startWorker(); err != nil {
+			log.Printf("could not start worker: %v", err)
+		}
+		finish(cmd, nil)
+	},
+}
+
+func init() {
+	jobsCmd.AddCommand(jobsRetryCmd)
+	jobsRetryCmd.Flags().Bool("dead", false, "Retry all dead jobs")
+}
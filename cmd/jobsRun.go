@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// jobsRunCmd represents the jobs run command
+var jobsRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Runs the jobs that are due",
+	Long: `Runs each pending job that is due.  With --wait the worker keeps
+	running until no pending jobs remain, sleeping until retries are due.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		wait, _ := cmd.Flags().GetBool("wait")
+		q := openQueue(cmd)
+		q.OnDead(forgetJobEvent)
+		for {
+			next, err := q.Run(runJob)
+			if err != nil {
+				finish(cmd, err)
+			}
+			if !wait || next.IsZero() {
+				finish(cmd, nil)
+			}
+			time.Sleep(time.Until(next))
+		}
+	},
+}
+
+func init() {
+	jobsCmd.AddCommand(jobsRunCmd)
+	jobsRunCmd.Flags().Bool("wait", false, "Keep running until no pending jobs remain")
+}
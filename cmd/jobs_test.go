@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/rsapc/hookcmd/jobs"
+)
+
+func TestJobErrorPermanent(t *testing.T) {
+	tests := []struct {
+		code      int
+		permanent bool
+	}{
+		{1, false},
+		{2, true},
+		{3, true},
+		{4, false},
+		{6, false},
+	}
+	for _, tt := range tests {
+		err := exec.Command("sh", "-c", fmt.Sprintf("exit %d", tt.code)).Run()
+		if err == nil {
+			t.Fatalf("exit %d did not fail", tt.code)
+		}
+		if permanent := errors.Is(jobError(err, "output"), jobs.ErrPermanent); permanent != tt.permanent {
+			t.Errorf("exit %d: permanent=%t, want %t", tt.code, permanent, tt.permanent)
+		}
+	}
+}
@@ -4,10 +4,6 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"io"
-	"log"
-	"os"
-
 	"github.com/spf13/cobra"
 )
 
@@ -21,24 +17,17 @@ var libreMissingReportCmd = &cobra.Command{
 	set as the monitoring_id in Netbox
 	`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fname, err := cmd.Flags().GetString("output")
+		out, err := reportFile(cmd)
 		if err != nil {
-			fname = "-"
-		}
-		var out io.Writer
-		if fname == "-" {
-			out = os.Stdout
-		} else {
-			out, err = os.Create(fname)
-			if err != nil {
-				log.Fatalf("error opening %s: %v", fname, err)
-			}
+			finish(cmd, err)
 		}
-		svc.MissingFromLibre(out)
+		err = svc.MissingFromLibre(out)
+		out.Close()
+		finish(cmd, err)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(libreMissingReportCmd)
-	libreMissingReportCmd.Flags().StringP("output", "o", "-", "Output filename")
+	libreMissingReportCmd.Flags().StringP("file", "o", "-", "Output filename")
 }
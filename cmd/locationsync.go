@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// locationsyncCmd represents the locationsync command
+var locationsyncCmd = &cobra.Command{
+	Use:   "locationsync",
+	Short: "Creates LibreNMS locations from the Netbox sites and assigns devices",
+	Long: `Creates a LibreNMS location for each Netbox site with the site's
+	latitude and longitude, and updates the coordinates of existing
+	locations when they change in Netbox.  Sites without coordinates are
+	skipped.
+
+	Each monitored Netbox device is then assigned to the location of its
+	site (or "Site / Location" when the locations hierarchy option is set)
+	and the change is journalled on the device.
+	`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		finish(cmd, svc.SyncLocations())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(locationsyncCmd)
+}
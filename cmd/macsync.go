@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// macsyncCmd represents the macsync command
+var macsyncCmd = &cobra.Command{
+	Use:   "macsync {monitoring_id}",
+	Short: "Records where MAC addresses were last seen on a switch in Netbox",
+	Long: `Reads the forwarding table of the LibreNMS device and the ARP
+	tables of all devices.  Each MAC address learned on an access port is
+	recorded on the Netbox MAC address object with the switch:port, IP
+	address and first/last seen times.  Trunk ports and ports with more
+	than --max-macs addresses are skipped.
+	`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		deviceID, err := strconv.ParseInt(args[0], 0, 0)
+		if err != nil {
+			finish(cmd, usageError(fmt.Errorf("could not parse device ID: %w", err)))
+		}
+		maxMACs, _ := cmd.Flags().GetInt("max-macs")
+		svc.Result().SetTitle("Recording MAC addresses from LibreNMS device %v", deviceID)
+		err = svc.SyncMACLocations(int(deviceID), maxMACs)
+		finish(cmd, err)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(macsyncCmd)
+	macsyncCmd.Flags().BoolP("html", "x", false, "Return response as HTML")
+	macsyncCmd.Flags().Int("max-macs", 4, "Skip ports with more MAC addresses than this")
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// monitoringCmd represents the monitoring command
+var monitoringCmd = &cobra.Command{
+	Use:   "monitoring {webhook payload}",
+	Short: "Mutes, ignores or disables the LibreNMS device from Netbox tags",
+	Long: `Receives a Netbox device or virtualmachine webhook.  The tags and
+	the monitoring custom field (muted, ignore or disabled) set the
+	LibreNMS disable_notify, ignore and disabled flags of the device.  The
+	flags in effect are written to the monitoring_state custom field.
+	`,
+	Annotations: map[string]string{dedupeAnnotation: ""},
+	Args:        cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		finish(cmd, svc.ApplyMonitoringState(args[0]))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(monitoringCmd)
+}
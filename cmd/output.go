@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/hookcmd/results"
+	"github.com/spf13/cobra"
+)
+
+// output formats selected with --output
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+var (
+	outputFormat = outputText
+	// stdout receives what a command prints.  With --output json it is
+	// captured and returned in the envelope.
+	stdout   io.Writer = os.Stdout
+	captured bytes.Buffer
+)
+
+// setOutput selects the output format from the --output flag.  Reports
+// took their file name from --output before it selected the format, so
+// on a report any other value is the file name.
+func setOutput(cmd *cobra.Command) error {
+	format, _ := cmd.Flags().GetString("output")
+	switch format {
+	case outputText:
+	case outputJSON:
+		stdout = &captured
+	default:
+		if file := cmd.Flags().Lookup("file"); file != nil && !file.Changed && format != "" {
+			if err := cmd.Flags().Set("file", format); err != nil {
+				return err
+			}
+			format = outputText
+			break
+		}
+		return fmt.Errorf("invalid output format %q: must be text or json", format)
+	}
+	outputFormat = format
+	return nil
+}
+
+// commandName returns the command path without the program name
+func commandName(cmd *cobra.Command) string {
+	return strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+}
+
+// usageError marks err as a problem with the arguments or flags
+func usageError(err error) error {
+	return models.WithKind(err, models.ErrValidation)
+}
+
+// finish reports the outcome of the command and exits.  err is written to
+// the JSON envelope or HTML page, or logged, and its kind sets the exit
+// code.
+func finish(cmd *cobra.Command, err error) {
+	if err != nil {
+		forgetEvent()
+	}
+	result := svc.Result()
+	result.AddError(err)
+	useHTML, _ := cmd.Flags().GetBool("html")
+	switch {
+	case outputFormat == outputJSON:
+		envelope := result.Envelope(commandName(cmd), err, captured.String())
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if encErr := enc.Encode(envelope); encErr != nil {
+			log.Print(encErr)
+		}
+	case useHTML:
+		if htmlErr := result.WriteHTML(os.Stdout); htmlErr != nil {
+			log.Print(htmlErr)
+		}
+	case err != nil:
+		log.Print(err)
+	}
+	os.Exit(results.ExitCode(err))
+}
+
+// reportFile opens the --file of a report command, or stdout for -
+func reportFile(cmd *cobra.Command) (io.WriteCloser, error) {
+	fname, _ := cmd.Flags().GetString("file")
+	if fname == "" || fname == "-" {
+		return nopCloser{stdout}, nil
+	}
+	f, err := os.Create(fname)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", fname, err)
+	}
+	return f, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
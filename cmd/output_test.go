@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// newReportCmd returns a command with the global --output flag and a
+// report's --file flag
+func newReportCmd(t *testing.T, args ...string) *cobra.Command {
+	t.Helper()
+	root := &cobra.Command{Use: "hookcmd"}
+	root.PersistentFlags().String("output", outputText, "")
+	report := &cobra.Command{Use: "report"}
+	report.Flags().StringP("file", "o", "-", "")
+	root.AddCommand(report)
+	if err := report.ParseFlags(args); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { outputFormat, stdout = outputText, os.Stdout })
+	return report
+}
+
+func TestSetOutputReportFile(t *testing.T) {
+	tests := []struct {
+		args   []string
+		format string
+		file   string
+	}{
+		{[]string{"--output", "report.csv"}, outputText, "report.csv"},
+		{[]string{"-o", "report.csv"}, outputText, "report.csv"},
+		{[]string{"--file", "report.csv", "--output", "json"}, outputJSON, "report.csv"},
+		{[]string{"--output", "json"}, outputJSON, "-"},
+		{nil, outputText, "-"},
+	}
+	for _, tt := range tests {
+		cmd := newReportCmd(t, tt.args...)
+		if err := setOutput(cmd); err != nil {
+			t.Fatalf("%v: %v", tt.args, err)
+		}
+		file, _ := cmd.Flags().GetString("file")
+		if outputFormat != tt.format || file != tt.file {
+			t.Errorf("%v: got format %s file %s, want %s %s", tt.args, outputFormat, file, tt.format, tt.file)
+		}
+	}
+}
+
+func TestSetOutputInvalid(t *testing.T) {
+	cmd := newReportCmd(t, "--file", "report.csv", "--output", "report2.csv")
+	if err := setOutput(cmd); err == nil {
+		t.Error("expected an error when --file is also given")
+	}
+	root := &cobra.Command{Use: "hookcmd"}
+	root.PersistentFlags().String("output", outputText, "")
+	root.ParseFlags([]string{"--output", "yaml"})
+	if err := setOutput(root); err == nil {
+		t.Error("expected an error for a command without --file")
+	}
+}
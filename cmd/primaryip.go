@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// primaryipCmd represents the primaryip command
+var primaryipCmd = &cobra.Command{
+	Use:   "primaryip {webhook payload}",
+	Short: "Points LibreNMS at the new primary IP of a Netbox device or VM",
+	Long: `Receives a Netbox device or virtualmachine webhook.  When the
+	primary IP changes the device is probed at the new address and the
+	LibreNMS hostname (or overwrite_ip when the hostname is a DNS name)
+	is updated.  The outcome is recorded in the Netbox Journal and the
+	LibreNMS device notes.
+	`,
+	Annotations: map[string]string{dedupeAnnotation: ""},
+	Args:        cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		finish(cmd, svc.PrimaryIPChange(args[0]))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(primaryipCmd)
+}
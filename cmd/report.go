@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// reportCmd groups the reports
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Reports comparing LibreNMS with Netbox and policy",
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"github.com/rsapc/hookcmd/service"
+	"github.com/spf13/cobra"
+)
+
+// reportFirmwareCmd represents the report firmware command
+var reportFirmwareCmd = &cobra.Command{
+	Use:   "firmware",
+	Short: "Generates a CSV of software versions and devices out of policy",
+	Long: `Groups the LibreNMS devices by platform and version and lists
+	the devices whose version is not approved by the firmware policy for
+	their Netbox platform and role.
+
+	With --update the running version is written to the software_version
+	custom field in Netbox and devices out of policy are tagged.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		out, err := reportFile(cmd)
+		if err != nil {
+			finish(cmd, err)
+		}
+		opts := service.FirmwareReportOptions{}
+		opts.Update, _ = cmd.Flags().GetBool("update")
+		err = svc.FirmwareReport(out, opts)
+		out.Close()
+		finish(cmd, err)
+	},
+}
+
+func init() {
+	reportCmd.AddCommand(reportFirmwareCmd)
+	reportFirmwareCmd.Flags().StringP("file", "o", "-", "Output filename")
+	reportFirmwareCmd.Flags().Bool("update", false, "Write the version to Netbox and tag devices out of policy")
+}
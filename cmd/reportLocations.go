@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// reportLocationsCmd represents the report locations command
+var reportLocationsCmd = &cobra.Command{
+	Use:   "locations",
+	Short: "Generates a CSV of devices whose LibreNMS location does not match Netbox",
+	Long: `Lists the monitored Netbox devices whose location in LibreNMS
+	differs from their Netbox site (or "Site / Location" when the
+	locations hierarchy option is set).  Names are compared ignoring case.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		out, err := reportFile(cmd)
+		if err != nil {
+			finish(cmd, err)
+		}
+		err = svc.LocationReport(out)
+		out.Close()
+		finish(cmd, err)
+	},
+}
+
+func init() {
+	reportCmd.AddCommand(reportLocationsCmd)
+	reportLocationsCmd.Flags().StringP("file", "o", "-", "Output filename")
+}
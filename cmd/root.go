@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"fmt"
 	"os"
 
 	"github.com/rsapc/hookcmd/service"
@@ -16,6 +15,16 @@ var rootCmd = &cobra.Command{
 	Short: "Various webhooks for interfacing with Netbox and LibreNMS",
 	Long: `This program is designed to be called from a webhook service.
 	It has been specifically designed to work with https://github.com/adnanh/webhook.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := setOutput(cmd); err != nil {
+			finish(cmd, usageError(err))
+		}
+		checkDuplicate(cmd, args)
+		svc.SetTrigger(commandName(cmd), triggerEvent(cmd, args))
+		if queue, _ := cmd.Flags().GetBool("queue"); queue && cmd.Parent() != jobsCmd {
+			enqueue(cmd)
+		}
+	},
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
@@ -24,9 +33,11 @@ var rootCmd = &cobra.Command{
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := rootCmd.Execute()
+	cmd, err := rootCmd.ExecuteC()
 	if err != nil {
-		os.Exit(1)
+		// invalid arguments or flags
+		setOutput(cmd)
+		finish(cmd, usageError(err))
 	}
 }
 
@@ -36,27 +47,10 @@ func init() {
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.webhooks.yaml)")
+	rootCmd.PersistentFlags().Bool("queue", false, "Queue the command to run in the background with retries")
+	rootCmd.PersistentFlags().String("idempotency-key", "", "Key identifying the event (defaults to the webhook request_id)")
+	rootCmd.PersistentFlags().Bool("no-dedupe", false, "Run even if the event has already been seen")
+	rootCmd.PersistentFlags().String("output", outputText, "Output format: text or json")
 
 	svc = service.NewService(os.Getenv, nil)
 }
-
-func startHTML(title string, args ...any) {
-	htmlTitle := fmt.Sprintf(title, args...)
-	fmt.Printf(`<html>
-	<body>
-		<h1>%s</h1>
-		<pre>
-	`, htmlTitle)
-}
-
-func endHTML() {
-	fmt.Print(`
-	</pre><br/><br/>
-	<p>
-	<button onclick="history.back()">Go Back</button>
-	</p>
-</body>
-</html>
-`)
-
-}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// syncipsCmd represents the syncips command
+var syncipsCmd = &cobra.Command{
+	Use:   "syncips {monitoring_id}",
+	Short: "Syncs the IP addresses of a LibreNMS device into Netbox",
+	Long: `Looks up the IP addresses LibreNMS has discovered on the device
+	and creates or updates the matching Netbox IP addresses, assigning
+	them to the interface with the same name.  The LibreNMS context is
+	used as the Netbox VRF.  Primary IPs are set if they are not already.
+	`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		deviceID, err := strconv.ParseInt(args[0], 0, 0)
+		if err != nil {
+			finish(cmd, usageError(fmt.Errorf("could not parse device ID: %w", err)))
+		}
+		svc.Result().SetTitle("Syncing IP addresses from LibreNMS device %v", deviceID)
+		err = svc.SyncIPAddresses(int(deviceID))
+		finish(cmd, err)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(syncipsCmd)
+	syncipsCmd.Flags().BoolP("html", "x", false, "Return response as HTML")
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/rsapc/hookcmd/service"
+	"github.com/spf13/cobra"
+)
+
+// undoCmd represents the undo command
+var undoCmd = &cobra.Command{
+	Use:   "undo [run ID]",
+	Short: "Undoes the changes made by a run",
+	Long: `Restores the fields changed by the run (its run_id in the audit log
+	or JSON output) to their values before it and deletes the Netbox objects
+	it created.  A field that has changed since the run is a conflict and is
+	left alone unless --force is given.  Deleted objects cannot be restored.
+	Use --dry-run to see what would be changed.
+	`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		force, _ := cmd.Flags().GetBool("force")
+		svc.Result().SetTitle("Undoing run %s", args[0])
+		steps, err := svc.Undo(args[0], dryRun, force)
+		if len(steps) == 0 {
+			finish(cmd, err)
+		}
+		w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ACTION\tOBJECT\tNAME\tFIELD\tCURRENT\tRESTORE\tSTATUS")
+		counts := make(map[string]int)
+		for _, step := range steps {
+			status := step.Status
+			if step.Reason != "" {
+				status += ": " + step.Reason
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", step.Action, step.Object(), step.Name, step.Field,
+				auditValue(step.Current), auditValue(step.Restore), status)
+			counts[step.Status]++
+		}
+		w.Flush()
+		for _, status := range []string{service.UndoPlanned, service.UndoDone, service.UndoConflict, service.UndoSkipped, service.UndoFailed} {
+			if counts[status] > 0 {
+				svc.Result().Summaryf("%d %s", counts[status], status)
+			}
+		}
+		finish(cmd, err)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+	undoCmd.Flags().BoolP("dry-run", "n", false, "Show what would be undone without changing anything")
+	undoCmd.Flags().Bool("force", false, "Restore fields that have changed since the run")
+}
@@ -4,7 +4,7 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"log"
+	"fmt"
 	"strconv"
 
 	"github.com/spf13/cobra"
@@ -21,20 +21,15 @@ var updatePortsCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		nbID, err := strconv.ParseInt(args[1], 0, 0)
 		if err != nil {
-			log.Fatalf("could not parse netbox device ID: %v", err)
+			finish(cmd, usageError(fmt.Errorf("could not parse netbox device ID: %w", err)))
 		}
 		libreID, err := strconv.ParseInt(args[2], 0, 0)
 		if err != nil {
-			log.Fatalf("could not parse monitoring ID: %v", err)
-		}
-		useHTML, _ := cmd.Flags().GetBool("html")
-		if useHTML {
-			startHTML("Updating from LibreNMS device %v", nbID)
-		}
-		svc.UpdatePortDescriptions(args[0], int(nbID), int(libreID))
-		if useHTML {
-			endHTML()
+			finish(cmd, usageError(fmt.Errorf("could not parse monitoring ID: %w", err)))
 		}
+		svc.Result().SetTitle("Updating from LibreNMS device %v", nbID)
+		err = svc.UpdatePortDescriptions(args[0], int(nbID), int(libreID))
+		finish(cmd, err)
 	},
 }
 
@@ -17,14 +17,9 @@ var updatebyipCmd = &cobra.Command{
 	`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		useHTML, _ := cmd.Flags().GetBool("html")
-		if useHTML {
-			startHTML("Updating from LibreNMS IP %s", args[0])
-		}
-		svc.FindDevice(args[0])
-		if useHTML {
-			endHTML()
-		}
+		svc.Result().SetTitle("Updating from LibreNMS IP %s", args[0])
+		err := svc.FindDevice(args[0])
+		finish(cmd, err)
 	},
 }
 
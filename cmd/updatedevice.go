@@ -4,7 +4,7 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"log"
+	"fmt"
 	"strconv"
 
 	"github.com/spf13/cobra"
@@ -22,16 +22,11 @@ var updatedeviceCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		deviceID, err := strconv.ParseInt(args[0], 0, 0)
 		if err != nil {
-			log.Fatalf("could not parse device ID: %v", err)
-		}
-		useHTML, _ := cmd.Flags().GetBool("html")
-		if useHTML {
-			startHTML("Updating from LibreNMS device %v", deviceID)
-		}
-		svc.GetDeviceInfo(int(deviceID))
-		if useHTML {
-			endHTML()
+			finish(cmd, usageError(fmt.Errorf("could not parse device ID: %w", err)))
 		}
+		svc.Result().SetTitle("Updating from LibreNMS device %v", deviceID)
+		err = svc.GetDeviceInfo(int(deviceID))
+		finish(cmd, err)
 	},
 }
 
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// vmsyncCmd represents the vmsync command
+var vmsyncCmd = &cobra.Command{
+	Use:   "vmsync {monitoring_id}",
+	Short: "Places the VMs found on a hypervisor on its Netbox host and cluster",
+	Long: `Reads the virtual machines LibreNMS discovered on the hypervisor
+	and sets the host device and cluster of the matching Netbox VMs (by
+	name) to the hypervisor's.  VMs that are not monitored themselves also
+	get their vCPUs and memory from the hypervisor.
+	`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		deviceID, err := strconv.ParseInt(args[0], 0, 0)
+		if err != nil {
+			finish(cmd, usageError(fmt.Errorf("could not parse device ID: %w", err)))
+		}
+		svc.Result().SetTitle("Syncing virtual machines from LibreNMS hypervisor %v", deviceID)
+		err = svc.SyncHypervisorVMs(int(deviceID))
+		finish(cmd, err)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(vmsyncCmd)
+	vmsyncCmd.Flags().BoolP("html", "x", false, "Return response as HTML")
+}
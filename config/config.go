@@ -0,0 +1,309 @@
+// Package config loads the optional hookcmd configuration file.  The
+// file is JSON and its location is given by the HOOKCMD_CONFIG
+// environment variable.  Connection settings for Netbox and LibreNMS
+// remain in the environment.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+type Config struct {
+	DNS       DNSConfig       `json:"dns"`
+	Jobs      JobsConfig      `json:"jobs"`
+	Dedupe    DedupeConfig    `json:"dedupe"`
+	LibreNMS  LibreNMSConfig  `json:"librenms"`
+	Inventory InventoryConfig `json:"inventory"`
+	Firmware  FirmwareConfig  `json:"firmware"`
+	Locations LocationsConfig `json:"locations"`
+	Notify    NotifyConfig    `json:"notify"`
+	Audit     AuditConfig     `json:"audit"`
+}
+
+// NotifyConfig lists where hook results are sent in addition to the
+// Netbox journal
+type NotifyConfig struct {
+	Sinks []SinkConfig `json:"sinks"`
+}
+
+// SinkConfig is a notification destination
+type SinkConfig struct {
+	// Type is webhook, smtp, slack, teams, mattermost or syslog
+	Type string `json:"type"`
+	// Events sent to the sink: device_added, device_offline, sync_failed
+	// and unmapped_interface.  Defaults to all events
+	Events []string `json:"events"`
+	// URL of the webhook or incoming chat webhook
+	URL string `json:"url"`
+	// Headers are added to webhook requests (eg. Authorization)
+	Headers map[string]string `json:"headers"`
+	// Server is the SMTP server as host:port, or the syslog server as
+	// host:port (the local syslog when empty)
+	Server   string   `json:"server"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	// Network for a remote syslog server.  Defaults to udp
+	Network string `json:"network"`
+	// Timeout for each notification.  Defaults to 10s
+	Timeout Duration `json:"timeout"`
+}
+
+// LocationsConfig controls how Netbox sites map to LibreNMS locations
+type LocationsConfig struct {
+	// Hierarchy names the LibreNMS location of a device with a Netbox
+	// location "Site / Location" instead of just the site name
+	Hierarchy bool `json:"hierarchy"`
+}
+
+// FirmwareConfig is the target software version policy used by the
+// firmware report
+type FirmwareConfig struct {
+	// Policies are matched in order by platform and role
+	Policies []FirmwarePolicy `json:"policies"`
+	// Tag is the slug of the Netbox tag applied to devices that are out
+	// of policy.  Defaults to firmware-noncompliant
+	Tag string `json:"tag"`
+}
+
+// FirmwarePolicy lists the approved versions for a platform and role
+type FirmwarePolicy struct {
+	// Platform is the Netbox platform slug, or the LibreNMS OS for
+	// devices without a platform
+	Platform string `json:"platform"`
+	// Role is the Netbox role slug.  Empty matches every role
+	Role string `json:"role"`
+	// Versions are the approved versions.  A trailing * matches any
+	// version starting with the rest.
+	Versions []string `json:"versions"`
+}
+
+// InventoryConfig controls the import of the LibreNMS inventory into
+// Netbox inventory items and modules
+type InventoryConfig struct {
+	// Missing is what happens to items no longer found by LibreNMS: mark
+	// (the default) sets inventory_missing on items and takes modules
+	// offline, delete removes them
+	Missing string `json:"missing"`
+}
+
+// LibreNMSConfig holds the options used when adding devices to LibreNMS
+type LibreNMSConfig struct {
+	// ProfileContextKey is the Netbox config context key naming the
+	// profile to use.  Defaults to librenms_profile
+	ProfileContextKey string `json:"profile_context_key"`
+	// Profiles are matched in order against the Netbox object.  A
+	// profile named "default" is used when none match.
+	Profiles []DeviceProfile `json:"profiles"`
+	// Preflight configures the reachability checks made before a device
+	// is added
+	Preflight PreflightConfig `json:"preflight"`
+	// Decommission is the policy applied when a Netbox device or VM is
+	// decommissioned or deleted
+	Decommission DecommissionConfig `json:"decommission"`
+	// Suppression maps Netbox tags and custom fields to the LibreNMS
+	// alerting and polling flags
+	Suppression SuppressionConfig `json:"suppression"`
+}
+
+// SuppressionConfig maps Netbox tags and a custom field to the monitoring
+// modes muted (disable_notify), ignore and disabled
+type SuppressionConfig struct {
+	// Field is the Netbox custom field holding the mode.  Defaults to
+	// monitoring
+	Field string `json:"field"`
+	// Tags maps Netbox tag slugs to a mode.  Defaults to muted, ignore
+	// and disabled mapping to themselves
+	Tags map[string]string `json:"tags"`
+}
+
+// DecommissionConfig controls what happens to the LibreNMS device when
+// the Netbox object goes away.  Actions are disable, delete or none.
+type DecommissionConfig struct {
+	// Statuses that decommission the device.  Defaults to
+	// decommissioning
+	Statuses []string `json:"statuses"`
+	// OnStatus is the action when the status changes to one of Statuses.
+	// Defaults to disable
+	OnStatus string `json:"on_status"`
+	// OnDelete is the action when the object is deleted.  Defaults to
+	// delete
+	OnDelete string `json:"on_delete"`
+	// IgnoreUsers are Netbox users whose changes are ignored, such as the
+	// user hookcmd itself uses to mark devices offline
+	IgnoreUsers []string `json:"ignore_users"`
+}
+
+// PreflightConfig configures the probes made before adding a device
+type PreflightConfig struct {
+	// Enabled runs the probes on every add, not just with --probe
+	Enabled bool `json:"enabled"`
+	// TCPPorts are connected to as a reachability check when ICMP is not
+	// permitted or not answered.  Defaults to 22 and 443
+	TCPPorts []int `json:"tcp_ports"`
+	// Timeout for each probe.  Defaults to 3s
+	Timeout Duration `json:"timeout"`
+}
+
+// DeviceProfile holds the SNMP credentials and add options for a class
+// of devices
+type DeviceProfile struct {
+	Name  string       `json:"name"`
+	Match ProfileMatch `json:"match"`
+	// SNMPVersion is v1, v2c or v3
+	SNMPVersion string `json:"snmp_version"`
+	Community   string `json:"community"`
+	// AuthLevel is noAuthNoPriv, authNoPriv or authPriv
+	AuthLevel  string `json:"auth_level"`
+	AuthName   string `json:"auth_name"`
+	AuthPass   string `json:"auth_pass"`
+	AuthAlgo   string `json:"auth_algo"`
+	CryptoPass string `json:"crypto_pass"`
+	CryptoAlgo string `json:"crypto_algo"`
+	Port       int    `json:"port"`
+	// Transport is udp, tcp, udp6 or tcp6
+	Transport   string `json:"transport"`
+	PollerGroup int    `json:"poller_group"`
+	ForceAdd    bool   `json:"force_add"`
+	// Display is the LibreNMS display name.  {name} is replaced with
+	// the Netbox name.
+	Display string `json:"display"`
+	// SNMPDisable adds the device as ping only
+	SNMPDisable bool `json:"snmp_disable"`
+	// Os is the LibreNMS OS of a ping only device.  Defaults to ping
+	Os string `json:"os"`
+}
+
+// ProfileMatch selects the Netbox objects a profile applies to by slug.
+// Every non-empty list must contain a matching value.
+type ProfileMatch struct {
+	Sites     []string `json:"sites"`
+	Roles     []string `json:"roles"`
+	Platforms []string `json:"platforms"`
+	Tags      []string `json:"tags"`
+}
+
+// DedupeConfig configures how long webhook events are remembered so
+// duplicates can be ignored
+type DedupeConfig struct {
+	// Dir holds the recently seen event keys.  Defaults to ~/.hookcmd/seen
+	Dir string `json:"dir"`
+	// TTL is how long an event is remembered.  Defaults to 5m
+	TTL Duration `json:"ttl"`
+}
+
+// JobsConfig configures the queue used to run webhook commands in the
+// background
+type JobsConfig struct {
+	// Dir holds the queued jobs.  Defaults to ~/.hookcmd/jobs
+	Dir string `json:"dir"`
+	// MaxAttempts before a job is dead-lettered.  Defaults to 5
+	MaxAttempts int `json:"max_attempts"`
+	// Backoff is the delay before the first retry.  It doubles with
+	// each attempt up to an hour.  Defaults to 30s
+	Backoff Duration `json:"backoff"`
+}
+
+// AuditConfig configures the log of the changes hookcmd makes
+type AuditConfig struct {
+	// File the changes are appended to.  Defaults to ~/.hookcmd/audit.log
+	File string `json:"file"`
+	// Disabled turns off the audit log
+	Disabled bool `json:"disabled"`
+}
+
+// DNSConfig selects the resolvers used for DNS lookups
+type DNSConfig struct {
+	// Default is used when no resolver in Resolvers matches.  With no
+	// servers the system resolver is used.
+	Default ResolverConfig `json:"default"`
+	// Resolvers are matched in order by VRF and zone
+	Resolvers []ResolverConfig `json:"resolvers"`
+	// Updates configures pushing Netbox dns_name changes to DNS
+	Updates DNSUpdateConfig `json:"updates"`
+}
+
+// DNSUpdateConfig configures the RFC 2136 dynamic updates sent when
+// the dns_name of a Netbox address changes
+type DNSUpdateConfig struct {
+	// TTL of added records.  Defaults to 3600
+	TTL uint32 `json:"ttl"`
+	// Zones the updates can be sent to.  The zone with the longest
+	// matching name is used for each record.
+	Zones []UpdateZoneConfig `json:"zones"`
+}
+
+// UpdateZoneConfig is an authoritative zone that accepts updates
+type UpdateZoneConfig struct {
+	// Zone is the zone name (eg. example.com or 10.in-addr.arpa)
+	Zone string `json:"zone"`
+	// Server is the primary nameserver as host or host:port
+	Server string `json:"server"`
+	// KeyName is the TSIG key name.  Updates are unsigned when empty.
+	KeyName string `json:"key_name"`
+	// KeySecret is the base64 encoded TSIG secret
+	KeySecret string `json:"key_secret"`
+	// KeyAlgorithm is hmac-sha256 (default), hmac-sha512 or hmac-sha1
+	KeyAlgorithm string `json:"key_algorithm"`
+}
+
+// ResolverConfig describes a set of nameservers
+type ResolverConfig struct {
+	// VRF limits the resolver to addresses in this Netbox VRF
+	VRF string `json:"vrf"`
+	// Zone limits the resolver to names within this zone (eg.
+	// 10.in-addr.arpa or example.com)
+	Zone string `json:"zone"`
+	// Servers are the nameservers as host or host:port
+	Servers []string `json:"servers"`
+	// Timeout for each lookup.  Defaults to 5s
+	Timeout Duration `json:"timeout"`
+	// TLS uses DNS over TLS (port 853 unless given)
+	TLS bool `json:"tls"`
+	// TLSServerName is used to verify the server certificate.  Defaults
+	// to the server host
+	TLSServerName string `json:"tls_server_name"`
+}
+
+// Duration is a time.Duration that is given as a string (eg. 2s) in JSON
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %s: %w", s, err)
+	}
+	d.Duration = duration
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Load reads the config file at path.  An empty path returns an empty
+// config.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err = json.Unmarshal(data, cfg); err != nil {
+		return cfg, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
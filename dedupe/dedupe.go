@@ -0,0 +1,100 @@
+// Package dedupe remembers recently seen event keys so a webhook that
+// Netbox fires more than once only runs its side effects once.
+package dedupe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rsapc/hookcmd/config"
+)
+
+const defaultTTL = 5 * time.Minute
+
+type Store struct {
+	dir string
+	ttl time.Duration
+}
+
+// Open creates the store directory if needed and returns the store
+func Open(cfg config.DedupeConfig) (*Store, error) {
+	s := &Store{dir: cfg.Dir, ttl: cfg.TTL.Duration}
+	if s.dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("could not determine the dedupe directory: %w", err)
+		}
+		s.dir = filepath.Join(home, ".hookcmd", "seen")
+	}
+	if s.ttl <= 0 {
+		s.ttl = defaultTTL
+	}
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+// Seen records the key and returns true if it had already been recorded
+// within the TTL.  Recording is atomic so only one of several concurrent
+// callers with the same key gets false.
+func (s *Store) Seen(key string) (bool, error) {
+	path := s.path(key)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err == nil {
+		fmt.Fprintln(f, key)
+		return false, f.Close()
+	}
+	if !errors.Is(err, os.ErrExist) {
+		return false, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if time.Since(info.ModTime()) < s.ttl {
+		return true, nil
+	}
+	// the previous event has expired
+	if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	return s.Seen(key)
+}
+
+// Forget removes the key so the event can run again
+func (s *Store) Forget(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Prune removes the keys older than the TTL
+func (s *Store) Prune() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) >= s.ttl {
+			os.Remove(filepath.Join(s.dir, entry.Name()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package dedupe
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rsapc/hookcmd/config"
+)
+
+func TestSeen(t *testing.T) {
+	s, err := Open(config.DedupeConfig{Dir: t.TempDir(), TTL: config.Duration{Duration: time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{false, true, true} {
+		seen, err := s.Seen("netbox:req:device:42")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen != want {
+			t.Errorf("call %d: seen = %v, want %v", i, seen, want)
+		}
+	}
+	if seen, _ := s.Seen("netbox:req:device:43"); seen {
+		t.Error("another key was seen")
+	}
+}
+
+func TestForget(t *testing.T) {
+	s, err := Open(config.DedupeConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Seen("key")
+	if err = s.Forget("key"); err != nil {
+		t.Fatal(err)
+	}
+	if seen, _ := s.Seen("key"); seen {
+		t.Error("forgotten key was seen")
+	}
+	if err = s.Forget("unknown"); err != nil {
+		t.Errorf("forgetting an unknown key: %v", err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	s, err := Open(config.DedupeConfig{Dir: t.TempDir(), TTL: config.Duration{Duration: time.Minute}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Seen("old")
+	s.Seen("new")
+	past := time.Now().Add(-2 * time.Minute)
+	if err = os.Chtimes(s.path("old"), past, past); err != nil {
+		t.Fatal(err)
+	}
+	if seen, _ := s.Seen("old"); seen {
+		t.Error("expired key was seen")
+	}
+	os.Chtimes(s.path("new"), past, past)
+	if err = s.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(s.path("new")); !os.IsNotExist(err) {
+		t.Error("expired key was not pruned")
+	}
+}
@@ -0,0 +1,232 @@
+// Package dnsupdate sends RFC 2136 dynamic updates, optionally signed
+// with TSIG (RFC 8945), to the authoritative servers in the config.
+package dnsupdate
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/rsapc/hookcmd/config"
+	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/hookcmd/resolver"
+	"golang.org/x/exp/slog"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var ErrNoZone = errors.New("no update zone configured for name")
+
+const (
+	defaultTTL = 3600
+	opUpdate   = dnsmessage.OpCode(5)
+	classNone  = dnsmessage.Class(254)
+	timeout    = 10 * time.Second
+)
+
+type Client struct {
+	cfg config.DNSUpdateConfig
+	log models.Logger
+}
+
+// NewClient creates a client for the configured update zones
+func NewClient(cfg config.DNSUpdateConfig, logger models.Logger) *Client {
+	c := &Client{cfg: cfg, log: logger}
+	if c.cfg.TTL == 0 {
+		c.cfg.TTL = defaultTTL
+	}
+	if log, ok := logger.(*slog.Logger); ok {
+		c.log = log.With("service", "dnsupdate")
+	}
+	return c
+}
+
+// Enabled returns true if any update zones are configured
+func (c *Client) Enabled() bool {
+	return len(c.cfg.Zones) > 0
+}
+
+// zoneFor returns the configured zone with the longest name containing name
+func (c *Client) zoneFor(name string) (zone config.UpdateZoneConfig, err error) {
+	found := false
+	for _, z := range c.cfg.Zones {
+		if resolver.InZone(name, z.Zone) && len(z.Zone) > len(zone.Zone) {
+			zone = z
+			found = true
+		}
+	}
+	if !found {
+		return zone, fmt.Errorf("%w: %s", ErrNoZone, name)
+	}
+	return zone, nil
+}
+
+// rr is a single record in the update section
+type rr struct {
+	name   string
+	class  dnsmessage.Class
+	ttl    uint32
+	rrType dnsmessage.Type
+	addr   netip.Addr
+	target string
+	// empty sends no rdata, which deletes the whole RRset
+	empty bool
+}
+
+// ReplaceAddress replaces the A or AAAA records of name with one for addr
+// so a stale address of the same family is not left behind
+func (c *Client) ReplaceAddress(name string, addr netip.Addr) error {
+	return c.update(name,
+		rr{name: name, class: dnsmessage.ClassANY, rrType: addrType(addr), empty: true},
+		rr{name: name, class: dnsmessage.ClassINET, ttl: c.cfg.TTL, rrType: addrType(addr), addr: addr},
+	)
+}
+
+// RemoveAddress removes the A or AAAA record for name with addr.  Other
+// addresses of name are kept.
+func (c *Client) RemoveAddress(name string, addr netip.Addr) error {
+	return c.update(name, rr{name: name, class: classNone, rrType: addrType(addr), addr: addr})
+}
+
+// ReplacePTR replaces the PTR records of addr with one pointing to name
+func (c *Client) ReplacePTR(addr netip.Addr, name string) error {
+	reverse := resolver.ReverseName(addr)
+	return c.update(reverse,
+		rr{name: reverse, class: dnsmessage.ClassANY, rrType: dnsmessage.TypePTR, empty: true},
+		rr{name: reverse, class: dnsmessage.ClassINET, ttl: c.cfg.TTL, rrType: dnsmessage.TypePTR, target: name},
+	)
+}
+
+// RemovePTR removes the PTR record of addr pointing to name
+func (c *Client) RemovePTR(addr netip.Addr, name string) error {
+	reverse := resolver.ReverseName(addr)
+	return c.update(reverse, rr{name: reverse, class: classNone, rrType: dnsmessage.TypePTR, target: name})
+}
+
+func addrType(addr netip.Addr) dnsmessage.Type {
+	if addr.Is4() {
+		return dnsmessage.TypeA
+	}
+	return dnsmessage.TypeAAAA
+}
+
+// update sends the records to the zone containing owner
+func (c *Client) update(owner string, records ...rr) error {
+	zone, err := c.zoneFor(owner)
+	if err != nil {
+		return err
+	}
+	id := uint16(rand.Intn(1 << 16))
+	msg, err := buildUpdate(id, zone.Zone, records...)
+	if err != nil {
+		return err
+	}
+	var requestMAC []byte
+	if zone.KeyName != "" {
+		if msg, requestMAC, err = sign(msg, zone, time.Now()); err != nil {
+			return err
+		}
+	}
+	resp, err := exchange(zone.Server, msg)
+	if err != nil {
+		c.log.Error("could not send update", "zone", zone.Zone, "server", zone.Server, "error", err)
+		return err
+	}
+	var p dnsmessage.Parser
+	hdr, err := p.Start(resp)
+	if err != nil {
+		return fmt.Errorf("invalid response from %s: %w", zone.Server, err)
+	}
+	if hdr.ID != id {
+		return fmt.Errorf("response ID %d from %s does not match %d", hdr.ID, zone.Server, id)
+	}
+	if hdr.RCode != dnsmessage.RCodeSuccess {
+		c.log.Error("update refused", "zone", zone.Zone, "server", zone.Server, "rcode", hdr.RCode)
+		return fmt.Errorf("update of %s refused by %s: %s", owner, zone.Server, hdr.RCode)
+	}
+	if zone.KeyName != "" {
+		if err = verify(resp, requestMAC, zone, time.Now()); err != nil {
+			c.log.Error("update response not verified", "zone", zone.Zone, "server", zone.Server, "error", err)
+			return fmt.Errorf("update of %s sent to %s: %w", owner, zone.Server, err)
+		}
+	}
+	c.log.Info("dns updated", "zone", zone.Zone, "name", owner)
+	return nil
+}
+
+// buildUpdate creates the update message for zone
+func buildUpdate(id uint16, zone string, records ...rr) ([]byte, error) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, OpCode: opUpdate})
+	zoneName, err := dnsmessage.NewName(fqdn(zone))
+	if err != nil {
+		return nil, err
+	}
+	if err = b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err = b.Question(dnsmessage.Question{Name: zoneName, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	if err = b.StartAuthorities(); err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		name, err := dnsmessage.NewName(fqdn(r.name))
+		if err != nil {
+			return nil, err
+		}
+		hdr := dnsmessage.ResourceHeader{Name: name, Class: r.class, TTL: r.ttl}
+		switch {
+		case r.empty:
+			err = b.UnknownResource(hdr, dnsmessage.UnknownResource{Type: r.rrType})
+		case r.rrType == dnsmessage.TypeA:
+			err = b.AResource(hdr, dnsmessage.AResource{A: r.addr.As4()})
+		case r.rrType == dnsmessage.TypeAAAA:
+			err = b.AAAAResource(hdr, dnsmessage.AAAAResource{AAAA: r.addr.As16()})
+		case r.rrType == dnsmessage.TypePTR:
+			var target dnsmessage.Name
+			if target, err = dnsmessage.NewName(fqdn(r.target)); err == nil {
+				err = b.PTRResource(hdr, dnsmessage.PTRResource{PTR: target})
+			}
+		default:
+			err = fmt.Errorf("unsupported record type %s", r.rrType)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
+
+// exchange sends msg to server over TCP and returns the response
+func exchange(server string, msg []byte) ([]byte, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	conn, err := net.DialTimeout("tcp", server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 2, len(msg)+2)
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	if _, err = conn.Write(append(buf, msg...)); err != nil {
+		return nil, err
+	}
+	if _, err = io.ReadFull(conn, buf[:2]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(buf[:2]))
+	_, err = io.ReadFull(conn, resp)
+	return resp, err
+}
+
+func fqdn(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
@@ -0,0 +1,505 @@
+package dnsupdate
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rsapc/hookcmd/config"
+	"golang.org/x/exp/slog"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	testKeyName = "hookcmd."
+	// base64 of "secret-key-for-tests"
+	testSecret = "c2VjcmV0LWtleS1mb3ItdGVzdHM="
+)
+
+// The golden packets were built by hand from RFC 2136 and RFC 8945 with
+// an independent HMAC implementation.
+var (
+	// update of example.com adding host.example.com 3600 IN A 192.0.2.10
+	goldenUpdate = "1234" + "2800" + "0001" + "0000" + "0001" + "0000" + // header: ID, opcode 5, ZO 1, UP 1
+		"076578616d706c6503636f6d00" + "0006" + "0001" + // zone example.com SOA IN
+		"04686f7374076578616d706c6503636f6d00" + "0001" + "0001" + "00000e10" + "0004" + "c000020a" // host.example.com A IN 3600 192.0.2.10
+	// goldenUpdate signed with hmac-sha256 key hookcmd. at 1700000000
+	goldenSigned = "1234" + "2800" + "0001" + "0000" + "0001" + "0001" + // ARCOUNT 1
+		goldenUpdate[24:] +
+		"07686f6f6b636d6400" + "00fa" + "00ff" + "00000000" + "003d" + // hookcmd. TSIG ANY 0
+		"0b686d61632d73686132353600" + "00006553f100" + "012c" + "0020" + // algorithm, time signed, fudge, MAC size
+		"a531cce6c0c3b760a516722c84907416b0db027413626c284ac15a6a8c19d476" + // MAC
+		"1234" + "0000" + "0000" // original ID, error, other len
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestBuildUpdateGolden(t *testing.T) {
+	msg, err := buildUpdate(0x1234, "example.com", rr{name: "host.example.com", class: dnsmessage.ClassINET,
+		ttl: 3600, rrType: dnsmessage.TypeA, addr: netip.MustParseAddr("192.0.2.10")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustHex(t, goldenUpdate); !bytes.Equal(msg, want) {
+		t.Errorf("update message\n got %x\nwant %x", msg, want)
+	}
+}
+
+func TestSignGolden(t *testing.T) {
+	zone := config.UpdateZoneConfig{Zone: "example.com", KeyName: testKeyName, KeySecret: testSecret}
+	signed, mac, err := sign(mustHex(t, goldenUpdate), zone, time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustHex(t, goldenSigned); !bytes.Equal(signed, want) {
+		t.Errorf("signed message\n got %x\nwant %x", signed, want)
+	}
+	if want := mustHex(t, goldenSigned[len(goldenSigned)-76:len(goldenSigned)-12]); !bytes.Equal(mac, want) {
+		t.Errorf("MAC %x, want %x", mac, want)
+	}
+}
+
+func TestSignVerifies(t *testing.T) {
+	msg, err := buildUpdate(7, "2.0.192.in-addr.arpa",
+		rr{name: "10.2.0.192.in-addr.arpa", class: dnsmessage.ClassANY, rrType: dnsmessage.TypePTR, empty: true},
+		rr{name: "10.2.0.192.in-addr.arpa", class: dnsmessage.ClassINET, ttl: 60, rrType: dnsmessage.TypePTR, target: "host.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, alg := range []string{"", "hmac-sha512", "hmac-sha1"} {
+		zone := config.UpdateZoneConfig{KeyName: testKeyName, KeySecret: testSecret, KeyAlgorithm: alg}
+		signed, _, err := sign(msg, zone, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = verifyTSIG(signed, nil, testKeyName, testSecret, time.Now()); err != nil {
+			t.Errorf("%s: %v", alg, err)
+		}
+		signed[len(msg)-1] ^= 0xff
+		if _, err = verifyTSIG(signed, nil, testKeyName, testSecret, time.Now()); err == nil {
+			t.Errorf("%s: tampered message verified", alg)
+		}
+	}
+}
+
+func TestVerifyResponse(t *testing.T) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 7, Response: true, OpCode: opUpdate})
+	resp, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zone := config.UpdateZoneConfig{KeyName: testKeyName, KeySecret: testSecret}
+	request := &signedMessage{mac: []byte("request MAC"), alg: "hmac-sha256"}
+	now := time.Now()
+	signed := signResponse(resp, request, testKeyName, testSecret, now)
+	if err = verify(signed, request.mac, zone, now); err != nil {
+		t.Fatalf("signed response: %v", err)
+	}
+
+	tampered := append([]byte{}, signed...)
+	tampered[3] |= 5 // REFUSED
+	otherKey := zone
+	otherKey.KeyName = "other."
+	otherAlg := zone
+	otherAlg.KeyAlgorithm = "hmac-sha512"
+	tests := []struct {
+		name string
+		msg  []byte
+		mac  []byte
+		zone config.UpdateZoneConfig
+		want error
+	}{
+		{"unsigned", resp, request.mac, zone, ErrUnsigned},
+		{"another request", signed, []byte("other MAC"), zone, ErrBadSignature},
+		{"tampered", tampered, request.mac, zone, ErrBadSignature},
+		{"stale", signResponse(resp, request, testKeyName, testSecret, now.Add(-time.Hour)), request.mac, zone, ErrBadSignature},
+		{"other key", signed, request.mac, otherKey, ErrBadSignature},
+		{"other algorithm", signed, request.mac, otherAlg, ErrBadSignature},
+	}
+	for _, tt := range tests {
+		if err := verify(tt.msg, tt.mac, tt.zone, now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if err = verify(signed[:len(signed)-3], request.mac, zone, now); err == nil {
+		t.Error("truncated response verified")
+	}
+}
+
+func TestUpdateLocalServer(t *testing.T) {
+	srv := newTestServer(t, "example.com", "2.0.192.in-addr.arpa")
+	zones := []config.UpdateZoneConfig{
+		{Zone: "example.com", Server: srv.addr, KeyName: testKeyName, KeySecret: testSecret},
+		{Zone: "2.0.192.in-addr.arpa", Server: srv.addr, KeyName: testKeyName, KeySecret: testSecret, KeyAlgorithm: "hmac-sha512"},
+	}
+	c := NewClient(config.DNSUpdateConfig{TTL: 300, Zones: zones}, slog.Default())
+	addr := netip.MustParseAddr("192.0.2.10")
+	steps := []struct {
+		name string
+		run  func() error
+		want []string
+	}{
+		{"set A", func() error { return c.ReplaceAddress("host.example.com", netip.MustParseAddr("192.0.2.99")) },
+			[]string{"host.example.com. A 192.0.2.99"}},
+		{"replace A", func() error { return c.ReplaceAddress("host.example.com", addr) },
+			[]string{"host.example.com. A 192.0.2.10"}},
+		{"set AAAA", func() error { return c.ReplaceAddress("host.example.com", netip.MustParseAddr("2001:db8::10")) },
+			[]string{"host.example.com. A 192.0.2.10", "host.example.com. AAAA 2001:db8::10"}},
+		{"replace PTR", func() error { return c.ReplacePTR(addr, "old.example.com") },
+			[]string{"10.2.0.192.in-addr.arpa. PTR old.example.com.", "host.example.com. A 192.0.2.10", "host.example.com. AAAA 2001:db8::10"}},
+		{"replace PTR again", func() error { return c.ReplacePTR(addr, "host.example.com") },
+			[]string{"10.2.0.192.in-addr.arpa. PTR host.example.com.", "host.example.com. A 192.0.2.10", "host.example.com. AAAA 2001:db8::10"}},
+		{"remove A", func() error { return c.RemoveAddress("host.example.com", addr) },
+			[]string{"10.2.0.192.in-addr.arpa. PTR host.example.com.", "host.example.com. AAAA 2001:db8::10"}},
+		{"remove PTR", func() error { return c.RemovePTR(addr, "host.example.com") },
+			[]string{"host.example.com. AAAA 2001:db8::10"}},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got := srv.records(); strings.Join(got, "\n") != strings.Join(step.want, "\n") {
+			t.Fatalf("%s: zone is\n%s\nwant\n%s", step.name, strings.Join(got, "\n"), strings.Join(step.want, "\n"))
+		}
+	}
+
+	if err := c.ReplaceAddress("host.example.org", addr); !errors.Is(err, ErrNoZone) {
+		t.Errorf("update outside the zones returned %v, want ErrNoZone", err)
+	}
+	badKey := NewClient(config.DNSUpdateConfig{Zones: []config.UpdateZoneConfig{
+		{Zone: "example.com", Server: srv.addr, KeyName: testKeyName, KeySecret: base64.StdEncoding.EncodeToString([]byte("wrong"))},
+	}}, slog.Default())
+	if err := badKey.ReplaceAddress("bad.example.com", addr); err == nil || !strings.Contains(err.Error(), "refused") {
+		t.Errorf("update with the wrong key returned %v, want refused", err)
+	}
+	srv.mu.Lock()
+	srv.unsigned = true
+	srv.mu.Unlock()
+	if err := c.ReplaceAddress("host.example.com", addr); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("update with an unsigned response returned %v, want ErrUnsigned", err)
+	}
+}
+
+// TestUpdateServer sends updates to the authoritative server in
+// HOOKCMD_TEST_DNS_SERVER (eg. BIND on 127.0.0.1:5353) for the zone in
+// HOOKCMD_TEST_DNS_ZONE signed with HOOKCMD_TEST_DNS_KEY (name:secret)
+func TestUpdateServer(t *testing.T) {
+	server, zone := os.Getenv("HOOKCMD_TEST_DNS_SERVER"), os.Getenv("HOOKCMD_TEST_DNS_ZONE")
+	if server == "" || zone == "" {
+		t.Skip("HOOKCMD_TEST_DNS_SERVER and HOOKCMD_TEST_DNS_ZONE are not set")
+	}
+	cfg := config.UpdateZoneConfig{Zone: zone, Server: server}
+	cfg.KeyName, cfg.KeySecret, _ = strings.Cut(os.Getenv("HOOKCMD_TEST_DNS_KEY"), ":")
+	c := NewClient(config.DNSUpdateConfig{TTL: 60, Zones: []config.UpdateZoneConfig{cfg}}, slog.Default())
+	name := "hookcmd-test." + zone
+	addr := netip.MustParseAddr("192.0.2.254")
+	if err := c.ReplaceAddress(name, addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveAddress(name, addr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signedMessage is a message checked by verifyTSIG
+type signedMessage struct {
+	unsigned []byte
+	mac      []byte
+	alg      string
+}
+
+// verifyTSIG checks the TSIG record that ends msg as a server would.  A
+// response is checked against the MAC of its request.
+func verifyTSIG(msg []byte, requestMAC []byte, keyName string, secret string, now time.Time) (*signedMessage, error) {
+	var p dnsmessage.Parser
+	if _, err := p.Start(msg); err != nil {
+		return nil, err
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, err
+	}
+	if err := p.SkipAllAnswers(); err != nil {
+		return nil, err
+	}
+	if err := p.SkipAllAuthorities(); err != nil {
+		return nil, err
+	}
+	var tsigHdr dnsmessage.ResourceHeader
+	var tsig dnsmessage.UnknownResource
+	for {
+		h, err := p.AdditionalHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		r, err := p.UnknownResource()
+		if err != nil {
+			return nil, err
+		}
+		tsigHdr, tsig = h, r
+	}
+	if tsigHdr.Type != typeTSIG {
+		return nil, errors.New("message is not signed")
+	}
+	if !strings.EqualFold(tsigHdr.Name.String(), keyName) {
+		return nil, fmt.Errorf("signed with unknown key %s", tsigHdr.Name)
+	}
+	owner := wireName(tsigHdr.Name.String())
+	unsigned := append([]byte{}, msg[:len(msg)-len(owner)-10-len(tsig.Data)]...)
+	binary.BigEndian.PutUint16(unsigned[10:12], binary.BigEndian.Uint16(msg[10:12])-1)
+
+	// rdata: algorithm, time signed, fudge, MAC, original ID, error, other
+	data := tsig.Data
+	algLen := bytes.IndexByte(data, 0) + 1
+	alg, rest := data[:algLen], data[algLen:]
+	timeAndFudge := rest[:8]
+	signedAt := int64(binary.BigEndian.Uint64(append([]byte{0, 0}, rest[:6]...)))
+	fudge := int64(binary.BigEndian.Uint16(rest[6:8]))
+	macLen := int(binary.BigEndian.Uint16(rest[8:10]))
+	mac := rest[10 : 10+macLen]
+	rest = rest[10+macLen:]
+	copy(unsigned[0:2], rest[0:2])
+	errorAndOther := rest[2:]
+
+	var labels []string
+	for b := alg; len(b) > 1; b = b[b[0]+1:] {
+		labels = append(labels, string(b[1:b[0]+1]))
+	}
+	algName, newHash, err := algorithm(strings.Join(labels, "."))
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(newHash, key)
+	if requestMAC != nil {
+		h.Write(binary.BigEndian.AppendUint16(nil, uint16(len(requestMAC))))
+		h.Write(requestMAC)
+	}
+	h.Write(unsigned)
+	h.Write(owner)
+	h.Write([]byte{0, 255, 0, 0, 0, 0})
+	h.Write(alg)
+	h.Write(timeAndFudge)
+	h.Write(errorAndOther)
+	if !hmac.Equal(h.Sum(nil), mac) {
+		return nil, errors.New("bad MAC")
+	}
+	if d := now.Unix() - signedAt; d > fudge || d < -fudge {
+		return nil, fmt.Errorf("signed %ds ago, outside the fudge", d)
+	}
+	return &signedMessage{unsigned: unsigned, mac: mac, alg: algName}, nil
+}
+
+// signResponse appends a TSIG record to the response msg covering the MAC
+// of request, as a server would
+func signResponse(msg []byte, request *signedMessage, keyName string, secret string, now time.Time) []byte {
+	key, _ := base64.StdEncoding.DecodeString(secret)
+	_, newHash, _ := algorithm(request.alg)
+	owner := wireName(keyName)
+	alg := wireName(request.alg)
+	timeAndFudge := binary.BigEndian.AppendUint64(nil, uint64(now.Unix()))[2:]
+	timeAndFudge = binary.BigEndian.AppendUint16(timeAndFudge, 300)
+
+	h := hmac.New(newHash, key)
+	h.Write(binary.BigEndian.AppendUint16(nil, uint16(len(request.mac))))
+	h.Write(request.mac)
+	h.Write(msg)
+	h.Write(owner)
+	h.Write([]byte{0, 255, 0, 0, 0, 0})
+	h.Write(alg)
+	h.Write(timeAndFudge)
+	h.Write([]byte{0, 0, 0, 0})
+	mac := h.Sum(nil)
+
+	rdata := append(append([]byte{}, alg...), timeAndFudge...)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(mac)))
+	rdata = append(rdata, mac...)
+	rdata = append(rdata, msg[0:2]...)
+	rdata = append(rdata, 0, 0, 0, 0)
+	out := append(append([]byte{}, msg...), owner...)
+	out = append(out, 0, 250, 0, 255, 0, 0, 0, 0)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(rdata)))
+	out = append(out, rdata...)
+	binary.BigEndian.PutUint16(out[10:12], binary.BigEndian.Uint16(out[10:12])+1)
+	return out
+}
+
+// testServer is an authoritative server that applies signed updates to
+// its zones in memory
+type testServer struct {
+	addr  string
+	zones []string
+	mu    sync.Mutex
+	rrs   map[string]bool // "name TYPE value"
+	// unsigned sends responses without a TSIG record
+	unsigned bool
+}
+
+func newTestServer(t *testing.T, zones ...string) *testServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &testServer{addr: ln.Addr().String(), zones: zones, rrs: make(map[string]bool)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(t, conn)
+		}
+	}()
+	return s
+}
+
+func (s *testServer) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return
+	}
+	rcode := dnsmessage.RCodeSuccess
+	request, err := verifyTSIG(msg, nil, testKeyName, testSecret, time.Now())
+	if err != nil {
+		t.Logf("test server: %v", err)
+		rcode = dnsmessage.RCode(9) // NOTAUTH
+	} else if err = s.apply(request.unsigned); err != nil {
+		t.Logf("test server: %v", err)
+		rcode = dnsmessage.RCodeFormatError
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: binary.BigEndian.Uint16(msg), Response: true, OpCode: opUpdate, RCode: rcode})
+	resp, _ := b.Finish()
+	s.mu.Lock()
+	if request != nil && !s.unsigned {
+		resp = signResponse(resp, request, testKeyName, testSecret, time.Now())
+	}
+	s.mu.Unlock()
+	conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+}
+
+// apply makes the changes in the update section of msg
+func (s *testServer) apply(msg []byte) error {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(msg)
+	if err != nil {
+		return err
+	}
+	if hdr.OpCode != opUpdate {
+		return fmt.Errorf("opcode %d is not update", hdr.OpCode)
+	}
+	q, err := p.Question()
+	if err != nil {
+		return err
+	}
+	zone := strings.TrimSuffix(q.Name.String(), ".")
+	found := false
+	for _, z := range s.zones {
+		found = found || z == zone
+	}
+	if !found || q.Type != dnsmessage.TypeSOA {
+		return fmt.Errorf("not authoritative for %s", q.Name)
+	}
+	if err = p.SkipAllQuestions(); err != nil {
+		return err
+	}
+	if err = p.SkipAllAnswers(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		h, err := p.AuthorityHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var value string
+		switch {
+		case h.Length == 0:
+			if err = p.SkipAuthority(); err != nil {
+				return err
+			}
+		case h.Type == dnsmessage.TypeA:
+			r, err := p.AResource()
+			if err != nil {
+				return err
+			}
+			value = netip.AddrFrom4(r.A).String()
+		case h.Type == dnsmessage.TypeAAAA:
+			r, err := p.AAAAResource()
+			if err != nil {
+				return err
+			}
+			value = netip.AddrFrom16(r.AAAA).String()
+		case h.Type == dnsmessage.TypePTR:
+			r, err := p.PTRResource()
+			if err != nil {
+				return err
+			}
+			value = r.PTR.String()
+		default:
+			return fmt.Errorf("unexpected %s record", h.Type)
+		}
+		rrset := fmt.Sprintf("%s %s", h.Name, strings.TrimPrefix(h.Type.String(), "Type"))
+		switch h.Class {
+		case dnsmessage.ClassINET:
+			s.rrs[rrset+" "+value] = true
+		case classNone:
+			delete(s.rrs, rrset+" "+value)
+		case dnsmessage.ClassANY:
+			for key := range s.rrs {
+				if strings.HasPrefix(key, rrset+" ") {
+					delete(s.rrs, key)
+				}
+			}
+		default:
+			return fmt.Errorf("unexpected class %s", h.Class)
+		}
+	}
+}
+
+// records returns the records in the zones, sorted
+func (s *testServer) records() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rrs []string
+	for rr := range s.rrs {
+		rrs = append(rrs, rr)
+	}
+	sort.Strings(rrs)
+	return rrs
+}
@@ -0,0 +1,209 @@
+package dnsupdate
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+
+	"github.com/rsapc/hookcmd/config"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	typeTSIG  = 250
+	classANY  = 255
+	tsigFudge = 300
+)
+
+var (
+	ErrUnsigned     = errors.New("response is not signed")
+	ErrBadSignature = errors.New("response signature is not valid")
+)
+
+// algorithm returns the TSIG algorithm name and hash for the configured
+// key algorithm
+func algorithm(name string) (string, func() hash.Hash, error) {
+	switch strings.ToLower(strings.TrimSuffix(name, ".")) {
+	case "", "hmac-sha256":
+		return "hmac-sha256", sha256.New, nil
+	case "hmac-sha512":
+		return "hmac-sha512", sha512.New, nil
+	case "hmac-sha1":
+		return "hmac-sha1", sha1.New, nil
+	}
+	return "", nil, fmt.Errorf("unsupported TSIG algorithm %s", name)
+}
+
+// sign appends a TSIG record to msg (RFC 8945) and returns the signed
+// message and its MAC
+func sign(msg []byte, zone config.UpdateZoneConfig, now time.Time) ([]byte, []byte, error) {
+	secret, err := base64.StdEncoding.DecodeString(zone.KeySecret)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid TSIG secret for %s: %w", zone.KeyName, err)
+	}
+	alg, newHash, err := algorithm(zone.KeyAlgorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyName := wireName(zone.KeyName)
+	algName := wireName(alg)
+	signed := make([]byte, 8)
+	binary.BigEndian.PutUint64(signed, uint64(now.Unix()))
+	timeAndFudge := binary.BigEndian.AppendUint16(signed[2:], tsigFudge)
+	errorAndOther := []byte{0, 0, 0, 0}
+
+	mac := hmac.New(newHash, secret)
+	mac.Write(msg)
+	mac.Write(variables(keyName, algName, timeAndFudge, errorAndOther))
+	sum := mac.Sum(nil)
+
+	rdata := append([]byte{}, algName...)
+	rdata = append(rdata, timeAndFudge...)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(sum)))
+	rdata = append(rdata, sum...)
+	rdata = append(rdata, msg[0:2]...)
+	rdata = append(rdata, errorAndOther...)
+
+	out := append([]byte{}, msg...)
+	out = append(out, keyName...)
+	out = binary.BigEndian.AppendUint16(out, typeTSIG)
+	out = binary.BigEndian.AppendUint16(out, classANY)
+	out = binary.BigEndian.AppendUint32(out, 0)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(rdata)))
+	out = append(out, rdata...)
+	binary.BigEndian.PutUint16(out[10:12], binary.BigEndian.Uint16(out[10:12])+1)
+	return out, sum, nil
+}
+
+// verify checks the TSIG record that ends the response msg.  The MAC of
+// a response covers the MAC of its request (RFC 8945 section 5.3).
+func verify(msg []byte, requestMAC []byte, zone config.UpdateZoneConfig, now time.Time) error {
+	secret, err := base64.StdEncoding.DecodeString(zone.KeySecret)
+	if err != nil {
+		return fmt.Errorf("invalid TSIG secret for %s: %w", zone.KeyName, err)
+	}
+	alg, newHash, err := algorithm(zone.KeyAlgorithm)
+	if err != nil {
+		return err
+	}
+	tsigHdr, tsig, err := lastAdditional(msg)
+	if err != nil {
+		return err
+	}
+	if tsigHdr.Type != typeTSIG {
+		return ErrUnsigned
+	}
+	keyName := wireName(tsigHdr.Name.String())
+	if !bytes.Equal(keyName, wireName(zone.KeyName)) {
+		return fmt.Errorf("%w: signed with key %s, want %s", ErrBadSignature, tsigHdr.Name, zone.KeyName)
+	}
+	// rdata: algorithm, time signed, fudge, MAC size, MAC, original ID,
+	// error, other len, other data
+	algName := wireName(alg)
+	data := tsig.Data
+	if !bytes.HasPrefix(data, algName) {
+		return fmt.Errorf("%w: algorithm is not %s", ErrBadSignature, alg)
+	}
+	rest := data[len(algName):]
+	if len(rest) < 10 {
+		return fmt.Errorf("%w: truncated TSIG record", ErrBadSignature)
+	}
+	timeAndFudge := rest[:8]
+	signedAt := int64(binary.BigEndian.Uint64(append([]byte{0, 0}, rest[:6]...)))
+	fudge := int64(binary.BigEndian.Uint16(rest[6:8]))
+	macLen := int(binary.BigEndian.Uint16(rest[8:10]))
+	if len(rest) < 10+macLen+6 {
+		return fmt.Errorf("%w: truncated TSIG record", ErrBadSignature)
+	}
+	mac := rest[10 : 10+macLen]
+	originalID := rest[10+macLen : 12+macLen]
+	errorAndOther := rest[12+macLen:]
+	if tsigErr := binary.BigEndian.Uint16(errorAndOther); tsigErr != 0 {
+		return fmt.Errorf("%w: TSIG error %d", ErrBadSignature, tsigErr)
+	}
+
+	// the message as it was before the TSIG record was added
+	tsigLen := len(keyName) + 10 + len(data)
+	if len(msg) < 12+tsigLen {
+		return fmt.Errorf("%w: truncated message", ErrBadSignature)
+	}
+	unsigned := append([]byte{}, msg[:len(msg)-tsigLen]...)
+	copy(unsigned[0:2], originalID)
+	binary.BigEndian.PutUint16(unsigned[10:12], binary.BigEndian.Uint16(msg[10:12])-1)
+
+	h := hmac.New(newHash, secret)
+	h.Write(binary.BigEndian.AppendUint16(nil, uint16(len(requestMAC))))
+	h.Write(requestMAC)
+	h.Write(unsigned)
+	h.Write(variables(keyName, algName, timeAndFudge, errorAndOther))
+	if !hmac.Equal(h.Sum(nil), mac) {
+		return fmt.Errorf("%w: bad MAC", ErrBadSignature)
+	}
+	if d := now.Unix() - signedAt; d > fudge || d < -fudge {
+		return fmt.Errorf("%w: signed %ds from now, outside the fudge of %ds", ErrBadSignature, d, fudge)
+	}
+	return nil
+}
+
+// variables returns the TSIG variables covered by the MAC: key name,
+// class, TTL, algorithm, time signed, fudge, error and other data
+func variables(keyName, algName, timeAndFudge, errorAndOther []byte) []byte {
+	vars := append([]byte{}, keyName...)
+	vars = binary.BigEndian.AppendUint16(vars, classANY)
+	vars = binary.BigEndian.AppendUint32(vars, 0)
+	vars = append(vars, algName...)
+	vars = append(vars, timeAndFudge...)
+	return append(vars, errorAndOther...)
+}
+
+// lastAdditional returns the last record of the additional section of msg
+func lastAdditional(msg []byte) (hdr dnsmessage.ResourceHeader, r dnsmessage.UnknownResource, err error) {
+	var p dnsmessage.Parser
+	if _, err = p.Start(msg); err != nil {
+		return hdr, r, err
+	}
+	if err = p.SkipAllQuestions(); err != nil {
+		return hdr, r, err
+	}
+	if err = p.SkipAllAnswers(); err != nil {
+		return hdr, r, err
+	}
+	if err = p.SkipAllAuthorities(); err != nil {
+		return hdr, r, err
+	}
+	for {
+		h, err := p.AdditionalHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			return hdr, r, nil
+		}
+		if err != nil {
+			return hdr, r, err
+		}
+		if r, err = p.UnknownResource(); err != nil {
+			return hdr, r, err
+		}
+		hdr = h
+	}
+}
+
+// wireName encodes name in canonical (lower case, uncompressed) wire format
+func wireName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.ToLower(strings.TrimSuffix(name, ".")), ".") {
+		if label == "" {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
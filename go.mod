@@ -12,11 +12,13 @@ require (
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/sys v0.15.0 // indirect
 	golang.org/x/time v0.5.0 // indirect
 )
 
 require (
+	github.com/gosnmp/gosnmp v1.38.0
 	github.com/rsapc/netbox v0.0.0-20240305171311-1f4bd6a240ad
 	golang.org/x/exp v0.0.0-20240222234643-814bf88cf225
-	golang.org/x/net v0.19.0 // indirect
+	golang.org/x/net v0.19.0
 )
@@ -0,0 +1,309 @@
+// Package jobs is a durable, file-backed queue of hookcmd commands.
+// Each job is a JSON file in the queue directory.  Workers claim a job
+// with an exclusive lock file so any number of workers can share the
+// queue.
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rsapc/hookcmd/config"
+	"github.com/rsapc/hookcmd/models"
+)
+
+var ErrNotFound = models.NewError("the requested job was not found", models.ErrNotFound)
+
+// ErrPermanent marks a job error that retrying will not fix.  The job is
+// marked dead without using its remaining attempts.
+var ErrPermanent = errors.New("permanent failure")
+
+// Job status values
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusDead    = "dead"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultBackoff     = 30 * time.Second
+	maxBackoff         = time.Hour
+	// staleLock is how long a claim is honoured before the job is
+	// assumed to belong to a worker that died
+	staleLock = time.Hour
+)
+
+// Job is a queued command
+type Job struct {
+	ID          string    `json:"id"`
+	Args        []string  `json:"args"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	MaxAttempts int       `json:"max_attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+	// DedupeKey is the key of the event that queued the job
+	DedupeKey string    `json:"dedupe_key,omitempty"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+}
+
+// Due returns true if the job should be run now
+func (j Job) Due(now time.Time) bool {
+	return (j.Status == StatusPending || j.Status == StatusRunning) && !j.NextAttempt.After(now)
+}
+
+type Queue struct {
+	dir         string
+	maxAttempts int
+	backoff     time.Duration
+	onDead      func(Job)
+}
+
+// Open creates the queue directory if needed and returns the queue
+func Open(cfg config.JobsConfig) (*Queue, error) {
+	q := &Queue{dir: cfg.Dir, maxAttempts: cfg.MaxAttempts, backoff: cfg.Backoff.Duration}
+	if q.dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("could not determine the job directory: %w", err)
+		}
+		q.dir = filepath.Join(home, ".hookcmd", "jobs")
+	}
+	if q.maxAttempts <= 0 {
+		q.maxAttempts = defaultMaxAttempts
+	}
+	if q.backoff <= 0 {
+		q.backoff = defaultBackoff
+	}
+	if err := os.MkdirAll(q.dir, 0o750); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *Queue) path(id string) string {
+	return filepath.Join(q.dir, id+".json")
+}
+
+func (q *Queue) lockPath(id string) string {
+	return filepath.Join(q.dir, id+".lock")
+}
+
+// Add queues the command args as a new pending job for the event with
+// dedupeKey (empty if the command is not deduplicated)
+func (q *Queue) Add(args []string, dedupeKey string) (Job, error) {
+	now := time.Now().UTC()
+	b := make([]byte, 4)
+	rand.Read(b)
+	job := Job{
+		ID:          fmt.Sprintf("%s-%s", now.Format("20060102T150405.000000"), hex.EncodeToString(b)),
+		Args:        args,
+		Status:      StatusPending,
+		MaxAttempts: q.maxAttempts,
+		NextAttempt: now,
+		DedupeKey:   dedupeKey,
+		Created:     now,
+	}
+	return job, q.Save(job)
+}
+
+// Save writes the job.  The file is replaced atomically.
+func (q *Queue) Save(job Job) error {
+	job.Updated = time.Now().UTC()
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(q.dir, job.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), q.path(job.ID))
+}
+
+// Get returns the job with the given ID
+func (q *Queue) Get(id string) (job Job, err error) {
+	data, err := os.ReadFile(q.path(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return job, ErrNotFound
+		}
+		return job, err
+	}
+	err = json.Unmarshal(data, &job)
+	return job, err
+}
+
+// List returns the jobs with the given statuses (all jobs if none are
+// given) oldest first
+func (q *Queue) List(statuses ...string) ([]Job, error) {
+	files, err := filepath.Glob(filepath.Join(q.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var jobs []Job
+	for _, file := range files {
+		job, err := q.Get(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return jobs, err
+		}
+		if len(statuses) == 0 || slices.Contains(statuses, job.Status) {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs, nil
+}
+
+// Delete removes the job
+func (q *Queue) Delete(id string) error {
+	err := os.Remove(q.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Retry resets a job so it runs again as soon as a worker picks it up
+func (q *Queue) Retry(id string) (Job, error) {
+	job, err := q.Get(id)
+	if err != nil {
+		return job, err
+	}
+	job.Status = StatusPending
+	job.Attempts = 0
+	job.NextAttempt = time.Now().UTC()
+	return job, q.Save(job)
+}
+
+// Claim locks the job for this worker.  Returns false if another worker
+// holds it.
+func (q *Queue) Claim(job Job) (bool, error) {
+	lock := q.lockPath(job.ID)
+	f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		if !errors.Is(err, os.ErrExist) {
+			return false, err
+		}
+		info, statErr := os.Stat(lock)
+		if statErr != nil || time.Since(info.ModTime()) < staleLock {
+			return false, nil
+		}
+		// the worker holding the lock has died
+		os.Remove(lock)
+		return q.Claim(job)
+	}
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	return true, f.Close()
+}
+
+// OnDead sets a function called after a job is marked dead
+func (q *Queue) OnDead(fn func(Job)) {
+	q.onDead = fn
+}
+
+// Release removes this worker's lock on the job
+func (q *Queue) Release(job Job) {
+	os.Remove(q.lockPath(job.ID))
+}
+
+// Run claims and runs each due job with exec.  Failed jobs are retried
+// with exponential backoff and marked dead after the maximum attempts, or
+// at once when the error is ErrPermanent.
+// Returns the time the next pending job is due (zero if there are none).
+func (q *Queue) Run(exec func(Job) error) (next time.Time, err error) {
+	jobs, err := q.List(StatusPending, StatusRunning)
+	if err != nil {
+		return next, err
+	}
+	now := time.Now()
+	for _, job := range jobs {
+		if !job.Due(now) {
+			if next.IsZero() || job.NextAttempt.Before(next) {
+				next = job.NextAttempt
+			}
+			continue
+		}
+		claimed, err := q.Claim(job)
+		if err != nil {
+			return next, err
+		}
+		if !claimed {
+			continue
+		}
+		job = q.runJob(job, exec)
+		q.Release(job)
+		if job.Status == StatusPending && (next.IsZero() || job.NextAttempt.Before(next)) {
+			next = job.NextAttempt
+		}
+	}
+	return next, nil
+}
+
+// runJob runs a claimed job and records the result
+func (q *Queue) runJob(job Job, exec func(Job) error) Job {
+	// reload in case another worker finished it since it was listed
+	current, err := q.Get(job.ID)
+	if err != nil || !current.Due(time.Now()) {
+		return current
+	}
+	job = current
+	job.Status = StatusRunning
+	job.Attempts++
+	q.Save(job)
+
+	err = exec(job)
+	switch {
+	case err == nil:
+		job.Status = StatusDone
+		job.LastError = ""
+	case errors.Is(err, ErrPermanent), job.Attempts >= job.MaxAttempts:
+		job.Status = StatusDead
+		job.LastError = err.Error()
+	default:
+		job.Status = StatusPending
+		job.LastError = err.Error()
+		job.NextAttempt = time.Now().UTC().Add(q.retryDelay(job.Attempts))
+	}
+	q.Save(job)
+	if job.Status == StatusDead && q.onDead != nil {
+		q.onDead(job)
+	}
+	return job
+}
+
+// retryDelay doubles the backoff for each attempt up to maxBackoff
+func (q *Queue) retryDelay(attempts int) time.Duration {
+	delay := q.backoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
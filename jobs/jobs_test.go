@@ -0,0 +1,80 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rsapc/hookcmd/config"
+)
+
+func TestRunFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		status   string
+		attempts int
+	}{
+		{"success", nil, StatusDone, 1},
+		{"transient", errors.New("exit status 6: netbox unavailable"), StatusPending, 1},
+		{"permanent", fmt.Errorf("%w (exit status 2): invalid payload", ErrPermanent), StatusDead, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Open(config.JobsConfig{Dir: t.TempDir(), MaxAttempts: 3})
+			if err != nil {
+				t.Fatal(err)
+			}
+			job, err := q.Add([]string{"devicedown", "{}"}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			runs := 0
+			if _, err = q.Run(func(Job) error { runs++; return tt.err }); err != nil {
+				t.Fatal(err)
+			}
+			if job, err = q.Get(job.ID); err != nil {
+				t.Fatal(err)
+			}
+			if runs != 1 || job.Status != tt.status || job.Attempts != tt.attempts {
+				t.Errorf("got %d runs, status %s after %d attempts, want %s after %d", runs, job.Status, job.Attempts, tt.status, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRunDeadAfterMaxAttempts(t *testing.T) {
+	q, err := Open(config.JobsConfig{Dir: t.TempDir(), MaxAttempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, _ := q.Add([]string{"devicedown", "{}"}, "")
+	q.Run(func(Job) error { return errors.New("exit status 1") })
+	if job, _ = q.Get(job.ID); job.Status != StatusDead {
+		t.Errorf("got %s, want %s", job.Status, StatusDead)
+	}
+}
+
+func TestRunOnDead(t *testing.T) {
+	q, err := Open(config.JobsConfig{Dir: t.TempDir(), MaxAttempts: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dead []string
+	q.OnDead(func(job Job) { dead = append(dead, job.DedupeKey) })
+	job, _ := q.Add([]string{"devicedown", "{}"}, "netbox:req-1:device:5")
+	fail := func(Job) error { return errors.New("exit status 1") }
+
+	q.Run(fail)
+	if len(dead) != 0 {
+		t.Fatalf("OnDead called for %v while the job can be retried", dead)
+	}
+	job.NextAttempt = job.Created
+	job.Status = StatusPending
+	job.Attempts = 1
+	q.Save(job)
+	q.Run(fail)
+	if len(dead) != 1 || dead[0] != "netbox:req-1:device:5" {
+		t.Errorf("OnDead called with %v, want the job's dedupe key", dead)
+	}
+}
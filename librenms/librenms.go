@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/go-resty/resty/v2"
@@ -11,9 +15,12 @@ import (
 	"golang.org/x/exp/slog"
 )
 
-var ErrNotFound = errors.New("the request object was not found")
+var ErrNotFound = models.NewError("the request object was not found", models.ErrNotFound)
 
-const portColumns = "columns=device_id,ifName,ifType,ifAlias,ifDescr,portName,ifOperStatus,ifPhysAddress,ifVlan,ifTrunk,ifSpeed,ifDuplex"
+// locationIDPattern finds the ID in the add location message
+var locationIDPattern = regexp.MustCompile(`#(\d+)`)
+
+const portColumns = "columns=port_id,device_id,ifIndex,ifName,ifType,ifAlias,ifDescr,portName,ifOperStatus,ifPhysAddress,ifVlan,ifTrunk,ifSpeed,ifDuplex"
 
 type Client struct {
 	client  *resty.Client
@@ -48,15 +55,17 @@ func (c *Client) buildURL(path string, args ...any) string {
 	return fmt.Sprintf("%s%s", c.baseURL, urlPath)
 }
 
-// AddDevice adds the given IP to LibreNMS to monitor.  Returns the
+// DeviceURL returns the link to the device in the LibreNMS UI
+func (c *Client) DeviceURL(deviceID int) string {
+	return fmt.Sprintf("%s/device/device=%d/", strings.TrimSuffix(c.baseURL, "/api/v0"), deviceID)
+}
+
+// AddDevice adds the given device to LibreNMS to monitor.  Returns the
 // device ID assigned in LibreNMS
-func (c *Client) AddDevice(ip string) (deviceID int, err error) {
+func (c *Client) AddDevice(device NewDevice) (deviceID int, err error) {
 	obj := AddDeviceResponse{}
 	r := c.buildRequest().SetResult(&obj)
-	data := make(map[string]interface{})
-	data["hostname"] = ip
-	data["ping_fallback"] = true
-	r.SetBody(data)
+	r.SetBody(device)
 	resp, err := r.Post(c.buildURL("/devices"))
 	if err != nil {
 		c.log.Error("Could not add device to LibreNMS: %v", err)
@@ -64,9 +73,8 @@ func (c *Client) AddDevice(ip string) (deviceID int, err error) {
 	}
 	if resp.IsError() {
 		json.Unmarshal(resp.Body(), &obj)
-		errMsg := fmt.Sprintf("invalid response from server: %d.  %s", resp.StatusCode(), obj.Message)
-		c.log.Error(errMsg, "url", r.URL, "body", string(resp.Body()))
-		return deviceID, fmt.Errorf("%s", errMsg)
+		c.log.Error("invalid response from server", "status", resp.StatusCode(), "url", r.URL, "body", string(resp.Body()))
+		return deviceID, fmt.Errorf("invalid response from server: %w", &models.StatusError{Status: resp.StatusCode(), Message: obj.Message})
 	}
 	if obj.Status == "ok" {
 		c.log.Info(obj.Message)
@@ -94,7 +102,7 @@ func (c *Client) GetDevice(deviceID int) (LibreDevice, error) {
 		}
 		errObj, _ := GetLibreError(resp)
 		c.log.Error("error status returned", "url", r.URL, "err", errObj.Message)
-		return device, fmt.Errorf("error status returned %d: %s", resp.StatusCode(), errObj.Message)
+		return device, fmt.Errorf("error status returned %w", &models.StatusError{Status: resp.StatusCode(), Message: errObj.Message})
 	}
 	if obj.Count == 0 {
 		return device, ErrNotFound
@@ -108,6 +116,21 @@ func (c *Client) GetDevice(deviceID int) (LibreDevice, error) {
 	return device, nil
 }
 
+// GetDevices returns all the devices in LibreNMS
+func (c *Client) GetDevices() (devices []LibreDevice, err error) {
+	obj := LibreDeviceResponse{}
+	r := c.buildRequest().SetResult(&obj)
+	resp, err := r.Get(c.buildURL("/devices"))
+	if err != nil {
+		c.log.Error("error getting devices", "url", r.URL, "err", err)
+		return devices, err
+	}
+	if err = c.checkResponse(r, resp); err != nil {
+		return devices, err
+	}
+	return obj.Devices, nil
+}
+
 func (c *Client) GetIPs() (ipList []IP, err error) {
 	obj := IPResponse{}
 	r := c.buildRequest().SetResult(&obj)
@@ -122,12 +145,36 @@ func (c *Client) GetIPs() (ipList []IP, err error) {
 		}
 		errObj, _ := GetLibreError(resp)
 		c.log.Error("error status returned", "url", r.URL, "err", errObj.Message)
-		return ipList, fmt.Errorf("error status returned %d: %s", resp.StatusCode(), errObj.Message)
+		return ipList, fmt.Errorf("error status returned %w", &models.StatusError{Status: resp.StatusCode(), Message: errObj.Message})
 	}
 	ipList = obj.IPAddresses
 	return ipList, err
 }
 
+// GetDeviceIPs returns the IPv4 and IPv6 addresses configured on the device.
+// If the device has no addresses an ErrNotFound is returned
+func (c *Client) GetDeviceIPs(deviceID int) (ipList []IP, err error) {
+	obj := DeviceIPResponse{}
+	r := c.buildRequest().SetResult(&obj)
+	resp, err := r.Get(c.buildURL("/devices/%d/ip", deviceID))
+	if err != nil {
+		c.log.Error("error getting device IPs", "url", r.URL, "err", err)
+		return ipList, err
+	}
+	if resp.IsError() {
+		if resp.StatusCode() == 404 {
+			return ipList, ErrNotFound
+		}
+		errObj, _ := GetLibreError(resp)
+		c.log.Error("error status returned", "url", r.URL, "err", errObj.Message)
+		return ipList, fmt.Errorf("error status returned %w", &models.StatusError{Status: resp.StatusCode(), Message: errObj.Message})
+	}
+	if len(obj.Addresses) == 0 {
+		return ipList, ErrNotFound
+	}
+	return obj.Addresses, nil
+}
+
 // GetPort returns the individual port request by ID
 func (c *Client) GetPort(portID int) (port Port, err error) {
 	obj := PortResponse{}
@@ -143,7 +190,7 @@ func (c *Client) GetPort(portID int) (port Port, err error) {
 		}
 		errObj, _ := GetLibreError(resp)
 		c.log.Error("error status returned", "url", r.URL, "err", errObj.Message)
-		return port, fmt.Errorf("error status returned %d: %s", resp.StatusCode(), errObj.Message)
+		return port, fmt.Errorf("error status returned %w", &models.StatusError{Status: resp.StatusCode(), Message: errObj.Message})
 	}
 	if obj.Count == 0 {
 		return port, ErrNotFound
@@ -188,7 +235,7 @@ func (c *Client) GetPortsForDevice(id int) (ports []Port, err error) {
 		}
 		errObj, _ := GetLibreError(resp)
 		c.log.Error("error status returned", "url", r.URL, "err", errObj.Message)
-		return ports, fmt.Errorf("error status returned %d: %s", resp.StatusCode(), errObj.Message)
+		return ports, fmt.Errorf("error status returned %w", &models.StatusError{Status: resp.StatusCode(), Message: errObj.Message})
 	}
 	for _, port := range obj.Ports {
 		if port.DeviceID == id {
@@ -230,3 +277,287 @@ func (c *Client) GetDeviceByIP(ip string) (device LibreDevice, err error) {
 	}
 	return c.GetDevice(port.DeviceID)
 }
+
+// GetFDBForDevice returns the forwarding table entries learned on the
+// given device.  If there are no entries an ErrNotFound is returned
+func (c *Client) GetFDBForDevice(id int) (entries []FdbEntry, err error) {
+	obj := &FdbResponse{}
+	r := c.buildRequest().SetResult(obj)
+	resp, err := r.Get(c.buildURL("/devices/%d/fdb", id))
+	if err != nil {
+		c.log.Error("error getting fdb", "url", r.URL, "err", err)
+		return entries, err
+	}
+	if resp.IsError() {
+		if resp.StatusCode() == 404 {
+			return entries, ErrNotFound
+		}
+		errObj, _ := GetLibreError(resp)
+		c.log.Error("error status returned", "url", r.URL, "err", errObj.Message)
+		return entries, fmt.Errorf("error status returned %w", &models.StatusError{Status: resp.StatusCode(), Message: errObj.Message})
+	}
+	entries = obj.PortsFdb
+	if len(entries) == 0 {
+		return entries, ErrNotFound
+	}
+	return entries, nil
+}
+
+// GetARP returns the ARP entries on all devices for the query, which is
+// an IP address, a CIDR network or a MAC address
+func (c *Client) GetARP(query string) (entries []ArpEntry, err error) {
+	obj := &ArpResponse{}
+	r := c.buildRequest().SetResult(obj)
+	resp, err := r.Get(c.buildURL("/resources/ip/arp/%s", url.PathEscape(query)))
+	if err != nil {
+		c.log.Error("error getting arp", "url", r.URL, "err", err)
+		return entries, err
+	}
+	if resp.IsError() {
+		if resp.StatusCode() == 404 {
+			return entries, ErrNotFound
+		}
+		errObj, _ := GetLibreError(resp)
+		c.log.Error("error status returned", "url", r.URL, "err", errObj.Message)
+		return entries, fmt.Errorf("error status returned %w", &models.StatusError{Status: resp.StatusCode(), Message: errObj.Message})
+	}
+	return obj.Arp, nil
+}
+
+// UpdateDevice sets the given fields (eg. disabled, overwrite_ip) on the
+// device
+func (c *Client) UpdateDevice(deviceID int, fields map[string]interface{}) error {
+	body := struct {
+		Field []string      `json:"field"`
+		Data  []interface{} `json:"data"`
+	}{}
+	for field, value := range fields {
+		body.Field = append(body.Field, field)
+		body.Data = append(body.Data, value)
+	}
+	r := c.buildRequest().SetBody(body)
+	resp, err := r.Patch(c.buildURL("/devices/%d", deviceID))
+	if err != nil {
+		c.log.Error("error updating device", "url", r.URL, "err", err)
+		return err
+	}
+	return c.checkResponse(r, resp)
+}
+
+// DeleteDevice removes the device and its history from LibreNMS
+func (c *Client) DeleteDevice(deviceID int) error {
+	r := c.buildRequest()
+	resp, err := r.Delete(c.buildURL("/devices/%d", deviceID))
+	if err != nil {
+		c.log.Error("error deleting device", "url", r.URL, "err", err)
+		return err
+	}
+	return c.checkResponse(r, resp)
+}
+
+// checkResponse returns ErrNotFound for a 404 and an error with the
+// LibreNMS message for any other error status
+func (c *Client) checkResponse(r *resty.Request, resp *resty.Response) error {
+	if !resp.IsError() {
+		return nil
+	}
+	if resp.StatusCode() == 404 {
+		return ErrNotFound
+	}
+	errObj, _ := GetLibreError(resp)
+	c.log.Error("error status returned", "url", r.URL, "err", errObj.Message)
+	return fmt.Errorf("error status returned %w", &models.StatusError{Status: resp.StatusCode(), Message: errObj.Message})
+}
+
+// RenameDevice changes the hostname LibreNMS polls the device by
+func (c *Client) RenameDevice(deviceID int, hostname string) error {
+	r := c.buildRequest()
+	resp, err := r.Patch(c.buildURL("/devices/%d/rename/%s", deviceID, hostname))
+	if err != nil {
+		c.log.Error("error renaming device", "url", r.URL, "err", err)
+		return err
+	}
+	return c.checkResponse(r, resp)
+}
+
+// GetHealth returns the sensors of the given health type (eg.
+// device_processor, device_mempool, device_temperature) on the device.
+// If there are none an ErrNotFound is returned
+func (c *Client) GetHealth(deviceID int, healthType string) (graphs []HealthGraph, err error) {
+	obj := HealthResponse{}
+	r := c.buildRequest().SetResult(&obj)
+	resp, err := r.Get(c.buildURL("/devices/%d/health/%s", deviceID, healthType))
+	if err != nil {
+		c.log.Error("error getting device health", "url", r.URL, "err", err)
+		return graphs, err
+	}
+	if err = c.checkResponse(r, resp); err != nil {
+		return graphs, err
+	}
+	if len(obj.Graphs) == 0 {
+		return graphs, ErrNotFound
+	}
+	return obj.Graphs, nil
+}
+
+// GetHealthSensor returns the current values of a single health sensor
+func (c *Client) GetHealthSensor(deviceID int, healthType string, sensorID int) (sensor HealthSensor, err error) {
+	obj := HealthSensorResponse{}
+	r := c.buildRequest().SetResult(&obj)
+	resp, err := r.Get(c.buildURL("/devices/%d/health/%s/%d", deviceID, healthType, sensorID))
+	if err != nil {
+		c.log.Error("error getting health sensor", "url", r.URL, "err", err)
+		return sensor, err
+	}
+	if err = c.checkResponse(r, resp); err != nil {
+		return sensor, err
+	}
+	if len(obj.Graphs) == 0 {
+		return sensor, ErrNotFound
+	}
+	return obj.Graphs[0], nil
+}
+
+// GetVMInfo returns the virtual machines LibreNMS discovered on the
+// hypervisor.  If there are none an ErrNotFound is returned
+func (c *Client) GetVMInfo(deviceID int) (vms []VMInfo, err error) {
+	obj := VMInfoResponse{}
+	r := c.buildRequest().SetResult(&obj)
+	resp, err := r.Get(c.buildURL("/devices/%d/vminfo", deviceID))
+	if err != nil {
+		c.log.Error("error getting vminfo", "url", r.URL, "err", err)
+		return vms, err
+	}
+	if err = c.checkResponse(r, resp); err != nil {
+		return vms, err
+	}
+	if len(obj.VMs) == 0 {
+		return vms, ErrNotFound
+	}
+	return obj.VMs, nil
+}
+
+// sensorlessHealth are the health types of the device that are not
+// sensors
+var sensorlessHealth = map[string]bool{"device_processor": true, "device_mempool": true, "device_storage": true}
+
+// GetHealthTypes returns the health types (eg. device_temperature,
+// device_state, device_storage) the device has
+func (c *Client) GetHealthTypes(deviceID int) (graphs []HealthGraph, err error) {
+	obj := HealthResponse{}
+	r := c.buildRequest().SetResult(&obj)
+	resp, err := r.Get(c.buildURL("/devices/%d/health", deviceID))
+	if err != nil {
+		c.log.Error("error getting device health", "url", r.URL, "err", err)
+		return graphs, err
+	}
+	if err = c.checkResponse(r, resp); err != nil {
+		return graphs, err
+	}
+	return obj.Graphs, nil
+}
+
+// GetSensorsForDevice returns the health sensors (temperature, fan, PSU
+// state, optic levels...) of the device.  State sensors come with their
+// state translation.  If there are none an ErrNotFound is returned
+func (c *Client) GetSensorsForDevice(id int) (sensors []Sensor, err error) {
+	types, err := c.GetHealthTypes(id)
+	if err != nil {
+		return sensors, err
+	}
+	for _, healthType := range types {
+		if !strings.HasPrefix(healthType.Name, "device_") || sensorlessHealth[healthType.Name] {
+			continue
+		}
+		graphs, err := c.GetHealth(id, healthType.Name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return sensors, err
+		}
+		for _, graph := range graphs {
+			obj := sensorHealthResponse{}
+			r := c.buildRequest().SetResult(&obj)
+			resp, err := r.Get(c.buildURL("/devices/%d/health/%s/%d", id, healthType.Name, graph.SensorID))
+			if err != nil {
+				c.log.Error("error getting health sensor", "url", r.URL, "err", err)
+				return sensors, err
+			}
+			if err = c.checkResponse(r, resp); err != nil {
+				return sensors, err
+			}
+			sensors = append(sensors, obj.Graphs...)
+		}
+	}
+	if len(sensors) == 0 {
+		return sensors, ErrNotFound
+	}
+	return sensors, nil
+}
+
+// GetInventory returns all the ENTITY-MIB inventory of the device.  If
+// there is none an ErrNotFound is returned
+func (c *Client) GetInventory(deviceID int) (entries []InventoryEntry, err error) {
+	obj := &InventoryResponse{}
+	r := c.buildRequest().SetResult(obj)
+	resp, err := r.Get(c.buildURL("/inventory/%d/all", deviceID))
+	if err != nil {
+		c.log.Error("error getting inventory", "url", r.URL, "err", err)
+		return entries, err
+	}
+	if err = c.checkResponse(r, resp); err != nil {
+		return entries, err
+	}
+	if len(obj.Inventory) == 0 {
+		return entries, ErrNotFound
+	}
+	return obj.Inventory, nil
+}
+
+// GetLocations returns all the LibreNMS locations
+func (c *Client) GetLocations() (locations []Location, err error) {
+	obj := &LocationResponse{}
+	r := c.buildRequest().SetResult(obj)
+	resp, err := r.Get(c.buildURL("/resources/locations"))
+	if err != nil {
+		c.log.Error("error getting locations", "url", r.URL, "err", err)
+		return locations, err
+	}
+	if err = c.checkResponse(r, resp); err != nil {
+		return locations, err
+	}
+	return obj.Locations, nil
+}
+
+// AddLocation creates the location and returns its ID.  LibreNMS only
+// gives the ID in the message ("Location added with id #12"), so 0 is
+// returned when the message does not have it.
+func (c *Client) AddLocation(location Location) (id int, err error) {
+	obj := LibreErrorResponse{}
+	r := c.buildRequest().SetBody(location).SetResult(&obj)
+	resp, err := r.Post(c.buildURL("/locations"))
+	if err != nil {
+		c.log.Error("error adding location", "url", r.URL, "err", err)
+		return id, err
+	}
+	if err = c.checkResponse(r, resp); err != nil {
+		return id, err
+	}
+	if m := locationIDPattern.FindStringSubmatch(obj.Message); m != nil {
+		id, _ = strconv.Atoi(m[1])
+	}
+	return id, nil
+}
+
+// UpdateLocation sets the coordinates of the named location and fixes
+// them so LibreNMS does not geocode it
+func (c *Client) UpdateLocation(name string, lat float64, lng float64) error {
+	body := map[string]interface{}{"lat": lat, "lng": lng, "fixed_coordinates": 1}
+	r := c.buildRequest().SetBody(body)
+	resp, err := r.Patch(c.buildURL("/locations/%s", url.PathEscape(name)))
+	if err != nil {
+		c.log.Error("error updating location", "url", r.URL, "err", err)
+		return err
+	}
+	return c.checkResponse(r, resp)
+}
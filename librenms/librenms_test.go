@@ -0,0 +1,174 @@
+package librenms
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/slog"
+)
+
+// newTestClient returns a client for a server that answers each path
+// with the testdata file.  Like LibreNMS, only the requested columns of
+// the port search are returned.
+func newTestClient(t *testing.T, files map[string]string) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if columns := r.URL.Query().Get("columns"); columns != "" {
+			data = selectColumns(t, data, strings.Split(columns, ","))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return NewClient(srv.URL, "token", slog.Default())
+}
+
+// selectColumns drops the port fields that were not requested
+func selectColumns(t *testing.T, data []byte, columns []string) []byte {
+	var resp map[string]any
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	ports, _ := resp["ports"].([]any)
+	for i, p := range ports {
+		port := p.(map[string]any)
+		selected := make(map[string]any)
+		for _, column := range columns {
+			if value, ok := port[column]; ok {
+				selected[column] = value
+			}
+		}
+		ports[i] = selected
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestGetPortsForDevice(t *testing.T) {
+	c := newTestClient(t, map[string]string{
+		"/api/v0/ports/search/device_id/42": "testdata/ports_search.json",
+	})
+	ports, err := c.GetPortsForDevice(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"Gi1/0/1": 1201, "Te1/1/1": 1248, "Vl20": 1260}
+	if len(ports) != len(want) {
+		t.Fatalf("got %d ports, want %d", len(ports), len(want))
+	}
+	for _, port := range ports {
+		if port.PortID != want[port.IfName] {
+			t.Errorf("port %s has port_id %d, want %d", port.IfName, port.PortID, want[port.IfName])
+		}
+	}
+	if !ports[1].IsTrunk() || ports[0].IsTrunk() {
+		t.Errorf("trunk ports not decoded: %v %v", ports[0].IfTrunk, ports[1].IfTrunk)
+	}
+}
+
+func TestDeviceIPsResolveToPorts(t *testing.T) {
+	c := newTestClient(t, map[string]string{
+		"/api/v0/ports/search/device_id/42": "testdata/ports_search.json",
+		"/api/v0/devices/42/ip":             "testdata/ip_addresses.json",
+	})
+	ports, err := c.GetPortsForDevice(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ips, err := c.GetDeviceIPs(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[int]string)
+	for _, port := range ports {
+		names[port.PortID] = port.IfName
+	}
+	for _, ip := range ips {
+		if names[ip.PortID] != "Vl20" {
+			t.Errorf("%s resolved to port %q, want Vl20", ip.Address(), names[ip.PortID])
+		}
+	}
+}
+
+func TestFDBResolvesToPorts(t *testing.T) {
+	c := newTestClient(t, map[string]string{
+		"/api/v0/ports/search/device_id/42": "testdata/ports_search.json",
+		"/api/v0/devices/42/fdb":            "testdata/fdb.json",
+	})
+	ports, err := c.GetPortsForDevice(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fdb, err := c.GetFDBForDevice(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fdb) != 2 {
+		t.Fatalf("got %d entries for device 42, want 2", len(fdb))
+	}
+	names := make(map[int]string)
+	for _, port := range ports {
+		names[port.PortID] = port.IfName
+	}
+	want := map[string]string{"A4:BB:6D:3C:0F:12": "Gi1/0/1", "00:11:22:33:44:55": "Te1/1/1"}
+	for _, entry := range fdb {
+		mac := FormatMAC(entry.MacAddress)
+		if names[entry.PortID] != want[mac] {
+			t.Errorf("%s resolved to port %q, want %q", mac, names[entry.PortID], want[mac])
+		}
+	}
+}
+
+func TestGetSensorsForDevice(t *testing.T) {
+	c := newTestClient(t, map[string]string{
+		"/api/v0/devices/42/health":                        "testdata/health_types.json",
+		"/api/v0/devices/42/health/device_state":           "testdata/health_state_list.json",
+		"/api/v0/devices/42/health/device_state/311":       "testdata/health_state.json",
+		"/api/v0/devices/42/health/device_temperature":     "testdata/health_temperature_list.json",
+		"/api/v0/devices/42/health/device_temperature/120": "testdata/health_temperature.json",
+	})
+	sensors, err := c.GetSensorsForDevice(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sensors) != 2 {
+		t.Fatalf("got %d sensors, want 2", len(sensors))
+	}
+	if psu := sensors[0]; psu.StateDescr != "critical" || psu.Status() != SensorCritical {
+		t.Errorf("got %s (%s), want critical", psu.StateDescr, psu.Status())
+	}
+	if temp := sensors[1]; temp.SensorClass != "temperature" || temp.Value() != 31 || temp.Status() != SensorOK {
+		t.Errorf("got %+v, want temperature 31", temp)
+	}
+	if _, err = c.GetSensorsForDevice(43); err == nil {
+		t.Error("got no error for a device without health")
+	}
+}
+
+func TestAddLocation(t *testing.T) {
+	c := newTestClient(t, map[string]string{"/api/v0/locations": "testdata/add_location.json"})
+	lat, lng := 45.5, -73.6
+	id, err := c.AddLocation(Location{Location: "HQ", Lat: &lat, Lng: &lng, FixedCoordinates: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 12 {
+		t.Errorf("id = %d, want 12", id)
+	}
+}
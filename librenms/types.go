@@ -1,12 +1,39 @@
 package librenms
 
-import "strings"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 const (
 	AlertFiring  = 1
 	AlertCleared = 0
 )
 
+// NewDevice is the request to add a device.  Empty fields use the
+// LibreNMS defaults.  Os is only used when SNMPDisable adds a ping only
+// device.
+type NewDevice struct {
+	Hostname     string `json:"hostname"`
+	Display      string `json:"display,omitempty"`
+	Port         int    `json:"port,omitempty"`
+	Transport    string `json:"transport,omitempty"`
+	SNMPVersion  string `json:"version,omitempty"`
+	Community    string `json:"community,omitempty"`
+	AuthLevel    string `json:"authlevel,omitempty"`
+	AuthName     string `json:"authname,omitempty"`
+	AuthPass     string `json:"authpass,omitempty"`
+	AuthAlgo     string `json:"authalgo,omitempty"`
+	CryptoPass   string `json:"cryptopass,omitempty"`
+	CryptoAlgo   string `json:"cryptoalgo,omitempty"`
+	PollerGroup  int    `json:"poller_group,omitempty"`
+	ForceAdd     bool   `json:"force_add,omitempty"`
+	SNMPDisable  bool   `json:"snmp_disable,omitempty"`
+	Os           string `json:"os,omitempty"`
+	PingFallback bool   `json:"ping_fallback"`
+}
+
 type AddDeviceResponse struct {
 	Devices []struct {
 		DeviceID int         `json:"device_id"`
@@ -70,6 +97,8 @@ type LibreDevice struct {
 	MaxDepth            int         `json:"max_depth"`
 	Notes               *string     `json:"notes"`
 	Os                  string      `json:"os"`
+	OverrideSysLocation int         `json:"override_sysLocation"`
+	OverwriteIP         *string     `json:"overwrite_ip"`
 	PollerGroup         int         `json:"poller_group"`
 	Port                int         `json:"port"`
 	PortAssociationMode int         `json:"port_association_mode"`
@@ -99,19 +128,55 @@ type LibreErrorResponse struct {
 }
 
 type IP struct {
-	ContextName   string `json:"context_name"`
-	Ipv4Address   string `json:"ipv4_address"`
-	Ipv4AddressID int    `json:"ipv4_address_id"`
-	Ipv4NetworkID string `json:"ipv4_network_id"`
-	Ipv4Prefixlen int    `json:"ipv4_prefixlen"`
-	PortID        int    `json:"port_id"`
+	ContextName    string `json:"context_name"`
+	Ipv4Address    string `json:"ipv4_address"`
+	Ipv4AddressID  int    `json:"ipv4_address_id"`
+	Ipv4NetworkID  string `json:"ipv4_network_id"`
+	Ipv4Prefixlen  int    `json:"ipv4_prefixlen"`
+	Ipv6Address    string `json:"ipv6_address"`
+	Ipv6Compressed string `json:"ipv6_compressed"`
+	Ipv6Prefixlen  int    `json:"ipv6_prefixlen"`
+	PortID         int    `json:"port_id"`
+}
+
+// Address returns the IPv4 or compressed IPv6 address
+func (ip IP) Address() string {
+	if ip.Ipv4Address != "" {
+		return ip.Ipv4Address
+	}
+	return ip.Ipv6Compressed
 }
+
+// PrefixLen returns the prefix length for the address family
+func (ip IP) PrefixLen() int {
+	if ip.Ipv4Address != "" {
+		return ip.Ipv4Prefixlen
+	}
+	return ip.Ipv6Prefixlen
+}
+
+// CIDR returns the address with its prefix length (eg. 10.0.0.1/24)
+func (ip IP) CIDR() string {
+	return fmt.Sprintf("%s/%d", ip.Address(), ip.PrefixLen())
+}
+
+// IsIPv6 returns true if this is an IPv6 address
+func (ip IP) IsIPv6() bool {
+	return ip.Ipv4Address == ""
+}
+
 type IPResponse struct {
 	Count       int    `json:"count"`
 	IPAddresses []IP   `json:"ip_addresses"`
 	Status      string `json:"status"`
 }
 
+// DeviceIPResponse is returned when listing the addresses of a device
+type DeviceIPResponse struct {
+	Addresses []IP   `json:"addresses"`
+	Status    string `json:"status"`
+}
+
 type Port struct {
 	DeviceID           int     `json:"device_id"`
 	IfAdminStatus      string  `json:"ifAdminStatus"`
@@ -120,6 +185,7 @@ type Port struct {
 	IfConnectorPresent string  `json:"ifConnectorPresent"`
 	IfDescr            string  `json:"ifDescr"`
 	IfDuplex           *string `json:"ifDuplex"`
+	IfIndex            int     `json:"ifIndex"`
 	IfMtu              int     `json:"ifMtu"`
 	IfName             string  `json:"ifName"`
 	IfOperStatus       string  `json:"ifOperStatus"`
@@ -151,12 +217,23 @@ func (p Port) GetPhysAddress() string {
 	if p.IfPhysAddress != nil {
 		mac = *p.IfPhysAddress
 	}
+	return FormatMAC(mac)
+}
+
+// FormatMAC converts the bare hex MAC addresses LibreNMS stores
+// (eg. 0011223344ff) to the colon separated upper case form Netbox uses
+func FormatMAC(mac string) string {
 	if len(mac) == 12 {
 		mac = mac[0:2] + ":" + mac[2:4] + ":" + mac[4:6] + ":" + mac[6:8] + ":" + mac[8:10] + ":" + mac[10:12]
 	}
 	return strings.ToUpper(mac)
 }
 
+// IsTrunk returns true if LibreNMS has detected the port as a trunk
+func (p Port) IsTrunk() bool {
+	return p.IfTrunk != nil && *p.IfTrunk != ""
+}
+
 func (p Port) GetDuplex() string {
 	if p.IfDuplex == nil {
 		return "auto"
@@ -175,3 +252,233 @@ type PortSearchResponse struct {
 	Ports  []Port `json:"ports"`
 	Status string `json:"status"`
 }
+
+// FdbEntry is a MAC address learned on a switch port
+type FdbEntry struct {
+	PortsFdbID int    `json:"ports_fdb_id"`
+	PortID     int    `json:"port_id"`
+	DeviceID   int    `json:"device_id"`
+	MacAddress string `json:"mac_address"`
+	VlanID     int    `json:"vlan_id"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+type FdbResponse struct {
+	Count    int        `json:"count"`
+	PortsFdb []FdbEntry `json:"ports_fdb"`
+	Status   string     `json:"status"`
+}
+
+// ArpEntry maps an IP to a MAC address as seen by a router
+type ArpEntry struct {
+	PortID      int    `json:"port_id"`
+	DeviceID    int    `json:"device_id"`
+	MacAddress  string `json:"mac_address"`
+	Ipv4Address string `json:"ipv4_address"`
+	ContextName string `json:"context_name"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+type ArpResponse struct {
+	Count  int        `json:"count"`
+	Arp    []ArpEntry `json:"arp"`
+	Status string     `json:"status"`
+}
+
+// HealthGraph is a sensor listed by the device health API.  When the
+// health types of the device are listed Name is the type (eg.
+// device_temperature) and SensorID is not set.
+type HealthGraph struct {
+	SensorID int    `json:"sensor_id"`
+	Name     string `json:"name"`
+	Desc     string `json:"desc"`
+}
+
+type HealthResponse struct {
+	Status string        `json:"status"`
+	Graphs []HealthGraph `json:"graphs"`
+}
+
+// HealthSensor is a single health entry.  The fields depend on the health
+// type (eg. mempool_total for device_mempool, storage_size for
+// device_storage, sensor_current for sensors).
+type HealthSensor map[string]interface{}
+
+// Float returns the field as a number.  LibreNMS returns some numbers as
+// strings.
+func (h HealthSensor) Float(key string) float64 {
+	switch v := h[key].(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	}
+	return 0
+}
+
+// String returns the field as a string
+func (h HealthSensor) String(key string) string {
+	switch v := h[key].(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+type HealthSensorResponse struct {
+	Status string         `json:"status"`
+	Graphs []HealthSensor `json:"graphs"`
+}
+
+type sensorHealthResponse struct {
+	Status string   `json:"status"`
+	Graphs []Sensor `json:"graphs"`
+}
+
+// VMInfo is a virtual machine discovered on a hypervisor
+type VMInfo struct {
+	ID          int    `json:"id"`
+	DeviceID    int    `json:"device_id"`
+	VMType      string `json:"vm_type"`
+	VMID        int    `json:"vmwVmVMID"`
+	DisplayName string `json:"vmwVmDisplayName"`
+	GuestOS     string `json:"vmwVmGuestOS"`
+	// MemSize is in MB
+	MemSize int    `json:"vmwVmMemSize"`
+	CPUs    int    `json:"vmwVmCpus"`
+	State   string `json:"vmwVmState"`
+}
+
+type VMInfoResponse struct {
+	Count  int      `json:"count"`
+	VMs    []VMInfo `json:"vms"`
+	Status string   `json:"status"`
+}
+
+// Sensor status values
+const (
+	SensorOK       = "ok"
+	SensorWarning  = "warning"
+	SensorCritical = "critical"
+)
+
+// Sensor is a health sensor such as a temperature, fan speed, PSU state
+// or optic level
+type Sensor struct {
+	SensorID           int      `json:"sensor_id"`
+	DeviceID           int      `json:"device_id"`
+	SensorClass        string   `json:"sensor_class"`
+	SensorType         string   `json:"sensor_type"`
+	SensorDescr        string   `json:"sensor_descr"`
+	SensorCurrent      *float64 `json:"sensor_current"`
+	SensorPrev         *float64 `json:"sensor_prev"`
+	SensorLimit        *float64 `json:"sensor_limit"`
+	SensorLimitWarn    *float64 `json:"sensor_limit_warn"`
+	SensorLimitLow     *float64 `json:"sensor_limit_low"`
+	SensorLimitLowWarn *float64 `json:"sensor_limit_low_warn"`
+	// EntPhysicalIndex is the ifIndex of the port the sensor measures
+	// when EntPhysicalIndexMeasured is "ports"
+	EntPhysicalIndex         interface{} `json:"entPhysicalIndex"`
+	EntPhysicalIndexMeasured *string     `json:"entPhysicalIndex_measured"`
+	// StateDescr and StateGenericValue translate the reading of a state
+	// sensor.  The generic value is 0 ok, 1 warning, 2 critical or 3
+	// unknown.
+	StateDescr        string `json:"state_descr"`
+	StateGenericValue *int   `json:"state_generic_value"`
+}
+
+// Value returns the current reading
+func (s Sensor) Value() float64 {
+	if s.SensorCurrent == nil {
+		return 0
+	}
+	return *s.SensorCurrent
+}
+
+// Status compares the current reading with the sensor limits.  State
+// sensors have no limits so their status is from the generic value of
+// their state, and they are ok when it is not known.
+func (s Sensor) Status() string {
+	if s.SensorClass == "state" && s.StateGenericValue != nil {
+		switch *s.StateGenericValue {
+		case 1:
+			return SensorWarning
+		case 2:
+			return SensorCritical
+		}
+		return SensorOK
+	}
+	if s.SensorCurrent == nil {
+		return SensorOK
+	}
+	v := *s.SensorCurrent
+	switch {
+	case s.SensorLimit != nil && v > *s.SensorLimit,
+		s.SensorLimitLow != nil && v < *s.SensorLimitLow:
+		return SensorCritical
+	case s.SensorLimitWarn != nil && v > *s.SensorLimitWarn,
+		s.SensorLimitLowWarn != nil && v < *s.SensorLimitLowWarn:
+		return SensorWarning
+	}
+	return SensorOK
+}
+
+// PortIfIndex returns the ifIndex of the port the sensor measures, or 0
+// if it does not measure a port
+func (s Sensor) PortIfIndex() int {
+	if s.EntPhysicalIndexMeasured == nil || *s.EntPhysicalIndexMeasured != "ports" {
+		return 0
+	}
+	switch v := s.EntPhysicalIndex.(type) {
+	case float64:
+		return int(v)
+	case string:
+		i, _ := strconv.Atoi(v)
+		return i
+	}
+	return 0
+}
+
+// InventoryEntry is an ENTITY-MIB entPhysical entry (chassis, module,
+// power supply, fan, transceiver...)
+type InventoryEntry struct {
+	EntPhysicalID          int    `json:"entPhysical_id"`
+	DeviceID               int    `json:"device_id"`
+	EntPhysicalIndex       int    `json:"entPhysicalIndex"`
+	EntPhysicalDescr       string `json:"entPhysicalDescr"`
+	EntPhysicalClass       string `json:"entPhysicalClass"`
+	EntPhysicalName        string `json:"entPhysicalName"`
+	EntPhysicalModelName   string `json:"entPhysicalModelName"`
+	EntPhysicalSerialNum   string `json:"entPhysicalSerialNum"`
+	EntPhysicalMfgName     string `json:"entPhysicalMfgName"`
+	EntPhysicalHardwareRev string `json:"entPhysicalHardwareRev"`
+	EntPhysicalIsFRU       string `json:"entPhysicalIsFRU"`
+	EntPhysicalContainedIn int    `json:"entPhysicalContainedIn"`
+}
+
+type InventoryResponse struct {
+	Count     int              `json:"count"`
+	Inventory []InventoryEntry `json:"inventory"`
+	Status    string           `json:"status"`
+}
+
+// Location is a LibreNMS location with its coordinates
+type Location struct {
+	ID               int      `json:"id,omitempty"`
+	Location         string   `json:"location"`
+	Lat              *float64 `json:"lat"`
+	Lng              *float64 `json:"lng"`
+	FixedCoordinates int      `json:"fixed_coordinates"`
+}
+
+type LocationResponse struct {
+	Count     int        `json:"count"`
+	Locations []Location `json:"locations"`
+	Status    string     `json:"status"`
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error kinds.  Errors returned through the Service wrap one of these so
+// callers can tell why a command failed with errors.Is, whichever client
+// the error came from.
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrAuth        = errors.New("not authorized")
+	ErrValidation  = errors.New("invalid request")
+	ErrConflict    = errors.New("conflict")
+	ErrUnavailable = errors.New("upstream unavailable")
+)
+
+// Kinds lists the error kinds
+var Kinds = []error{ErrNotFound, ErrAuth, ErrValidation, ErrConflict, ErrUnavailable}
+
+// kindError is an error marked with its kind
+type kindError struct {
+	err  error
+	kind error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.err, e.kind} }
+
+// NewError returns a sentinel error with the message that is of kind, so
+// both errors.Is(err, sentinel) and errors.Is(err, kind) hold
+func NewError(msg string, kind error) error {
+	return WithKind(errors.New(msg), kind)
+}
+
+// WithKind marks err as being of kind.  The message is unchanged.
+func WithKind(err error, kind error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{err: err, kind: kind}
+}
+
+// StatusError is an error status returned by Netbox or LibreNMS.  It is
+// of the kind for the status.
+type StatusError struct {
+	Status  int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Status, e.Message)
+}
+
+func (e *StatusError) Unwrap() error {
+	return KindForStatus(e.Status)
+}
+
+// KindForStatus returns the kind of an HTTP error status, or nil
+func KindForStatus(status int) error {
+	switch {
+	case status == 401 || status == 403:
+		return ErrAuth
+	case status == 404:
+		return ErrNotFound
+	case status == 409:
+		return ErrConflict
+	case status == 400 || status == 422:
+		return ErrValidation
+	case status == 429 || status >= 500:
+		return ErrUnavailable
+	}
+	return nil
+}
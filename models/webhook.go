@@ -0,0 +1,115 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Webhook events
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+)
+
+// Webhook is the body Netbox posts for an object change
+type Webhook struct {
+	Event     string   `json:"event"`
+	Timestamp string   `json:"timestamp"`
+	Model     string   `json:"model"`
+	Username  string   `json:"username"`
+	RequestID string   `json:"request_id"`
+	Data      Snapshot `json:"data"`
+	Snapshots struct {
+		Prechange  Snapshot `json:"prechange"`
+		Postchange Snapshot `json:"postchange"`
+	} `json:"snapshots"`
+}
+
+// Snapshot is the serialized state of the object
+type Snapshot map[string]interface{}
+
+// ParseWebhook decodes the webhook payload
+func ParseWebhook(payload string) (hook Webhook, err error) {
+	if err = json.Unmarshal([]byte(payload), &hook); err != nil {
+		return hook, WithKind(fmt.Errorf("could not decode webhook payload: %w", err), ErrValidation)
+	}
+	return hook, nil
+}
+
+// Pre returns the object before the change.  Nil for created objects.
+func (w Webhook) Pre() Snapshot {
+	return w.Snapshots.Prechange
+}
+
+// Post returns the object after the change.  Nil for deleted objects.
+func (w Webhook) Post() Snapshot {
+	if w.Event == EventDeleted {
+		return nil
+	}
+	if w.Snapshots.Postchange != nil {
+		return w.Snapshots.Postchange
+	}
+	return w.Data
+}
+
+// ID returns the ID of the changed object
+func (w Webhook) ID() int64 {
+	return int64(w.Data.Int("id"))
+}
+
+// String returns the field as a string, or an empty string if it is
+// missing or null
+func (s Snapshot) String(key string) string {
+	if v, ok := s[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// Int returns the field as an int.  Nested objects return their id.
+func (s Snapshot) Int(key string) int {
+	switch v := s[key].(type) {
+	case float64:
+		return int(v)
+	case map[string]interface{}:
+		return Snapshot(v).Int("id")
+	}
+	return 0
+}
+
+// Value returns a choice field (eg. status) as its value.  Webhook data
+// gives choices as {"value": ..., "label": ...} while snapshots have the
+// bare value.
+func (s Snapshot) Value(key string) string {
+	switch v := s[key].(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		return Snapshot(v).String("value")
+	}
+	return ""
+}
+
+// CustomFields returns the object's custom fields
+func (s Snapshot) CustomFields() Snapshot {
+	if cf, ok := s["custom_fields"].(map[string]interface{}); ok {
+		return cf
+	}
+	return nil
+}
+
+// TagSlugs returns the slugs of the object's tags
+func (s Snapshot) TagSlugs() []string {
+	var slugs []string
+	tags, _ := s["tags"].([]interface{})
+	for _, tag := range tags {
+		switch t := tag.(type) {
+		case map[string]interface{}:
+			slugs = append(slugs, Snapshot(t).String("slug"))
+		case string:
+			slugs = append(slugs, t)
+		}
+	}
+	return slugs
+}
@@ -0,0 +1,115 @@
+package nbapi
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/rsapc/netbox"
+)
+
+const (
+	macPath         = "/dcim/mac-addresses/"
+	interfacePath   = "/dcim/interfaces/"
+	customFieldPath = "/extras/custom-fields/"
+	tagPath         = "/extras/tags/"
+)
+
+// FindMACAddress returns the MAC address object for mac
+func (c *Client) FindMACAddress(mac string) (obj MACAddress, err error) {
+	macs, err := list[MACAddress](c, macPath, "mac_address="+url.QueryEscape(mac))
+	if err != nil {
+		return obj, err
+	}
+	if len(macs) == 0 {
+		return obj, ErrNotFound
+	}
+	return macs[0], nil
+}
+
+// AddMACAddress creates an unassigned MAC address object with the
+// given custom fields
+func (c *Client) AddMACAddress(mac string, customFields map[string]interface{}) (obj MACAddress, err error) {
+	data := make(map[string]interface{})
+	data["mac_address"] = mac
+	data["custom_fields"] = customFields
+	err = c.create(macPath, data, &obj)
+	return obj, err
+}
+
+// UpdateMACAddress patches the MAC address object with the given data
+func (c *Client) UpdateMACAddress(id int, data map[string]interface{}) error {
+	return c.update(c.buildURL(macPath+"%d/", id), data)
+}
+
+// AddInterface creates an interface on the device set in intf.  Unlike
+// netbox.Client.AddInterface the created interface is returned.
+func (c *Client) AddInterface(intf netbox.InterfaceEdit) (added Interface, err error) {
+	err = c.create(interfacePath, intf, &added)
+	return added, err
+}
+
+// ListInterfaces returns the interfaces of the device
+func (c *Client) ListInterfaces(deviceID int64) ([]Interface, error) {
+	return list[Interface](c, interfacePath, fmt.Sprintf("device_id=%d", deviceID))
+}
+
+// EnsureCustomField adds the custom field to the object types if a
+// field with that name does not already exist.
+//
+//	cfType is the Netbox field type (text, date, integer...)
+//	objectTypes are full Netbox types (eg. dcim.macaddress)
+func (c *Client) EnsureCustomField(name string, label string, cfType string, objectTypes ...string) error {
+	fields, err := list[CustomField](c, customFieldPath, "name="+url.QueryEscape(name))
+	if err != nil {
+		return err
+	}
+	if len(fields) > 0 {
+		return nil
+	}
+	if len(objectTypes) == 0 {
+		return fmt.Errorf("at least 1 object type must be specified")
+	}
+	data := make(map[string]interface{})
+	data["name"] = name
+	data["label"] = label
+	data["type"] = cfType
+	data["object_types"] = objectTypes
+	data["ui_editable"] = "no"
+	c.log.Info("adding custom field", "field", name, "object_types", objectTypes)
+	return c.create(customFieldPath, data, nil)
+}
+
+// GetObjectContext returns the site, role, platform, tags and config
+// context of the device or VM
+func (c *Client) GetObjectContext(model string, id int64) (obj ObjectContext, err error) {
+	err = c.get(c.buildURL(netbox.GetPathForModel(model)+"/%d/", id), &obj)
+	return obj, err
+}
+
+// GetCustomFields returns the custom field values of the object
+func (c *Client) GetCustomFields(model string, id int64) (map[string]any, error) {
+	var obj struct {
+		CustomFields map[string]any `json:"custom_fields"`
+	}
+	err := c.get(c.buildURL(netbox.GetPathForModel(model)+"/%d/", id), &obj)
+	return obj.CustomFields, err
+}
+
+// ListMonitored returns the devices or VMs (by model) that have a
+// monitoring_id
+func (c *Client) ListMonitored(model string) ([]ObjectContext, error) {
+	return list[ObjectContext](c, netbox.GetPathForModel(model)+"/", "cf_monitoring_id__gt=0")
+}
+
+// EnsureTag adds the tag if a tag with that slug does not already exist
+func (c *Client) EnsureTag(name string, slug string) error {
+	tags, err := list[Tag](c, tagPath, "slug="+url.QueryEscape(slug))
+	if err != nil {
+		return err
+	}
+	if len(tags) > 0 {
+		return nil
+	}
+	c.log.Info("adding tag", "tag", slug)
+	return c.create(tagPath, Tag{Name: name, Slug: slug}, nil)
+}
@@ -0,0 +1,103 @@
+package nbapi
+
+import (
+	"fmt"
+	"net/url"
+)
+
+const (
+	inventoryItemPath = "/dcim/inventory-items/"
+	modulePath        = "/dcim/modules/"
+	moduleBayPath     = "/dcim/module-bays/"
+	moduleTypePath    = "/dcim/module-types/"
+)
+
+type InventoryItem struct {
+	ID           int            `json:"id"`
+	Name         string         `json:"name"`
+	PartID       string         `json:"part_id"`
+	Serial       string         `json:"serial"`
+	Description  string         `json:"description"`
+	Discovered   bool           `json:"discovered"`
+	CustomFields map[string]any `json:"custom_fields"`
+}
+
+type ModuleBay struct {
+	ID              int           `json:"id"`
+	Name            string        `json:"name"`
+	InstalledModule *NestedObject `json:"installed_module"`
+}
+
+type ModuleType struct {
+	ID    int    `json:"id"`
+	Model string `json:"model"`
+}
+
+type Module struct {
+	ID           int            `json:"id"`
+	ModuleBay    *NestedObject  `json:"module_bay"`
+	ModuleType   *ModuleType    `json:"module_type"`
+	Serial       string         `json:"serial"`
+	Status       LabelValue     `json:"status"`
+	CustomFields map[string]any `json:"custom_fields"`
+}
+
+// ListInventoryItems returns the inventory items of the device
+func (c *Client) ListInventoryItems(deviceID int64) ([]InventoryItem, error) {
+	return list[InventoryItem](c, inventoryItemPath, fmt.Sprintf("device_id=%d", deviceID))
+}
+
+// AddInventoryItem creates an inventory item from data
+func (c *Client) AddInventoryItem(data map[string]interface{}) (item InventoryItem, err error) {
+	err = c.create(inventoryItemPath, data, &item)
+	return item, err
+}
+
+// UpdateInventoryItem patches the inventory item with the given data
+func (c *Client) UpdateInventoryItem(id int, data map[string]interface{}) error {
+	return c.update(c.buildURL(inventoryItemPath+"%d/", id), data)
+}
+
+// DeleteInventoryItem removes the inventory item
+func (c *Client) DeleteInventoryItem(id int) error {
+	return c.delete(c.buildURL(inventoryItemPath+"%d/", id))
+}
+
+// ListModuleBays returns the module bays of the device
+func (c *Client) ListModuleBays(deviceID int64) ([]ModuleBay, error) {
+	return list[ModuleBay](c, moduleBayPath, fmt.Sprintf("device_id=%d", deviceID))
+}
+
+// ListModules returns the modules installed in the device
+func (c *Client) ListModules(deviceID int64) ([]Module, error) {
+	return list[Module](c, modulePath, fmt.Sprintf("device_id=%d", deviceID))
+}
+
+// FindModuleType returns the module type with the given model (part
+// number)
+func (c *Client) FindModuleType(model string) (mt ModuleType, err error) {
+	types, err := list[ModuleType](c, moduleTypePath, "model="+url.QueryEscape(model))
+	if err != nil {
+		return mt, err
+	}
+	if len(types) == 0 {
+		return mt, ErrNotFound
+	}
+	return types[0], nil
+}
+
+// AddModule installs a module from data
+func (c *Client) AddModule(data map[string]interface{}) (m Module, err error) {
+	err = c.create(modulePath, data, &m)
+	return m, err
+}
+
+// UpdateModule patches the module with the given data
+func (c *Client) UpdateModule(id int, data map[string]interface{}) error {
+	return c.update(c.buildURL(modulePath+"%d/", id), data)
+}
+
+// DeleteModule removes the module
+func (c *Client) DeleteModule(id int) error {
+	return c.delete(c.buildURL(modulePath+"%d/", id))
+}
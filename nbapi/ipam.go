@@ -0,0 +1,108 @@
+package nbapi
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/rsapc/netbox"
+)
+
+const (
+	vrfPath    = "/ipam/vrfs/"
+	ipPath     = "/ipam/ip-addresses/"
+	prefixPath = "/ipam/prefixes/"
+)
+
+// InterfaceObjectType returns the Netbox content type of the interfaces
+// belonging to the given model (device or virtualmachine)
+func InterfaceObjectType(model string) string {
+	if model == "virtualmachine" {
+		return "virtualization.vminterface"
+	}
+	return "dcim.interface"
+}
+
+// GetVRF looks up the VRF by name
+func (c *Client) GetVRF(name string) (vrf VRF, err error) {
+	vrfs, err := list[VRF](c, vrfPath, "name="+url.QueryEscape(name))
+	if err != nil {
+		return vrf, err
+	}
+	switch len(vrfs) {
+	case 0:
+		return vrf, ErrNotFound
+	case 1:
+		return vrfs[0], nil
+	}
+	return vrf, fmt.Errorf("too many VRFs found named %s", name)
+}
+
+// FindIPAddresses searches for the address (without a mask) in the given
+// VRF.  A vrfID of 0 searches the global table.
+func (c *Client) FindIPAddresses(address string, vrfID int) ([]IPAddress, error) {
+	vrf := "vrf_id=null"
+	if vrfID != 0 {
+		vrf = fmt.Sprintf("vrf_id=%d", vrfID)
+	}
+	return list[IPAddress](c, ipPath, "address="+url.QueryEscape(address), vrf)
+}
+
+// AddIPAddress creates the address (in CIDR notation) and assigns it to the
+// interface.  A vrfID of 0 creates the address in the global table.
+func (c *Client) AddIPAddress(cidr string, vrfID int, objectType string, intfID int) (ip IPAddress, err error) {
+	data := make(map[string]interface{})
+	data["address"] = cidr
+	data["status"] = "active"
+	data["assigned_object_type"] = objectType
+	data["assigned_object_id"] = intfID
+	if vrfID != 0 {
+		data["vrf"] = vrfID
+	}
+	err = c.create(ipPath, data, &ip)
+	return ip, err
+}
+
+// UpdateIPAddress patches the IP address with the given data
+func (c *Client) UpdateIPAddress(id int, data map[string]interface{}) error {
+	return c.update(c.buildURL(ipPath+"%d/", id), data)
+}
+
+// GetIPAddress returns the IP address with the given ID
+func (c *Client) GetIPAddress(id int) (ip IPAddress, err error) {
+	err = c.get(c.buildURL(ipPath+"%d/", id), &ip)
+	return ip, err
+}
+
+// GetPrimaryIPs returns the primary_ip4 and primary_ip6 of the device or VM
+func (c *Client) GetPrimaryIPs(model string, id int64) (ips PrimaryIPs, err error) {
+	err = c.get(c.buildURL(netbox.GetPathForModel(model)+"/%d/", id), &ips)
+	return ips, err
+}
+
+// ListIPAddresses returns all IP addresses matching the args.  Args
+// should be specified as key=value (eg. parent=10.0.0.0/24)
+func (c *Client) ListIPAddresses(args ...string) ([]IPAddress, error) {
+	return list[IPAddress](c, ipPath, args...)
+}
+
+// ListPrefixes returns all prefixes matching the args.  Args should
+// be specified as key=value (eg. status=active)
+func (c *Client) ListPrefixes(args ...string) ([]Prefix, error) {
+	return list[Prefix](c, prefixPath, args...)
+}
+
+// AddPrefix creates the prefix with the given status.  A vrfID of 0
+// creates the prefix in the global table.
+func (c *Client) AddPrefix(prefix string, vrfID int, status string, description string) (p Prefix, err error) {
+	data := make(map[string]interface{})
+	data["prefix"] = prefix
+	data["status"] = status
+	if description != "" {
+		data["description"] = description
+	}
+	if vrfID != 0 {
+		data["vrf"] = vrfID
+	}
+	err = c.create(prefixPath, data, &p)
+	return p, err
+}
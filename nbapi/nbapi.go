@@ -0,0 +1,160 @@
+// Package nbapi covers the Netbox endpoints hookcmd needs that are not
+// provided by github.com/rsapc/netbox.
+package nbapi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rsapc/hookcmd/models"
+	"golang.org/x/exp/slog"
+)
+
+var ErrNotFound = models.NewError("the requested object was not found", models.ErrNotFound)
+
+type Client struct {
+	client  *resty.Client
+	log     models.Logger
+	baseURL string
+	token   string
+}
+
+// NewClient creates a new Netbox API client
+func NewClient(url string, token string, logger models.Logger) *Client {
+	c := &Client{log: logger}
+	c.client = resty.New()
+	c.client.SetRedirectPolicy(resty.FlexibleRedirectPolicy(5))
+
+	c.baseURL = fmt.Sprintf("%s/api", url)
+	c.token = token
+	if log, ok := logger.(*slog.Logger); ok {
+		c.log = log.With("service", "nbapi")
+	}
+
+	return c
+}
+
+func (c *Client) buildRequest() *resty.Request {
+	return c.client.NewRequest().SetAuthScheme("Token").SetAuthToken(c.token)
+}
+
+func (c *Client) buildURL(path string, args ...any) string {
+	urlPath := fmt.Sprintf(path, args...)
+	return fmt.Sprintf("%s%s", c.baseURL, urlPath)
+}
+
+// BaseURL returns the Netbox URL without the /api suffix.  Used to
+// build links to objects in the UI.
+func (c *Client) BaseURL() string {
+	return strings.TrimSuffix(c.baseURL, "/api")
+}
+
+// GetStatus returns the Netbox version and status
+func (c *Client) GetStatus() (status Status, err error) {
+	err = c.get(c.buildURL("/status/"), &status)
+	return status, err
+}
+
+// page is a single page of a Netbox list response
+type page[T any] struct {
+	Count    int     `json:"count"`
+	Next     *string `json:"next"`
+	Previous *string `json:"previous"`
+	Results  []T     `json:"results"`
+}
+
+// list retrieves all pages of the given path.  Args should be specified
+// as key=value (eg. vrf_id=1)
+func list[T any](c *Client, path string, args ...string) (results []T, err error) {
+	url := c.buildURL(path)
+	if len(args) > 0 {
+		url = fmt.Sprintf("%s?%s", url, strings.Join(args, "&"))
+	}
+	next := &url
+	for next != nil {
+		obj := &page[T]{}
+		r := c.buildRequest().SetResult(obj)
+		resp, err := r.Get(*next)
+		if err != nil {
+			c.log.Error("error communicating with netbox", "method", "GET", "url", *next, "error", err)
+			return results, err
+		}
+		if err = checkStatus(resp); err != nil {
+			c.log.Error("netbox returned an error response", "method", "GET", "url", *next, "status", resp.StatusCode())
+			return results, err
+		}
+		results = append(results, obj.Results...)
+		next = obj.Next
+	}
+	return results, nil
+}
+
+// get retrieves a single object from the given URL into result
+func (c *Client) get(url string, result any) error {
+	r := c.buildRequest().SetResult(result)
+	resp, err := r.Get(url)
+	if err != nil {
+		c.log.Error("error communicating with netbox", "method", "GET", "url", url, "error", err)
+		return err
+	}
+	return checkStatus(resp)
+}
+
+// create posts body to path.  The created object is decoded into result
+// when it is not nil.
+func (c *Client) create(path string, body any, result any) error {
+	r := c.buildRequest().SetBody(body)
+	if result != nil {
+		r.SetResult(result)
+	}
+	resp, err := r.Post(c.buildURL(path))
+	if err != nil {
+		c.log.Error("error communicating with netbox", "method", "POST", "url", r.URL, "error", err)
+		return err
+	}
+	if err = checkStatus(resp); err != nil {
+		c.log.Error("netbox returned an error response", "method", "POST", "url", r.URL, "error", err)
+		return err
+	}
+	return nil
+}
+
+// update patches the object at url with body
+func (c *Client) update(url string, body any) error {
+	r := c.buildRequest().SetBody(body)
+	resp, err := r.Patch(url)
+	if err != nil {
+		c.log.Error("error communicating with netbox", "method", "PATCH", "url", url, "error", err)
+		return err
+	}
+	if err = checkStatus(resp); err != nil {
+		c.log.Error("netbox returned an error response", "method", "PATCH", "url", url, "error", err)
+		return err
+	}
+	return nil
+}
+
+// delete removes the object at url
+func (c *Client) delete(url string) error {
+	resp, err := c.buildRequest().Delete(url)
+	if err != nil {
+		c.log.Error("error communicating with netbox", "method", "DELETE", "url", url, "error", err)
+		return err
+	}
+	if err = checkStatus(resp); err != nil {
+		c.log.Error("netbox returned an error response", "method", "DELETE", "url", url, "error", err)
+		return err
+	}
+	return nil
+}
+
+func checkStatus(resp *resty.Response) error {
+	if resp.StatusCode() == 404 {
+		return ErrNotFound
+	}
+	if resp.IsError() {
+		return fmt.Errorf("invalid response to %s %s: %w", resp.Request.Method, resp.Request.URL, &models.StatusError{Status: resp.StatusCode(), Message: string(resp.Body())})
+	}
+	return nil
+}
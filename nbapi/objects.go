@@ -0,0 +1,75 @@
+package nbapi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rsapc/netbox"
+)
+
+// modelPaths are the models hookcmd changes that netbox.GetPathForModel
+// does not know
+var modelPaths = map[string]string{
+	"inventoryitem": inventoryItemPath,
+	"module":        modulePath,
+	"macaddress":    macPath,
+	"prefix":        prefixPath,
+}
+
+// ModelPath returns the API path (with a trailing /) of the model
+func ModelPath(model string) (string, error) {
+	if path, ok := modelPaths[model]; ok {
+		return path, nil
+	}
+	if path := netbox.GetPathForModel(model); path != "" {
+		return path + "/", nil
+	}
+	return "", fmt.Errorf("could not determine the path for model %s", model)
+}
+
+// ObjectType returns the Netbox object type of the model, eg. dcim.device
+func ObjectType(model string) string {
+	path, err := ModelPath(model)
+	if err != nil {
+		return model
+	}
+	app, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return app + "." + model
+}
+
+// ObjectURL returns the link to the object in the Netbox UI
+func (c *Client) ObjectURL(model string, id int64) string {
+	path, err := ModelPath(model)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s%s%d/", c.BaseURL(), path, id)
+}
+
+// GetObject returns the object as decoded JSON
+func (c *Client) GetObject(model string, id int64) (obj map[string]any, err error) {
+	path, err := ModelPath(model)
+	if err != nil {
+		return obj, err
+	}
+	err = c.get(c.buildURL(path+"%d/", id), &obj)
+	return obj, err
+}
+
+// UpdateObject patches the object with the given data
+func (c *Client) UpdateObject(model string, id int64, data map[string]interface{}) error {
+	path, err := ModelPath(model)
+	if err != nil {
+		return err
+	}
+	return c.update(c.buildURL(path+"%d/", id), data)
+}
+
+// DeleteObject removes the object
+func (c *Client) DeleteObject(model string, id int64) error {
+	path, err := ModelPath(model)
+	if err != nil {
+		return err
+	}
+	return c.delete(c.buildURL(path+"%d/", id))
+}
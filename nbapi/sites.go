@@ -0,0 +1,17 @@
+package nbapi
+
+const sitePath = "/dcim/sites/"
+
+type Site struct {
+	ID              int      `json:"id"`
+	Name            string   `json:"name"`
+	Slug            string   `json:"slug"`
+	PhysicalAddress string   `json:"physical_address"`
+	Latitude        *float64 `json:"latitude"`
+	Longitude       *float64 `json:"longitude"`
+}
+
+// ListSites returns all the Netbox sites
+func (c *Client) ListSites() ([]Site, error) {
+	return list[Site](c, sitePath)
+}
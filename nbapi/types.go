@@ -0,0 +1,220 @@
+package nbapi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NestedObject is the brief representation Netbox uses when an
+// object is referenced from another object
+type NestedObject struct {
+	Display string `json:"display"`
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+}
+
+type LabelValue struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+type Tag struct {
+	ID   int    `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+	Slug string `json:"slug"`
+}
+
+type VRF struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	RD   string `json:"rd"`
+	URL  string `json:"url"`
+}
+
+type IPAddress struct {
+	ID                 int            `json:"id"`
+	URL                string         `json:"url"`
+	Address            string         `json:"address"`
+	Vrf                *NestedObject  `json:"vrf"`
+	Status             LabelValue     `json:"status"`
+	DNSName            string         `json:"dns_name"`
+	Description        string         `json:"description"`
+	AssignedObjectType *string        `json:"assigned_object_type"`
+	AssignedObjectID   *int           `json:"assigned_object_id"`
+	AssignedObject     *AssignedIntf  `json:"assigned_object"`
+	Tags               []Tag          `json:"tags"`
+	CustomFields       map[string]any `json:"custom_fields"`
+}
+
+// AssignedIntf is the interface an IP address is assigned to
+type AssignedIntf struct {
+	ID             int           `json:"id"`
+	Name           string        `json:"name"`
+	URL            string        `json:"url"`
+	Device         *NestedObject `json:"device"`
+	VirtualMachine *NestedObject `json:"virtual_machine"`
+}
+
+// Owner returns the name of the device or VM the interface belongs to
+func (a *AssignedIntf) Owner() string {
+	if a.Device != nil {
+		return a.Device.Name
+	}
+	if a.VirtualMachine != nil {
+		return a.VirtualMachine.Name
+	}
+	return ""
+}
+
+// String describes the assignment as owner:interface
+func (a *AssignedIntf) String() string {
+	return fmt.Sprintf("%s:%s", a.Owner(), a.Name)
+}
+
+// PrimaryIPs holds the primary addresses of a device or VM
+type PrimaryIPs struct {
+	PrimaryIP4 *NestedObject `json:"primary_ip4"`
+	PrimaryIP6 *NestedObject `json:"primary_ip6"`
+}
+
+type Prefix struct {
+	ID          int           `json:"id"`
+	URL         string        `json:"url"`
+	Prefix      string        `json:"prefix"`
+	Vrf         *NestedObject `json:"vrf"`
+	Status      LabelValue    `json:"status"`
+	Description string        `json:"description"`
+}
+
+// VRFName returns the name of the prefix VRF or an empty string
+// for the global table
+func (p Prefix) VRFName() string {
+	if p.Vrf == nil {
+		return ""
+	}
+	return p.Vrf.Name
+}
+
+// VRFName returns the name of the address VRF or an empty string
+// for the global table
+func (ip IPAddress) VRFName() string {
+	if ip.Vrf == nil {
+		return ""
+	}
+	return ip.Vrf.Name
+}
+
+// MACAddress is a Netbox (4.2+) MAC address object
+type MACAddress struct {
+	ID                 int            `json:"id"`
+	URL                string         `json:"url"`
+	MacAddress         string         `json:"mac_address"`
+	AssignedObjectType *string        `json:"assigned_object_type"`
+	AssignedObjectID   *int           `json:"assigned_object_id"`
+	Description        string         `json:"description"`
+	CustomFields       map[string]any `json:"custom_fields"`
+}
+
+// Interface is a device interface with its custom fields
+type Interface struct {
+	ID           int            `json:"id"`
+	Name         string         `json:"name"`
+	CustomFields map[string]any `json:"custom_fields"`
+}
+
+type CustomField struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Label string `json:"label"`
+}
+
+// ObjectContext is the part of a device or VM used to select settings
+// for it
+type ObjectContext struct {
+	ID            int            `json:"id"`
+	Name          string         `json:"name"`
+	Site          *NestedSlug    `json:"site"`
+	Location      *NestedSlug    `json:"location"`
+	Role          *NestedSlug    `json:"role"`
+	DeviceRole    *NestedSlug    `json:"device_role"`
+	Platform      *NestedSlug    `json:"platform"`
+	Tags          []Tag          `json:"tags"`
+	ConfigContext map[string]any `json:"config_context"`
+	CustomFields  map[string]any `json:"custom_fields"`
+}
+
+// MonitoringID returns the monitoring_id custom field or 0 if it is not
+// set
+func (o ObjectContext) MonitoringID() int {
+	id, _ := o.CustomFields["monitoring_id"].(float64)
+	return int(id)
+}
+
+// HasTag returns true if the object is tagged with slug
+func (o ObjectContext) HasTag(slug string) bool {
+	for _, tag := range o.Tags {
+		if tag.Slug == slug {
+			return true
+		}
+	}
+	return false
+}
+
+type NestedSlug struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// RoleSlug returns the role slug.  Netbox 3.x devices use device_role.
+func (o ObjectContext) RoleSlug() string {
+	if o.Role != nil {
+		return o.Role.Slug
+	}
+	if o.DeviceRole != nil {
+		return o.DeviceRole.Slug
+	}
+	return ""
+}
+
+// TagSlugs returns the slugs of the object tags
+func (o ObjectContext) TagSlugs() []string {
+	var slugs []string
+	for _, tag := range o.Tags {
+		slugs = append(slugs, tag.Slug)
+	}
+	return slugs
+}
+
+func slugOf(n *NestedSlug) string {
+	if n == nil {
+		return ""
+	}
+	return n.Slug
+}
+
+// SiteSlug returns the site slug or an empty string
+func (o ObjectContext) SiteSlug() string {
+	return slugOf(o.Site)
+}
+
+// PlatformSlug returns the platform slug or an empty string
+func (o ObjectContext) PlatformSlug() string {
+	return slugOf(o.Platform)
+}
+
+// Status is the part of /api/status/ hookcmd uses
+type Status struct {
+	NetboxVersion string `json:"netbox-version"`
+}
+
+// AtLeast returns true if the Netbox version is major.minor or later.
+// An unknown version is treated as current.
+func (s Status) AtLeast(major, minor int) bool {
+	var maj, min int
+	if n, _ := fmt.Sscanf(strings.TrimPrefix(s.NetboxVersion, "v"), "%d.%d", &maj, &min); n < 2 {
+		return true
+	}
+	return maj > major || maj == major && min >= minor
+}
@@ -0,0 +1,76 @@
+package nbapi
+
+import (
+	"net/url"
+)
+
+const (
+	vmPath          = "/virtualization/virtual-machines/"
+	vmInterfacePath = "/virtualization/interfaces/"
+	devicePath      = "/dcim/devices/"
+)
+
+// VirtualMachine holds the VM fields hookcmd syncs
+type VirtualMachine struct {
+	ID           int            `json:"id"`
+	Name         string         `json:"name"`
+	Cluster      *NestedObject  `json:"cluster"`
+	Device       *NestedObject  `json:"device"`
+	VCPUs        *float64       `json:"vcpus"`
+	Memory       *int           `json:"memory"`
+	Disk         *int           `json:"disk"`
+	CustomFields map[string]any `json:"custom_fields"`
+}
+
+// Monitored returns true if the VM has a monitoring_id
+func (vm VirtualMachine) Monitored() bool {
+	id, ok := vm.CustomFields["monitoring_id"].(float64)
+	return ok && id > 0
+}
+
+// VMInterfaceEdit is the body used to add or update a VM interface.  VM
+// interfaces have no type, speed or duplex.
+type VMInterfaceEdit struct {
+	VirtualMachine int     `json:"virtual_machine,omitempty"`
+	Name           string  `json:"name,omitempty"`
+	Description    *string `json:"description,omitempty"`
+	MacAddress     string  `json:"mac_address,omitempty"`
+	Parent         int     `json:"parent,omitempty"`
+}
+
+// GetVirtualMachine returns the VM with the given ID
+func (c *Client) GetVirtualMachine(id int64) (vm VirtualMachine, err error) {
+	err = c.get(c.buildURL(vmPath+"%d/", id), &vm)
+	return vm, err
+}
+
+// FindVirtualMachines returns the VMs with the given name
+func (c *Client) FindVirtualMachines(name string) ([]VirtualMachine, error) {
+	return list[VirtualMachine](c, vmPath, "name="+url.QueryEscape(name))
+}
+
+// UpdateVirtualMachine patches the VM with the given data
+func (c *Client) UpdateVirtualMachine(id int64, data map[string]interface{}) error {
+	return c.update(c.buildURL(vmPath+"%d/", id), data)
+}
+
+// AddVMInterface creates an interface on a VM
+func (c *Client) AddVMInterface(intf VMInterfaceEdit) (added Interface, err error) {
+	err = c.create(vmInterfacePath, intf, &added)
+	return added, err
+}
+
+// UpdateVMInterface patches the VM interface
+func (c *Client) UpdateVMInterface(id int, intf VMInterfaceEdit) error {
+	return c.update(c.buildURL(vmInterfacePath+"%d/", id), intf)
+}
+
+// GetDeviceCluster returns the virtualization cluster a device (a
+// hypervisor) belongs to.  Nil if it is not in a cluster.
+func (c *Client) GetDeviceCluster(id int64) (*NestedObject, error) {
+	var device struct {
+		Cluster *NestedObject `json:"cluster"`
+	}
+	err := c.get(c.buildURL(devicePath+"%d/", id), &device)
+	return device.Cluster, err
+}
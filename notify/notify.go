@@ -0,0 +1,122 @@
+// Package notify sends hook results to webhooks, email, chat and syslog
+// so failures are seen without reading the Netbox journal.
+package notify
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rsapc/hookcmd/config"
+	"github.com/rsapc/hookcmd/models"
+	"golang.org/x/exp/slog"
+)
+
+// Event types
+const (
+	DeviceAdded        = "device_added"
+	DeviceOffline      = "device_offline"
+	SyncFailed         = "sync_failed"
+	UnmappedInterface  = "unmapped_interface"
+	defaultSinkTimeout = 10 * time.Second
+)
+
+// Event is a hook result worth telling someone about
+type Event struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Subject string    `json:"subject"`
+	Message string    `json:"message,omitempty"`
+	// Model and ID are the Netbox object, when known
+	Model string `json:"model,omitempty"`
+	ID    int64  `json:"id,omitempty"`
+	// DeviceID is the LibreNMS device, when known
+	DeviceID int `json:"device_id,omitempty"`
+}
+
+// Text returns the subject and message as plain text
+func (e Event) Text() string {
+	if e.Message == "" {
+		return e.Subject
+	}
+	return fmt.Sprintf("%s\n\n%s", e.Subject, e.Message)
+}
+
+// Notifier delivers an event to one destination
+type Notifier interface {
+	Notify(Event) error
+}
+
+type sink struct {
+	name     string
+	events   []string
+	notifier Notifier
+}
+
+// Dispatcher sends events to the configured sinks
+type Dispatcher struct {
+	sinks []sink
+	log   models.Logger
+}
+
+// New creates a dispatcher for the configured sinks.  Sinks with an
+// invalid config are logged and skipped.
+func New(cfg config.NotifyConfig, logger models.Logger) *Dispatcher {
+	d := &Dispatcher{log: logger}
+	if log, ok := logger.(*slog.Logger); ok {
+		d.log = log.With("service", "notify")
+	}
+	for _, sc := range cfg.Sinks {
+		n, err := newNotifier(sc)
+		if err != nil {
+			d.log.Error("invalid notification sink", "type", sc.Type, "error", err)
+			continue
+		}
+		d.sinks = append(d.sinks, sink{name: sc.Type, events: sc.Events, notifier: n})
+	}
+	return d
+}
+
+// newNotifier creates the notifier for the sink type
+func newNotifier(cfg config.SinkConfig) (Notifier, error) {
+	timeout := cfg.Timeout.Duration
+	if timeout <= 0 {
+		timeout = defaultSinkTimeout
+	}
+	switch cfg.Type {
+	case "webhook":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("webhook url is required")
+		}
+		return NewWebhook(cfg.URL, cfg.Headers, timeout), nil
+	case "slack", "teams", "mattermost":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("%s url is required", cfg.Type)
+		}
+		return NewChat(cfg.URL, timeout), nil
+	case "smtp":
+		if cfg.Server == "" || cfg.From == "" || len(cfg.To) == 0 {
+			return nil, fmt.Errorf("smtp server, from and to are required")
+		}
+		return NewSMTP(cfg.Server, cfg.Username, cfg.Password, cfg.From, cfg.To, timeout), nil
+	case "syslog":
+		return NewSyslog(cfg.Network, cfg.Server)
+	}
+	return nil, fmt.Errorf("unknown sink type %q", cfg.Type)
+}
+
+// Send delivers the event to every sink subscribed to its type.  Failures
+// are logged so a broken sink never fails the hook.
+func (d *Dispatcher) Send(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	for _, s := range d.sinks {
+		if len(s.events) > 0 && !slices.Contains(s.events, event.Type) {
+			continue
+		}
+		if err := s.notifier.Notify(event); err != nil {
+			d.log.Error("could not send notification", "sink", s.name, "event", event.Type, "error", err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rsapc/hookcmd/config"
+	"golang.org/x/exp/slog"
+)
+
+// receiver is an HTTP endpoint that records the JSON bodies posted to it
+type receiver struct {
+	mu      sync.Mutex
+	status  int
+	bodies  []map[string]any
+	headers []http.Header
+}
+
+func newReceiver(t *testing.T, status int) (*receiver, string) {
+	rcv := &receiver{status: status}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		rcv.mu.Lock()
+		rcv.bodies = append(rcv.bodies, body)
+		rcv.headers = append(rcv.headers, r.Header)
+		rcv.mu.Unlock()
+		w.WriteHeader(rcv.status)
+	}))
+	t.Cleanup(srv.Close)
+	return rcv, srv.URL
+}
+
+func TestDispatcherSend(t *testing.T) {
+	all, allURL := newReceiver(t, http.StatusOK)
+	chat, chatURL := newReceiver(t, http.StatusOK)
+	broken, brokenURL := newReceiver(t, http.StatusInternalServerError)
+	d := New(config.NotifyConfig{Sinks: []config.SinkConfig{
+		{Type: "webhook", URL: brokenURL},
+		{Type: "webhook", URL: allURL, Headers: map[string]string{"Authorization": "Bearer secret"}},
+		{Type: "slack", URL: chatURL, Events: []string{SyncFailed}},
+		// invalid sinks are skipped
+		{Type: "webhook"},
+		{Type: "pager"},
+	}}, slog.Default())
+	if len(d.sinks) != 3 {
+		t.Fatalf("got %d sinks, want 3", len(d.sinks))
+	}
+
+	when := time.Date(2024, 3, 5, 17, 10, 2, 0, time.UTC)
+	d.Send(Event{Type: DeviceAdded, Time: when, Subject: "10.0.0.5 added to LibreNMS", Model: "device", ID: 5, DeviceID: 42})
+	d.Send(Event{Type: SyncFailed, Subject: "inventory sync failed", Message: "LibreNMS is unavailable"})
+
+	if len(broken.bodies) != 2 {
+		t.Errorf("the failing sink got %d events, want 2", len(broken.bodies))
+	}
+	if len(all.bodies) != 2 {
+		t.Fatalf("the webhook got %d events, want 2", len(all.bodies))
+	}
+	added := all.bodies[0]
+	if added["type"] != DeviceAdded || added["time"] != "2024-03-05T17:10:02Z" || added["model"] != "device" || added["id"] != float64(5) || added["device_id"] != float64(42) {
+		t.Errorf("got webhook body %v", added)
+	}
+	if _, ok := all.bodies[1]["time"].(string); !ok {
+		t.Errorf("the event time was not set: %v", all.bodies[1])
+	}
+	if auth := all.headers[0].Get("Authorization"); auth != "Bearer secret" {
+		t.Errorf("got Authorization %q", auth)
+	}
+	if len(chat.bodies) != 1 || chat.bodies[0]["text"] != "inventory sync failed\n\nLibreNMS is unavailable" || len(chat.bodies[0]) != 1 {
+		t.Errorf("got chat messages %v, want only the sync failure", chat.bodies)
+	}
+}
+
+// smtpServer accepts one message without STARTTLS or auth and returns
+// the envelope and data through the channel
+func smtpServer(t *testing.T) (string, <-chan []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var lines []string
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP")
+		data := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+			switch {
+			case data && line == ".":
+				data = false
+				reply("250 queued")
+			case data:
+			case strings.HasPrefix(line, "EHLO"):
+				reply("250 localhost")
+			case line == "DATA":
+				data = true
+				reply("354 go ahead")
+			case line == "QUIT":
+				reply("221 bye")
+				received <- lines
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestSMTP(t *testing.T) {
+	addr, received := smtpServer(t)
+	m := NewSMTP(addr, "", "", "hookcmd@example.com", []string{"noc@example.com", "ops@example.com"}, time.Second)
+	event := Event{Type: DeviceOffline, Time: time.Date(2024, 3, 5, 17, 10, 2, 0, time.UTC), Subject: "sw1 is offline", Message: "no response\nsince 17:05"}
+	if err := m.Notify(event); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Join(<-received, "\n")
+	for _, want := range []string{
+		"MAIL FROM:<hookcmd@example.com>",
+		"RCPT TO:<noc@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"To: noc@example.com, ops@example.com",
+		"Subject: sw1 is offline",
+		"Date: Tue, 05 Mar 2024 17:10:02 +0000",
+		"sw1 is offline\n\nno response\nsince 17:05",
+	} {
+		if !strings.Contains(lines, want) {
+			t.Errorf("the session does not contain %q:\n%s", want, lines)
+		}
+	}
+}
+
+func TestSMTPUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	if err = NewSMTP(addr, "", "", "hookcmd@example.com", []string{"noc@example.com"}, time.Second).Notify(Event{Subject: "test"}); err == nil {
+		t.Error("got no error for a closed port")
+	}
+	if err = NewSMTP("mail.example.com", "", "", "a@example.com", []string{"b@example.com"}, time.Second).Notify(Event{Subject: "test"}); err == nil {
+		t.Error("got no error for a server without a port")
+	}
+}
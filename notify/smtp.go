@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTP emails the event.  STARTTLS is used when the server offers it
+// and is required to authenticate.
+type SMTP struct {
+	server   string
+	username string
+	password string
+	from     string
+	to       []string
+	timeout  time.Duration
+}
+
+// NewSMTP creates a notifier sending mail through server (host:port)
+func NewSMTP(server string, username string, password string, from string, to []string, timeout time.Duration) *SMTP {
+	return &SMTP{server: server, username: username, password: password, from: from, to: to, timeout: timeout}
+}
+
+func (m *SMTP) Notify(event Event) error {
+	host, _, err := net.SplitHostPort(m.server)
+	if err != nil {
+		return fmt.Errorf("invalid smtp server %s: %w", m.server, err)
+	}
+	conn, err := net.DialTimeout("tcp", m.server, m.timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(m.timeout))
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.username != "" {
+		if err = c.Auth(smtp.PlainAuth("", m.username, m.password, host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(m.from); err != nil {
+		return err
+	}
+	for _, to := range m.to {
+		if err = c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		m.from, strings.Join(m.to, ", "), event.Subject, event.Time.Format(time.RFC1123Z),
+		strings.ReplaceAll(event.Text(), "\n", "\r\n"))
+	if _, err = w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,38 @@
+//go:build !windows && !plan9
+
+package notify
+
+import (
+	"log/syslog"
+	"strings"
+)
+
+// Syslog writes the event to syslog with the daemon facility.  Offline
+// devices and failures are logged as errors, other events as notices.
+type Syslog struct {
+	network string
+	server  string
+}
+
+// NewSyslog creates a notifier for the syslog server (host:port over
+// network, udp by default) or the local syslog when server is empty
+func NewSyslog(network string, server string) (*Syslog, error) {
+	if server != "" && network == "" {
+		network = "udp"
+	}
+	return &Syslog{network: network, server: server}, nil
+}
+
+func (s *Syslog) Notify(event Event) error {
+	w, err := syslog.Dial(s.network, s.server, syslog.LOG_DAEMON|syslog.LOG_NOTICE, "hookcmd")
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	msg := event.Type + ": " + strings.ReplaceAll(event.Text(), "\n", " ")
+	switch event.Type {
+	case DeviceOffline, SyncFailed:
+		return w.Err(msg)
+	}
+	return w.Notice(msg)
+}
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package notify
+
+import "errors"
+
+// NewSyslog returns an error as syslog is not available on this platform
+func NewSyslog(network string, server string) (Notifier, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,46 @@
+//go:build !windows && !plan9
+
+package notify
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	s, err := NewSyslog("", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		event Event
+		// priority is the facility (daemon) and severity
+		priority string
+		text     string
+	}{
+		{Event{Type: SyncFailed, Subject: "inventory sync failed", Message: "LibreNMS\nis unavailable"}, "<27>", "sync_failed: inventory sync failed  LibreNMS is unavailable"},
+		{Event{Type: DeviceAdded, Subject: "10.0.0.5 added to LibreNMS"}, "<29>", "device_added: 10.0.0.5 added to LibreNMS"},
+	}
+	buf := make([]byte, 2048)
+	for _, tt := range tests {
+		if err = s.Notify(tt.event); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := string(buf[:n])
+		if !strings.HasPrefix(msg, tt.priority) || !strings.Contains(msg, "hookcmd") || !strings.HasSuffix(strings.TrimSpace(msg), tt.text) {
+			t.Errorf("got %q, want priority %s and %q", msg, tt.priority, tt.text)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Webhook posts the event as JSON
+type Webhook struct {
+	url    string
+	client *resty.Client
+}
+
+// NewWebhook creates a notifier posting to url with the extra headers
+func NewWebhook(url string, headers map[string]string, timeout time.Duration) *Webhook {
+	client := resty.New().SetTimeout(timeout).SetHeaders(headers)
+	return &Webhook{url: url, client: client}
+}
+
+func (w *Webhook) Notify(event Event) error {
+	return post(w.client, w.url, event)
+}
+
+// Chat posts the event as the {"text": ...} message accepted by Slack,
+// Mattermost and Teams incoming webhooks
+type Chat struct {
+	url    string
+	client *resty.Client
+}
+
+// NewChat creates a notifier posting to the incoming webhook url
+func NewChat(url string, timeout time.Duration) *Chat {
+	return &Chat{url: url, client: resty.New().SetTimeout(timeout)}
+}
+
+func (c *Chat) Notify(event Event) error {
+	return post(c.client, c.url, map[string]string{"text": event.Text()})
+}
+
+func post(client *resty.Client, url string, body any) error {
+	resp, err := client.R().SetHeader("Content-Type", "application/json").SetBody(body).Post(url)
+	if err != nil {
+		return err
+	}
+	if resp.IsError() {
+		return fmt.Errorf("error status returned %d: %s", resp.StatusCode(), resp.String())
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+// Package probe checks a device can be reached and answers SNMP before
+// it is added to LibreNMS.  It sends ICMP echo requests, connects to TCP
+// ports and does an SNMP GET of sysObjectID and sysName with gosnmp,
+// using the user-based security model for v3.
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const defaultTimeout = 3 * time.Second
+
+var defaultTCPPorts = []int{22, 443}
+
+// Check status values
+const (
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// Failure values
+const (
+	FailureUnreachable = "unreachable"
+	FailureTimeout     = "timeout"
+	FailureAuth        = "auth failure"
+	FailureSNMP        = "snmp error"
+)
+
+// Options are the probes to make
+type Options struct {
+	// TCPPorts are connected to as a reachability check.  A refused
+	// connection still shows the host is up.  Defaults to 22 and 443
+	TCPPorts []int
+	// NoSNMP skips the SNMP probe of a ping only device
+	NoSNMP bool
+	// SNMPVersion is v1, v2c or v3
+	SNMPVersion string
+	Community   string
+	// USM is the v3 user
+	USM USM
+	// SNMPPort defaults to 161
+	SNMPPort int
+	// Transport is udp (default), udp6, tcp or tcp6
+	Transport string
+	// Timeout for each probe.  Defaults to 3s
+	Timeout time.Duration
+}
+
+// Check is the result of a single probe
+type Check struct {
+	Name    string
+	Status  string
+	Detail  string
+	Elapsed time.Duration
+}
+
+func (c Check) String() string {
+	s := fmt.Sprintf("%s: %s", c.Name, c.Status)
+	if c.Status == StatusOK {
+		s += fmt.Sprintf(" (%s)", c.Elapsed.Round(time.Millisecond))
+	}
+	if c.Detail != "" {
+		s += " - " + c.Detail
+	}
+	return s
+}
+
+// Result is the outcome of all the probes of an address
+type Result struct {
+	Address     string
+	Checks      []Check
+	Reachable   bool
+	SysName     string
+	SysObjectID string
+	// Failure explains why the device cannot be added.  Empty when SNMP
+	// answered (or was not probed) and the host is reachable.
+	Failure string
+}
+
+// OK returns true if nothing failed
+func (r Result) OK() bool {
+	return r.Failure == ""
+}
+
+// String returns a multi-line diagnostic suitable for a journal entry
+func (r Result) String() string {
+	var b strings.Builder
+	if r.OK() {
+		fmt.Fprintf(&b, "pre-flight check of %s passed", r.Address)
+	} else {
+		fmt.Fprintf(&b, "pre-flight check of %s failed: %s", r.Address, r.Failure)
+	}
+	for _, c := range r.Checks {
+		fmt.Fprintf(&b, "\n- %s", c)
+	}
+	if r.SysName != "" || r.SysObjectID != "" {
+		fmt.Fprintf(&b, "\n\nsysName=%s sysObjectID=%s", r.SysName, r.SysObjectID)
+	}
+	return b.String()
+}
+
+// Run probes the address
+func Run(addr string, opts Options) Result {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if len(opts.TCPPorts) == 0 {
+		opts.TCPPorts = defaultTCPPorts
+	}
+	if opts.SNMPPort == 0 {
+		opts.SNMPPort = 161
+	}
+	result := Result{Address: addr}
+	ping := pingCheck(addr, opts.Timeout)
+	result.Checks = append(result.Checks, ping)
+	result.Reachable = ping.Status == StatusOK
+	for _, port := range opts.TCPPorts {
+		c := tcpCheck(addr, port, opts.Timeout)
+		result.Checks = append(result.Checks, c)
+		if c.Status == StatusOK {
+			result.Reachable = true
+		}
+	}
+
+	if opts.NoSNMP {
+		result.Checks = append(result.Checks, Check{Name: "snmp", Status: StatusSkipped, Detail: "ping only"})
+		if !result.Reachable {
+			result.Failure = FailureUnreachable
+		}
+		return result
+	}
+
+	version := opts.SNMPVersion
+	if version == "" {
+		version = "v2c"
+	}
+	c := Check{Name: "snmp " + version}
+	if opts.Transport != "" && opts.Transport != "udp" {
+		c.Name += "/" + opts.Transport
+	}
+	opts.SNMPVersion = version
+	start := time.Now()
+	values, err := snmpGet(addr, opts, OIDSysObjectID, OIDSysName)
+	c.Elapsed = time.Since(start)
+	switch {
+	case err == nil:
+		c.Status = StatusOK
+		result.Reachable = true
+		result.SysObjectID = values[OIDSysObjectID]
+		result.SysName = values[OIDSysName]
+	case errors.Is(err, ErrSNMPTimeout) && !result.Reachable:
+		c.Status = StatusFailed
+		c.Detail = err.Error()
+		result.Failure = FailureUnreachable
+	case errors.Is(err, ErrSNMPTimeout):
+		c.Status = StatusFailed
+		c.Detail = "no response; check the community and that the agent allows this host"
+		if version == "v3" {
+			c.Detail = "no response; check the user and that the agent allows this host"
+		}
+		result.Failure = FailureTimeout
+	case errors.Is(err, ErrSNMPRefused):
+		c.Status = StatusFailed
+		c.Detail = err.Error()
+		result.Reachable = true
+		result.Failure = FailureSNMP
+	case errors.Is(err, ErrSNMPAuth):
+		c.Status = StatusFailed
+		c.Detail = err.Error()
+		result.Failure = FailureAuth
+	default:
+		c.Status = StatusFailed
+		c.Detail = err.Error()
+		result.Failure = FailureSNMP
+	}
+	result.Checks = append(result.Checks, c)
+	return result
+}
+
+// tcpCheck connects to the port.  A refused connection means the host
+// answered so it is reported as ok.
+func tcpCheck(addr string, port int, timeout time.Duration) Check {
+	c := Check{Name: fmt.Sprintf("tcp/%d", port)}
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(addr, strconv.Itoa(port)), timeout)
+	c.Elapsed = time.Since(start)
+	if err == nil {
+		conn.Close()
+		c.Status = StatusOK
+		return c
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		c.Status = StatusOK
+		c.Detail = "connection refused"
+		return c
+	}
+	c.Status = StatusFailed
+	c.Detail = err.Error()
+	return c
+}
+
+// pingCheck sends an ICMP echo request using an unprivileged ICMP socket.
+// The check is skipped when the system does not permit it.
+func pingCheck(addr string, timeout time.Duration) Check {
+	c := Check{Name: "icmp"}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		c.Status = StatusFailed
+		c.Detail = "invalid address"
+		return c
+	}
+	network, listen, proto := "udp4", "0.0.0.0", 1
+	var echoType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if ip.To4() == nil {
+		network, listen, proto = "udp6", "::", 58
+		echoType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+	conn, err := icmp.ListenPacket(network, listen)
+	if err != nil {
+		c.Status = StatusSkipped
+		c.Detail = fmt.Sprintf("ICMP not permitted: %v", err)
+		return c
+	}
+	defer conn.Close()
+	msg := icmp.Message{
+		Type: echoType,
+		Body: &icmp.Echo{ID: os.Getpid() & 0xffff, Seq: 1, Data: []byte("hookcmd")},
+	}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		c.Status = StatusFailed
+		c.Detail = err.Error()
+		return c
+	}
+	start := time.Now()
+	conn.SetDeadline(start.Add(timeout))
+	if _, err = conn.WriteTo(data, &net.UDPAddr{IP: ip}); err != nil {
+		c.Status = StatusFailed
+		c.Detail = err.Error()
+		return c
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			c.Status = StatusFailed
+			c.Detail = "no echo reply"
+			return c
+		}
+		reply, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		if udp, ok := peer.(*net.UDPAddr); ok && !udp.IP.Equal(ip) {
+			continue
+		}
+		c.Elapsed = time.Since(start)
+		c.Status = StatusOK
+		return c
+	}
+}
@@ -0,0 +1,27 @@
+package probe
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRunPingOnly(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	tcpPort, _ := strconv.Atoi(port)
+
+	result := Run("127.0.0.1", Options{TCPPorts: []int{tcpPort}, NoSNMP: true, Timeout: time.Second})
+	if !result.OK() || !result.Reachable {
+		t.Fatalf("got failure %q, want ok\n%s", result.Failure, result)
+	}
+	last := result.Checks[len(result.Checks)-1]
+	if last.Name != "snmp" || last.Status != StatusSkipped {
+		t.Errorf("got %s, want snmp skipped", last)
+	}
+}
@@ -0,0 +1,208 @@
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// OIDs requested by the SNMP probe
+const (
+	OIDSysObjectID = "1.3.6.1.2.1.1.2.0"
+	OIDSysName     = "1.3.6.1.2.1.1.5.0"
+)
+
+// SNMPv3 security levels
+const (
+	NoAuthNoPriv = "noAuthNoPriv"
+	AuthNoPriv   = "authNoPriv"
+	AuthPriv     = "authPriv"
+)
+
+var (
+	ErrSNMPTimeout = errors.New("no SNMP response")
+	ErrSNMPAuth    = errors.New("SNMP request was not authorized")
+	ErrSNMPRefused = errors.New("port unreachable; no SNMP agent is listening")
+)
+
+// USM are the SNMPv3 user-based security settings
+type USM struct {
+	// Level is noAuthNoPriv, authNoPriv or authPriv.  Defaults to
+	// authPriv when a privacy password is given, else authNoPriv when an
+	// authentication password is given.
+	Level    string
+	User     string
+	AuthPass string
+	// AuthAlgo is MD5, SHA (default), SHA-224, SHA-256, SHA-384 or SHA-512
+	AuthAlgo string
+	PrivPass string
+	// PrivAlgo is DES, AES (default), AES-192 or AES-256.  AES-192C and
+	// AES-256C use the key extension of Cisco agents.
+	PrivAlgo string
+}
+
+func (u USM) level() string {
+	switch {
+	case u.Level != "":
+		return u.Level
+	case u.PrivPass != "":
+		return AuthPriv
+	case u.AuthPass != "":
+		return AuthNoPriv
+	}
+	return NoAuthNoPriv
+}
+
+// securityParameters returns the gosnmp flags and USM parameters for u
+func (u USM) securityParameters() (gosnmp.SnmpV3MsgFlags, *gosnmp.UsmSecurityParameters, error) {
+	params := &gosnmp.UsmSecurityParameters{UserName: u.User}
+	var flags gosnmp.SnmpV3MsgFlags
+	switch u.level() {
+	case NoAuthNoPriv:
+		return gosnmp.NoAuthNoPriv, params, nil
+	case AuthNoPriv:
+		flags = gosnmp.AuthNoPriv
+	case AuthPriv:
+		flags = gosnmp.AuthPriv
+	default:
+		return flags, nil, fmt.Errorf("unsupported SNMPv3 security level %s", u.Level)
+	}
+	var err error
+	if params.AuthenticationProtocol, err = authProtocol(u.AuthAlgo); err != nil {
+		return flags, nil, err
+	}
+	params.AuthenticationPassphrase = u.AuthPass
+	if flags == gosnmp.AuthPriv {
+		if params.PrivacyProtocol, err = privProtocol(u.PrivAlgo); err != nil {
+			return flags, nil, err
+		}
+		params.PrivacyPassphrase = u.PrivPass
+	}
+	return flags, params, nil
+}
+
+func authProtocol(name string) (gosnmp.SnmpV3AuthProtocol, error) {
+	switch strings.ToUpper(strings.ReplaceAll(name, "-", "")) {
+	case "MD5":
+		return gosnmp.MD5, nil
+	case "", "SHA", "SHA1":
+		return gosnmp.SHA, nil
+	case "SHA224":
+		return gosnmp.SHA224, nil
+	case "SHA256":
+		return gosnmp.SHA256, nil
+	case "SHA384":
+		return gosnmp.SHA384, nil
+	case "SHA512":
+		return gosnmp.SHA512, nil
+	}
+	return gosnmp.NoAuth, fmt.Errorf("unsupported SNMPv3 authentication algorithm %s", name)
+}
+
+func privProtocol(name string) (gosnmp.SnmpV3PrivProtocol, error) {
+	switch strings.ToUpper(strings.ReplaceAll(name, "-", "")) {
+	case "DES":
+		return gosnmp.DES, nil
+	case "", "AES", "AES128":
+		return gosnmp.AES, nil
+	case "AES192":
+		return gosnmp.AES192, nil
+	case "AES256":
+		return gosnmp.AES256, nil
+	case "AES192C":
+		return gosnmp.AES192C, nil
+	case "AES256C":
+		return gosnmp.AES256C, nil
+	}
+	return gosnmp.NoPriv, fmt.Errorf("unsupported SNMPv3 privacy algorithm %s", name)
+}
+
+// snmpGet sends an SNMP GET for the oids to addr and returns the values
+// as strings keyed by OID
+func snmpGet(addr string, opts Options, oids ...string) (map[string]string, error) {
+	client := &gosnmp.GoSNMP{
+		Target:    addr,
+		Port:      uint16(opts.SNMPPort),
+		Transport: opts.Transport,
+		Community: opts.Community,
+		Timeout:   opts.Timeout,
+		Retries:   0,
+	}
+	switch opts.SNMPVersion {
+	case "v1":
+		client.Version = gosnmp.Version1
+	case "", "v2c":
+		client.Version = gosnmp.Version2c
+	case "v3":
+		flags, params, err := opts.USM.securityParameters()
+		if err != nil {
+			return nil, err
+		}
+		client.Version = gosnmp.Version3
+		client.SecurityModel = gosnmp.UserSecurityModel
+		client.MsgFlags = flags
+		client.SecurityParameters = params
+	default:
+		return nil, fmt.Errorf("SNMP %s is not supported by the probe", opts.SNMPVersion)
+	}
+	if err := client.Connect(); err != nil {
+		return nil, snmpError(err)
+	}
+	defer client.Conn.Close()
+	resp, err := client.Get(oids)
+	if err != nil {
+		return nil, snmpError(err)
+	}
+	if resp.PDUType == gosnmp.Report && len(resp.Variables) > 0 {
+		return nil, fmt.Errorf("SNMP agent sent a report of %s", resp.Variables[0].Name)
+	}
+	switch resp.Error {
+	case gosnmp.NoError:
+	case gosnmp.AuthorizationError:
+		return nil, ErrSNMPAuth
+	default:
+		return nil, fmt.Errorf("SNMP error status %s", resp.Error)
+	}
+	values := make(map[string]string)
+	for _, v := range resp.Variables {
+		oid := strings.TrimPrefix(v.Name, ".")
+		switch v.Type {
+		case gosnmp.OctetString:
+			b, _ := v.Value.([]byte)
+			values[oid] = strings.TrimRight(string(b), "\x00")
+		case gosnmp.ObjectIdentifier:
+			s, _ := v.Value.(string)
+			values[oid] = strings.TrimPrefix(s, ".")
+		case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView:
+			// not available on this agent
+		default:
+			values[oid] = fmt.Sprint(v.Value)
+		}
+	}
+	return values, nil
+}
+
+// snmpError maps a gosnmp error to the probe errors
+func snmpError(err error) error {
+	switch {
+	case errors.Is(err, gosnmp.ErrUnknownUsername):
+		return fmt.Errorf("%w: unknown user name", ErrSNMPAuth)
+	case errors.Is(err, gosnmp.ErrWrongDigest):
+		return fmt.Errorf("%w: wrong authentication password or algorithm", ErrSNMPAuth)
+	case errors.Is(err, gosnmp.ErrDecryption):
+		return fmt.Errorf("%w: wrong privacy password or algorithm", ErrSNMPAuth)
+	case errors.Is(err, gosnmp.ErrUnknownSecurityLevel):
+		return fmt.Errorf("%w: the security level is not supported for the user", ErrSNMPAuth)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrSNMPRefused
+	case strings.Contains(err.Error(), "not authentic"):
+		return fmt.Errorf("%w: the response is not signed with the authentication password", ErrSNMPAuth)
+	case strings.Contains(err.Error(), "timeout"):
+		// gosnmp reports a timeout as text after its retries
+		return ErrSNMPTimeout
+	}
+	return err
+}
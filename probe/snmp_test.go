@@ -0,0 +1,332 @@
+package probe
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+const (
+	testEngineID    = "\x80\x00\x1f\x88\x80\x59\xdc\x48\x61\x45\xa2\x63\x22"
+	testCommunity   = "public"
+	testSysObjectID = "1.3.6.1.4.1.9.1.1208"
+	testSysName     = "core-sw1"
+	// usmStats counters sent in reports (RFC 3414)
+	oidUnsupportedSecLevels = ".1.3.6.1.6.3.15.1.1.1.0"
+	oidNotInTimeWindows     = ".1.3.6.1.6.3.15.1.1.2.0"
+	oidUnknownUserNames     = ".1.3.6.1.6.3.15.1.1.3.0"
+	oidUnknownEngineIDs     = ".1.3.6.1.6.3.15.1.1.4.0"
+	oidWrongDigests         = ".1.3.6.1.6.3.15.1.1.5.0"
+	oidDecryptionErrors     = ".1.3.6.1.6.3.15.1.1.6.0"
+)
+
+// testAgent answers GETs of sysObjectID and sysName for the community
+// public and one SNMPv3 user.  Packets are encoded with gosnmp; the agent
+// answers discovery, requests outside the time window, unknown users,
+// wrong digests and requests it cannot decrypt with the reports of RFC
+// 3414.
+type testAgent struct {
+	usm   *gosnmp.UsmSecurityParameters
+	flags gosnmp.SnmpV3MsgFlags
+	// engineTime is the agent's time and reportTime the time it gives
+	// in discovery reports
+	engineTime uint32
+	reportTime uint32
+	port       int
+}
+
+func newTestAgent(t *testing.T, network string, usm USM) *testAgent {
+	t.Helper()
+	flags, params, err := usm.securityParameters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	params.AuthoritativeEngineID = testEngineID
+	params.AuthoritativeEngineBoots = 7
+	if err = params.InitSecurityKeys(); err != nil {
+		t.Fatal(err)
+	}
+	a := &testAgent{usm: params, flags: flags, engineTime: 5000, reportTime: 5000}
+	var addr net.Addr
+	switch network {
+	case "udp":
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		addr = conn.LocalAddr()
+		go func() {
+			buf := make([]byte, 65535)
+			for {
+				n, peer, err := conn.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				if resp := a.handle(append([]byte{}, buf[:n]...)); resp != nil {
+					conn.WriteTo(resp, peer)
+				}
+			}
+		}()
+	case "tcp":
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		addr = ln.Addr()
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					buf := make([]byte, 65535)
+					for {
+						n, err := conn.Read(buf)
+						if err != nil {
+							return
+						}
+						if resp := a.handle(append([]byte{}, buf[:n]...)); resp != nil {
+							conn.Write(resp)
+						}
+					}
+				}()
+			}
+		}()
+	}
+	_, port, _ := net.SplitHostPort(addr.String())
+	a.port, _ = strconv.Atoi(port)
+	return a
+}
+
+func (a *testAgent) handle(req []byte) []byte {
+	// the version follows the message sequence header
+	i := 2
+	if req[1]&0x80 != 0 {
+		i += int(req[1] & 0x7f)
+	}
+	if len(req) < i+3 {
+		return nil
+	}
+	if gosnmp.SnmpVersion(req[i+2]) != gosnmp.Version3 {
+		pkt, err := (&gosnmp.GoSNMP{Version: gosnmp.Version2c}).SnmpDecodePacket(req)
+		if err != nil || pkt.Community != testCommunity {
+			return nil
+		}
+		resp := &gosnmp.SnmpPacket{Version: pkt.Version, Community: pkt.Community, PDUType: gosnmp.GetResponse,
+			RequestID: pkt.RequestID, Variables: values(pkt.Variables)}
+		b, _ := resp.MarshalMsg()
+		return b
+	}
+
+	decoder := &gosnmp.GoSNMP{Version: gosnmp.Version3, SecurityModel: gosnmp.UserSecurityModel,
+		MsgFlags: a.flags, SecurityParameters: a.usm.Copy()}
+	pkt, err := decoder.SnmpDecodePacket(append([]byte{}, req...))
+	sp, ok := pkt.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	if !ok {
+		return nil
+	}
+	level := pkt.MsgFlags & gosnmp.AuthPriv
+	switch {
+	case sp.AuthoritativeEngineID != testEngineID:
+		return a.respond(pkt, gosnmp.NoAuthNoPriv, gosnmp.Report, a.reportTime, oidUnknownEngineIDs)
+	case sp.UserName != a.usm.UserName:
+		return a.respond(pkt, gosnmp.NoAuthNoPriv, gosnmp.Report, a.engineTime, oidUnknownUserNames)
+	case level != a.flags:
+		return a.respond(pkt, gosnmp.NoAuthNoPriv, gosnmp.Report, a.engineTime, oidUnsupportedSecLevels)
+	case level != gosnmp.NoAuthNoPriv && !a.authentic(req, sp.AuthenticationParameters):
+		return a.respond(pkt, gosnmp.NoAuthNoPriv, gosnmp.Report, a.engineTime, oidWrongDigests)
+	case level != gosnmp.NoAuthNoPriv && absDiff(sp.AuthoritativeEngineTime, a.engineTime) > 150:
+		return a.respond(pkt, gosnmp.AuthNoPriv, gosnmp.Report, a.engineTime, oidNotInTimeWindows)
+	case err != nil:
+		return a.respond(pkt, gosnmp.NoAuthNoPriv, gosnmp.Report, a.engineTime, oidDecryptionErrors)
+	}
+	return a.respond(pkt, level, gosnmp.GetResponse, a.engineTime, "")
+}
+
+// authentic checks the MAC of req, computed with the MAC zeroed.  req is
+// the message as received: gosnmp decrypts the scoped PDU in place.
+func (a *testAgent) authentic(req []byte, mac string) bool {
+	i := bytes.Index(req, []byte(mac))
+	if len(mac) == 0 || i < 0 {
+		return false
+	}
+	msg := append([]byte{}, req...)
+	copy(msg[i:i+len(mac)], make([]byte, len(mac)))
+	h := hmac.New(a.usm.AuthenticationProtocol.HashType().New, a.usm.SecretKey)
+	h.Write(msg)
+	return hmac.Equal(h.Sum(nil)[:len(mac)], []byte(mac))
+}
+
+// respond returns the response to req, or a report of the usmStats
+// counter
+func (a *testAgent) respond(req *gosnmp.SnmpPacket, level gosnmp.SnmpV3MsgFlags, pduType gosnmp.PDUType, engineTime uint32, counter string) []byte {
+	params := a.usm.Copy().(*gosnmp.UsmSecurityParameters)
+	params.AuthoritativeEngineTime = engineTime
+	resp := &gosnmp.SnmpPacket{
+		Version:            gosnmp.Version3,
+		MsgFlags:           level,
+		SecurityModel:      gosnmp.UserSecurityModel,
+		SecurityParameters: params,
+		MsgID:              req.MsgID,
+		ContextEngineID:    testEngineID,
+		PDUType:            pduType,
+		RequestID:          req.RequestID,
+		Variables:          values(req.Variables),
+	}
+	if counter != "" {
+		resp.Variables = []gosnmp.SnmpPDU{{Name: counter, Type: gosnmp.Counter32, Value: uint32(1)}}
+	}
+	if err := params.InitPacket(resp); err != nil {
+		return nil
+	}
+	b, _ := resp.MarshalMsg()
+	return b
+}
+
+// values answers the GET of the variables
+func values(vars []gosnmp.SnmpPDU) []gosnmp.SnmpPDU {
+	var out []gosnmp.SnmpPDU
+	for _, v := range vars {
+		switch strings.TrimPrefix(v.Name, ".") {
+		case OIDSysObjectID:
+			out = append(out, gosnmp.SnmpPDU{Name: v.Name, Type: gosnmp.ObjectIdentifier, Value: "." + testSysObjectID})
+		case OIDSysName:
+			out = append(out, gosnmp.SnmpPDU{Name: v.Name, Type: gosnmp.OctetString, Value: []byte(testSysName)})
+		default:
+			out = append(out, gosnmp.SnmpPDU{Name: v.Name, Type: gosnmp.NoSuchObject})
+		}
+	}
+	return out
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func TestSNMPGet(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport string
+		version   string
+		usm       USM
+	}{
+		{"v1", "udp", "v1", USM{}},
+		{"v2c", "udp", "v2c", USM{}},
+		{"v2c tcp", "tcp", "v2c", USM{}},
+		{"noAuthNoPriv", "udp", "v3", USM{Level: NoAuthNoPriv, User: "probe"}},
+		{"authNoPriv md5", "udp", "v3", USM{User: "probe", AuthPass: "maplesyrup", AuthAlgo: "MD5"}},
+		{"authPriv sha des", "udp", "v3", USM{User: "probe", AuthPass: "maplesyrup", PrivPass: "privsecret", AuthAlgo: "SHA", PrivAlgo: "DES"}},
+		{"authPriv sha aes", "udp", "v3", USM{User: "probe", AuthPass: "maplesyrup", PrivPass: "privsecret"}},
+		{"authPriv sha-256 aes-256", "udp", "v3", USM{User: "probe", AuthPass: "maplesyrup", PrivPass: "privsecret", AuthAlgo: "SHA-256", PrivAlgo: "AES-256"}},
+		{"authPriv sha aes-256c", "udp", "v3", USM{User: "probe", AuthPass: "maplesyrup", PrivPass: "privsecret", PrivAlgo: "AES-256C"}},
+		{"authPriv tcp", "tcp", "v3", USM{User: "probe", AuthPass: "maplesyrup", PrivPass: "privsecret"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := newTestAgent(t, tt.transport, tt.usm)
+			opts := Options{SNMPVersion: tt.version, Community: testCommunity, USM: tt.usm, SNMPPort: agent.port, Transport: tt.transport, Timeout: time.Second}
+			values, err := snmpGet("127.0.0.1", opts, OIDSysObjectID, OIDSysName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if values[OIDSysObjectID] != testSysObjectID || values[OIDSysName] != testSysName {
+				t.Errorf("got %v", values)
+			}
+		})
+	}
+}
+
+func TestSNMPGetTimeWindow(t *testing.T) {
+	usm := USM{User: "probe", AuthPass: "maplesyrup", PrivPass: "privsecret"}
+	agent := newTestAgent(t, "udp", usm)
+	agent.reportTime = 0
+	opts := Options{SNMPVersion: "v3", USM: usm, SNMPPort: agent.port, Timeout: time.Second}
+	values, err := snmpGet("127.0.0.1", opts, OIDSysName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values[OIDSysName] != testSysName {
+		t.Errorf("got %v", values)
+	}
+}
+
+func TestSNMPGetAuthFailures(t *testing.T) {
+	agentUSM := USM{User: "probe", AuthPass: "maplesyrup", PrivPass: "privsecret", AuthAlgo: "SHA", PrivAlgo: "AES"}
+	tests := []struct {
+		name   string
+		usm    USM
+		reason string
+	}{
+		{"unknown user", USM{User: "nobody", AuthPass: "maplesyrup", PrivPass: "privsecret"}, "unknown user name"},
+		{"wrong auth password", USM{User: "probe", AuthPass: "pancakes", PrivPass: "privsecret"}, "wrong authentication password"},
+		{"wrong auth algorithm", USM{User: "probe", AuthPass: "maplesyrup", PrivPass: "privsecret", AuthAlgo: "MD5"}, "wrong authentication password"},
+		{"wrong privacy password", USM{User: "probe", AuthPass: "maplesyrup", PrivPass: "waffles"}, "wrong privacy password"},
+		{"wrong privacy algorithm", USM{User: "probe", AuthPass: "maplesyrup", PrivPass: "privsecret", PrivAlgo: "DES"}, "wrong privacy password"},
+		{"wrong level", USM{User: "probe", AuthPass: "maplesyrup"}, "security level is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := newTestAgent(t, "udp", agentUSM)
+			opts := Options{SNMPVersion: "v3", USM: tt.usm, SNMPPort: agent.port, Timeout: time.Second}
+			_, err := snmpGet("127.0.0.1", opts, OIDSysName)
+			if !errors.Is(err, ErrSNMPAuth) {
+				t.Fatalf("got %v, want %v", err, ErrSNMPAuth)
+			}
+			if !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("got %q, want %q", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestSNMPGetNoAgent(t *testing.T) {
+	agent := newTestAgent(t, "udp", USM{})
+	opts := Options{SNMPVersion: "v2c", Community: "private", SNMPPort: agent.port, Timeout: 200 * time.Millisecond}
+	if _, err := snmpGet("127.0.0.1", opts, OIDSysName); !errors.Is(err, ErrSNMPTimeout) {
+		t.Errorf("wrong community: got %v, want %v", err, ErrSNMPTimeout)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(conn.LocalAddr().String())
+	conn.Close()
+	opts.SNMPPort, _ = strconv.Atoi(port)
+	if _, err = snmpGet("127.0.0.1", opts, OIDSysName); !errors.Is(err, ErrSNMPRefused) {
+		t.Errorf("closed port: got %v, want %v", err, ErrSNMPRefused)
+	}
+}
+
+func TestRunV3AuthFailure(t *testing.T) {
+	agent := newTestAgent(t, "udp", USM{User: "probe", AuthPass: "maplesyrup"})
+	opts := Options{
+		TCPPorts:    []int{agent.port},
+		SNMPVersion: "v3",
+		USM:         USM{User: "probe", AuthPass: "pancakes"},
+		SNMPPort:    agent.port,
+		Timeout:     time.Second,
+	}
+	result := Run("127.0.0.1", opts)
+	if result.Failure != FailureAuth {
+		t.Fatalf("got failure %q, want %q\n%s", result.Failure, FailureAuth, result)
+	}
+	last := result.Checks[len(result.Checks)-1]
+	if last.Name != "snmp v3" || last.Status != StatusFailed {
+		t.Errorf("got %s", last)
+	}
+}
@@ -0,0 +1,154 @@
+// Package resolver builds DNS resolvers from the hookcmd config so
+// lookups can be sent to specific (internal or authoritative)
+// nameservers per VRF or zone, optionally over TLS.
+package resolver
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/rsapc/hookcmd/config"
+)
+
+const defaultTimeout = 5 * time.Second
+
+// Resolver wraps a net.Resolver with its lookup timeout
+type Resolver struct {
+	cfg      config.ResolverConfig
+	resolver *net.Resolver
+	timeout  time.Duration
+}
+
+// New creates a resolver for the configured servers.  Without servers
+// the system resolver is used.
+func New(cfg config.ResolverConfig) *Resolver {
+	r := &Resolver{cfg: cfg, timeout: cfg.Timeout.Duration}
+	if r.timeout == 0 {
+		r.timeout = defaultTimeout
+	}
+	if len(cfg.Servers) == 0 {
+		r.resolver = net.DefaultResolver
+		return r
+	}
+	r.resolver = &net.Resolver{PreferGo: true, Dial: r.dial}
+	return r
+}
+
+// dial connects to the configured servers in order, ignoring the
+// address chosen by the Go resolver
+func (r *Resolver) dial(ctx context.Context, network, _ string) (net.Conn, error) {
+	var lastErr error
+	d := net.Dialer{Timeout: r.timeout}
+	for _, server := range r.cfg.Servers {
+		if r.cfg.TLS {
+			host, addr := hostPort(server, "853")
+			serverName := r.cfg.TLSServerName
+			if serverName == "" {
+				serverName = host
+			}
+			td := tls.Dialer{NetDialer: &d, Config: &tls.Config{ServerName: serverName}}
+			conn, err := td.DialContext(ctx, "tcp", addr)
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+			continue
+		}
+		_, addr := hostPort(server, "53")
+		conn, err := d.DialContext(ctx, network, addr)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("no nameserver reachable: %w", lastErr)
+}
+
+// hostPort splits server into its host and host:port using port as the default
+func hostPort(server string, port string) (string, string) {
+	if host, _, err := net.SplitHostPort(server); err == nil {
+		return host, server
+	}
+	return server, net.JoinHostPort(server, port)
+}
+
+// LookupAddr returns the PTR names for the address
+func (r *Resolver) LookupAddr(addr string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	return r.resolver.LookupAddr(ctx, addr)
+}
+
+// LookupHost returns the addresses of the host
+func (r *Resolver) LookupHost(host string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	return r.resolver.LookupHost(ctx, host)
+}
+
+// Set selects a resolver by VRF and zone
+type Set struct {
+	fallback  *Resolver
+	resolvers []*Resolver
+}
+
+// NewSet creates the resolvers from the DNS config
+func NewSet(cfg config.DNSConfig) *Set {
+	s := &Set{fallback: New(cfg.Default)}
+	for _, rc := range cfg.Resolvers {
+		s.resolvers = append(s.resolvers, New(rc))
+	}
+	return s
+}
+
+// ForName returns the first resolver whose VRF and zone match.  An
+// empty VRF or zone in the config matches anything.
+func (s *Set) ForName(name string, vrf string) *Resolver {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, r := range s.resolvers {
+		if r.cfg.VRF != "" && r.cfg.VRF != vrf {
+			continue
+		}
+		if r.cfg.Zone != "" && !InZone(name, r.cfg.Zone) {
+			continue
+		}
+		return r
+	}
+	return s.fallback
+}
+
+// ForAddr returns the resolver for reverse lookups of addr
+func (s *Set) ForAddr(addr netip.Addr, vrf string) *Resolver {
+	return s.ForName(ReverseName(addr), vrf)
+}
+
+// InZone returns true if name is zone or a name below it
+func InZone(name string, zone string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// ReverseName returns the in-addr.arpa or ip6.arpa name for addr
+// (without the trailing dot)
+func ReverseName(addr netip.Addr) string {
+	var labels []string
+	if addr.Is4() || addr.Is4In6() {
+		b := addr.Unmap().As4()
+		for i := len(b) - 1; i >= 0; i-- {
+			labels = append(labels, fmt.Sprint(b[i]))
+		}
+		return strings.Join(labels, ".") + ".in-addr.arpa"
+	}
+	b := addr.As16()
+	const hex = "0123456789abcdef"
+	for i := len(b) - 1; i >= 0; i-- {
+		labels = append(labels, string(hex[b[i]&0x0f]), string(hex[b[i]>>4]))
+	}
+	return strings.Join(labels, ".") + ".ip6.arpa"
+}
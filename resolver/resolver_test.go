@@ -0,0 +1,67 @@
+package resolver
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/rsapc/hookcmd/config"
+)
+
+func TestSetSelect(t *testing.T) {
+	set := NewSet(config.DNSConfig{
+		Default: config.ResolverConfig{Servers: []string{"default"}},
+		Resolvers: []config.ResolverConfig{
+			{VRF: "cust-a", Servers: []string{"cust-a"}},
+			{Zone: "10.in-addr.arpa", Servers: []string{"reverse"}},
+			{Zone: "corp.example.com", Servers: []string{"corp"}},
+			// never reached: the cust-a entry comes first
+			{VRF: "cust-a", Zone: "corp.example.com", Servers: []string{"cust-a-corp"}},
+		},
+	})
+	tests := []struct {
+		name, vrf string
+		want      string
+	}{
+		{"host.corp.example.com", "", "corp"},
+		{"HOST.Corp.Example.com.", "", "corp"},
+		{"corp.example.com", "", "corp"},
+		{"xcorp.example.com", "", "default"},
+		{"host.corp.example.com", "cust-a", "cust-a"},
+		{"host.example.org", "cust-b", "default"},
+		{"5.0.0.10.in-addr.arpa", "", "reverse"},
+	}
+	for _, tt := range tests {
+		if got := set.ForName(tt.name, tt.vrf).cfg.Servers[0]; got != tt.want {
+			t.Errorf("ForName(%q, %q) = %s, want %s", tt.name, tt.vrf, got, tt.want)
+		}
+	}
+	if got := set.ForAddr(netip.MustParseAddr("10.1.2.3"), "").cfg.Servers[0]; got != "reverse" {
+		t.Errorf("ForAddr(10.1.2.3) = %s, want reverse", got)
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	tests := map[string]string{
+		"10.1.2.3":           "3.2.1.10.in-addr.arpa",
+		"::ffff:10.1.2.3":    "3.2.1.10.in-addr.arpa",
+		"2001:db8::567:89ab": "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa",
+	}
+	for addr, want := range tests {
+		if got := ReverseName(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("ReverseName(%s) = %s, want %s", addr, got, want)
+		}
+	}
+}
+
+func TestHostPort(t *testing.T) {
+	tests := []struct{ server, host, addr string }{
+		{"10.0.0.53", "10.0.0.53", "10.0.0.53:853"},
+		{"ns1.example.com:8853", "ns1.example.com", "ns1.example.com:8853"},
+		{"2001:db8::53", "2001:db8::53", "[2001:db8::53]:853"},
+	}
+	for _, tt := range tests {
+		if host, addr := hostPort(tt.server, "853"); host != tt.host || addr != tt.addr {
+			t.Errorf("hostPort(%s) = %s %s, want %s %s", tt.server, host, addr, tt.host, tt.addr)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package results
+
+// Exit codes set by the commands
+const (
+	ExitOK     = 0
+	ExitFailed = 1
+	// ExitUsage is returned for invalid arguments and flags
+	ExitUsage = 2
+)
+
+// Status values of the envelope
+const (
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+// EnvelopeVersion is incremented if a field of the envelope changes
+// meaning.  Fields are only ever added.
+const EnvelopeVersion = 1
+
+// Envelope is the result returned by --output json
+type Envelope struct {
+	Version  int    `json:"version"`
+	Command  string `json:"command"`
+	Status   string `json:"status"`
+	ExitCode int    `json:"exit_code"`
+	// Kind is the kind of error: not_found, auth, validation, conflict
+	// or unavailable.  Empty on success or for other errors.
+	Kind       string `json:"kind,omitempty"`
+	HTTPStatus int    `json:"http_status"`
+	// RunID identifies the changes made in the audit log
+	RunID    string   `json:"run_id,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Summary  []string `json:"summary"`
+	Actions  []Change `json:"actions"`
+	Objects  []Link   `json:"objects"`
+	Warnings []string `json:"warnings"`
+	Errors   []string `json:"errors"`
+	// Output is the text the command would have printed (eg. a report)
+	Output string `json:"output,omitempty"`
+}
+
+// Envelope returns the result of the command that returned err.  Lists
+// are empty rather than null.
+func (r *Result) Envelope(command string, err error, output string) Envelope {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := StatusOK
+	if err != nil {
+		status = StatusFailed
+	}
+	return Envelope{
+		Version:    EnvelopeVersion,
+		Command:    command,
+		Status:     status,
+		ExitCode:   ExitCode(err),
+		Kind:       kindNames[Kind(err)],
+		HTTPStatus: HTTPStatus(err),
+		RunID:      r.RunID,
+		Title:      r.Title,
+		Summary:    nonNil(r.Summary),
+		Actions:    nonNil(r.Changes),
+		Objects:    nonNil(r.Links),
+		Warnings:   nonNil(r.Log),
+		Errors:     nonNil(r.Errors),
+		Output:     output,
+	}
+}
+
+func nonNil[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
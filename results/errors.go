@@ -0,0 +1,97 @@
+package results
+
+import (
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+
+	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/netbox"
+)
+
+// Exit codes for the error kinds
+const (
+	ExitNotFound    = 3
+	ExitAuth        = 4
+	ExitConflict    = 5
+	ExitUnavailable = 6
+)
+
+var kindNames = map[error]string{
+	models.ErrNotFound:    "not_found",
+	models.ErrAuth:        "auth",
+	models.ErrValidation:  "validation",
+	models.ErrConflict:    "conflict",
+	models.ErrUnavailable: "unavailable",
+}
+
+// statusPattern finds the status in the errors of github.com/rsapc/netbox,
+// which only carry it in the message: "netbox returned 404" or "invalid
+// response to GET url: [404] ...".  Other messages are not matched.
+var statusPattern = regexp.MustCompile(`(?:\bnetbox returned |\binvalid response to [A-Z]+ \S+: \[)(\d{3})\b`)
+
+// Kind returns the models error kind of err, or nil if it is not known.
+// Network errors are models.ErrUnavailable.
+func Kind(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, kind := range models.Kinds {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	if errors.Is(err, netbox.ErrNotFound) {
+		return models.ErrNotFound
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return models.ErrUnavailable
+	}
+	if m := statusPattern.FindStringSubmatch(err.Error()); m != nil {
+		status, _ := strconv.Atoi(m[1])
+		return models.KindForStatus(status)
+	}
+	return nil
+}
+
+// ExitCode returns the process exit code for err
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	switch Kind(err) {
+	case models.ErrNotFound:
+		return ExitNotFound
+	case models.ErrAuth:
+		return ExitAuth
+	case models.ErrValidation:
+		return ExitUsage
+	case models.ErrConflict:
+		return ExitConflict
+	case models.ErrUnavailable:
+		return ExitUnavailable
+	}
+	return ExitFailed
+}
+
+// HTTPStatus returns the HTTP status for err
+func HTTPStatus(err error) int {
+	if err == nil {
+		return 200
+	}
+	switch Kind(err) {
+	case models.ErrNotFound:
+		return 404
+	case models.ErrAuth:
+		return 401
+	case models.ErrValidation:
+		return 400
+	case models.ErrConflict:
+		return 409
+	case models.ErrUnavailable:
+		return 503
+	}
+	return 500
+}
@@ -0,0 +1,57 @@
+package results
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/netbox"
+)
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		kind   error
+		exit   int
+		status int
+	}{
+		{"nil", nil, nil, ExitOK, 200},
+		{"plain", errors.New("boom"), nil, ExitFailed, 500},
+		{"not found", fmt.Errorf("device 1: %w", models.ErrNotFound), models.ErrNotFound, ExitNotFound, 404},
+		{"netbox not found", netbox.ErrNotFound, models.ErrNotFound, ExitNotFound, 404},
+		{"status 403", &models.StatusError{Status: 403, Message: "denied"}, models.ErrAuth, ExitAuth, 401},
+		{"status 422", &models.StatusError{Status: 422, Message: "bad"}, models.ErrValidation, ExitUsage, 400},
+		{"status 409", models.WithKind(errors.New("exists"), models.ErrConflict), models.ErrConflict, ExitConflict, 409},
+		{"status 503", &models.StatusError{Status: 503, Message: "down"}, models.ErrUnavailable, ExitUnavailable, 503},
+		{"netbox message", errors.New("netbox returned 401 Unauthorized"), models.ErrAuth, ExitAuth, 401},
+		{"netbox response", fmt.Errorf("device 5: %w", errors.New("invalid response to PATCH http://netbox/api/dcim/devices/5/: [409] 409 Conflict {}")), models.ErrConflict, ExitConflict, 409},
+		{"bracketed number", errors.New("interface Gi0/1: [404] ports in use"), nil, ExitFailed, 500},
+		{"returned number", errors.New("LibreNMS returned 404 devices"), nil, ExitFailed, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Kind(tt.err); got != tt.kind {
+				t.Errorf("Kind() = %v, want %v", got, tt.kind)
+			}
+			if got := ExitCode(tt.err); got != tt.exit {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.exit)
+			}
+			if got := HTTPStatus(tt.err); got != tt.status {
+				t.Errorf("HTTPStatus() = %d, want %d", got, tt.status)
+			}
+		})
+	}
+}
+
+func TestNewErrorIsBoth(t *testing.T) {
+	errGone := models.NewError("device gone", models.ErrNotFound)
+	err := fmt.Errorf("sync: %w", errGone)
+	if !errors.Is(err, errGone) || !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("errors.Is failed for %v", err)
+	}
+	if err.Error() != "sync: device gone" {
+		t.Errorf("message = %q", err.Error())
+	}
+}
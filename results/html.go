@@ -0,0 +1,70 @@
+package results
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+)
+
+var page = template.Must(template.New("result").Funcs(template.FuncMap{
+	"value": value,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+.box { border: 1px solid; border-radius: 4px; padding: 0.5em 1em; margin: 1em 0; }
+.error { border-color: #c00; background: #fdd; }
+.ok { border-color: #080; background: #dfd; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.25em 0.75em; text-align: left; vertical-align: top; }
+td.value { font-family: monospace; white-space: pre-wrap; }
+.none { color: #888; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Errors}}<div class="box error">
+<strong>Failed</strong>
+<ul>{{range .Errors}}
+<li>{{.}}</li>{{end}}
+</ul>
+</div>
+{{else}}<div class="box ok"><strong>Completed</strong> with {{len .Changes}} change(s)</div>
+{{end}}{{if .Summary}}<h2>Summary</h2>
+<ul>{{range .Summary}}
+<li>{{.}}</li>{{end}}
+</ul>
+{{end}}{{if .Changes}}<h2>Changes</h2>
+<table>
+<tr><th>System</th><th>Object</th><th>Action</th><th>Field</th><th>Old</th><th>New</th></tr>{{range .Changes}}
+<tr><td>{{.System}}</td><td>{{if .URL}}<a href="{{.URL}}">{{.Object}}</a>{{else}}{{.Object}}{{end}}</td><td>{{.Action}}</td><td>{{.Field}}</td><td class="value">{{value .Old}}</td><td class="value">{{value .New}}</td></tr>{{end}}
+</table>
+{{end}}{{if .Log}}<h2>Log</h2>
+<pre>{{range .Log}}{{.}}
+{{end}}</pre>
+{{end}}{{if .Links}}<h2>Objects</h2>
+<ul>{{range .Links}}
+<li><a href="{{.URL}}">{{.Label}}</a></li>{{end}}
+</ul>
+{{end}}<p><button onclick="history.back()">Go Back</button></p>
+</body>
+</html>
+`))
+
+// value formats a field value for the change table
+func value(v any) template.HTML {
+	if v == nil {
+		return `<span class="none">-</span>`
+	}
+	return template.HTML(template.HTMLEscapeString(fmt.Sprint(v)))
+}
+
+// WriteHTML renders the result as an HTML page
+func (r *Result) WriteHTML(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return page.Execute(w, r)
+}
@@ -0,0 +1,61 @@
+package results
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTMLEscapes(t *testing.T) {
+	r := &Result{}
+	r.SetTitle("sync <b>sw1</b>")
+	r.Summaryf("renamed %s", `"><script>alert(1)</script>`)
+	r.AddChange(Change{Action: Update, System: Netbox, Model: "device", ID: 5, Name: "<i>sw1</i>", Field: "description",
+		Old: "<img src=x onerror=alert(1)>", New: "a & b", URL: "javascript:alert(1)"})
+	r.AddChange(Change{Action: Update, System: LibreNMS, Model: "device", ID: 12, Field: "purpose", New: "<hr>"})
+	r.AddLink(`LibreNMS "device" <12>`, "http://librenms/device/12?a=1&b=2")
+	r.AddError(errors.New("device <sw1> & 'sw2' failed"))
+	r.Log = append(r.Log, "level=WARN msg=</pre><script>")
+
+	var out strings.Builder
+	if err := r.WriteHTML(&out); err != nil {
+		t.Fatal(err)
+	}
+	page := out.String()
+	for _, raw := range []string{"<b>", "<script>", "<i>", "<img", "<hr>", "javascript:", "<sw1>", "<12>", "</pre><"} {
+		if strings.Contains(page, raw) {
+			t.Errorf("the page contains %q unescaped", raw)
+		}
+	}
+	for _, escaped := range []string{
+		"<title>sync &lt;b&gt;sw1&lt;/b&gt;</title>",
+		"<li>renamed &#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;</li>",
+		`<a href="#ZgotmplZ">device &lt;i&gt;sw1&lt;/i&gt;</a>`,
+		`<td class="value">&lt;img src=x onerror=alert(1)&gt;</td><td class="value">a &amp; b</td>`,
+		`<td class="value"><span class="none">-</span></td><td class="value">&lt;hr&gt;</td>`,
+		`<a href="http://librenms/device/12?a=1&amp;b=2">LibreNMS &#34;device&#34; &lt;12&gt;</a>`,
+		"<li>device &lt;sw1&gt; &amp; &#39;sw2&#39; failed</li>",
+		"level=WARN msg=&lt;/pre&gt;&lt;script&gt;",
+	} {
+		if !strings.Contains(page, escaped) {
+			t.Errorf("the page does not contain %s:\n%s", escaped, page)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		v    any
+		want string
+	}{
+		{nil, `<span class="none">-</span>`},
+		{"<b>", "&lt;b&gt;"},
+		{42, "42"},
+		{[]string{"a<", ">b"}, "[a&lt; &gt;b]"},
+	}
+	for _, tt := range tests {
+		if got := string(value(tt.v)); got != tt.want {
+			t.Errorf("value(%#v) = %s, want %s", tt.v, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package results
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// logHandler adds the warnings and errors logged by a command to its
+// result, so they are shown with it rather than only on stderr
+type logHandler struct {
+	slog.Handler
+	result *Result
+	attrs  []slog.Attr
+}
+
+// NewLogHandler wraps next so warnings and errors are also added to the
+// result log
+func NewLogHandler(next slog.Handler, result *Result) slog.Handler {
+	return &logHandler{Handler: next, result: result}
+}
+
+func (h *logHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if rec.Level >= slog.LevelWarn {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s %s", rec.Level, rec.Message)
+		add := func(a slog.Attr) bool {
+			fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+			return true
+		}
+		for _, a := range h.attrs {
+			add(a)
+		}
+		rec.Attrs(add)
+		h.result.mu.Lock()
+		h.result.Log = append(h.result.Log, b.String())
+		h.result.mu.Unlock()
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &logHandler{Handler: h.Handler.WithAttrs(attrs), result: h.result, attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	return &logHandler{Handler: h.Handler.WithGroup(name), result: h.result, attrs: h.attrs}
+}
@@ -0,0 +1,123 @@
+// Package results collects what a command did - a summary, the fields it
+// changed in Netbox and LibreNMS with their previous values, and any
+// errors - so the outcome can be shown to whoever ran it.
+package results
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Systems a change is made in
+const (
+	Netbox   = "netbox"
+	LibreNMS = "librenms"
+	DNS      = "dns"
+)
+
+// Change actions
+const (
+	Create = "create"
+	Update = "update"
+	Delete = "delete"
+)
+
+// Change is a created or deleted object, or one changed field
+type Change struct {
+	Action string `json:"action"`
+	System string `json:"system"`
+	Model  string `json:"model"`
+	ID     int64  `json:"id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Field  string `json:"field,omitempty"`
+	Old    any    `json:"old,omitempty"`
+	New    any    `json:"new,omitempty"`
+	URL    string `json:"url,omitempty"`
+}
+
+// Object describes the changed object as "model name" (or ID)
+func (c Change) Object() string {
+	if c.Name != "" {
+		return fmt.Sprintf("%s %s", c.Model, c.Name)
+	}
+	if c.ID != 0 {
+		return fmt.Sprintf("%s %d", c.Model, c.ID)
+	}
+	return c.Model
+}
+
+// Link is an object affected by the command
+type Link struct {
+	Label string `json:"label"`
+	URL   string `json:"url"`
+}
+
+// Result is the outcome of a command.  It is safe for concurrent use.
+type Result struct {
+	mu sync.Mutex
+	// RunID identifies the run in the audit log
+	RunID   string   `json:"run_id,omitempty"`
+	Title   string   `json:"title"`
+	Summary []string `json:"summary,omitempty"`
+	Changes []Change `json:"changes,omitempty"`
+	Links   []Link   `json:"links,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+	// Log holds the warnings and errors logged while the command ran
+	Log []string `json:"log,omitempty"`
+}
+
+// SetTitle sets the title describing the command
+func (r *Result) SetTitle(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Title = fmt.Sprintf(format, args...)
+}
+
+// Summaryf adds a line to the summary
+func (r *Result) Summaryf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Summary = append(r.Summary, fmt.Sprintf(format, args...))
+}
+
+// AddChange records a change and links to the changed object
+func (r *Result) AddChange(c Change) {
+	r.mu.Lock()
+	r.Changes = append(r.Changes, c)
+	r.mu.Unlock()
+	if c.URL != "" && c.Action != Delete {
+		r.AddLink(fmt.Sprintf("%s %s", c.System, c.Object()), c.URL)
+	}
+}
+
+// AddLink adds a link to an affected object.  Links are only added once.
+func (r *Result) AddLink(label string, url string) {
+	if url == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, link := range r.Links {
+		if link.URL == url {
+			return
+		}
+	}
+	r.Links = append(r.Links, Link{Label: label, URL: url})
+}
+
+// AddError records a failure
+func (r *Result) AddError(err error) {
+	if err == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Errors = append(r.Errors, err.Error())
+}
+
+// OK returns true if no errors were recorded
+func (r *Result) OK() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.Errors) == 0
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/rsapc/hookcmd/audit"
+	"github.com/rsapc/hookcmd/nbapi"
+	"github.com/rsapc/hookcmd/results"
+)
+
+// SetTrigger sets the command and the event that started the run, which
+// are recorded with each change in the audit log
+func (s *Service) SetTrigger(command string, event string) {
+	s.command = command
+	s.event = event
+}
+
+// RunID returns the ID of the run's changes in the audit log
+func (s *Service) RunID() string {
+	return s.result.RunID
+}
+
+// AuditLog opens the audit log
+func (s *Service) AuditLog() (*audit.Log, error) {
+	return audit.Open(s.config.Audit)
+}
+
+// auditLog opens the audit log on first use.  Nil if it is disabled or
+// could not be opened.
+func (s *Service) auditLog() *audit.Log {
+	s.auditOnce.Do(func() {
+		if s.config.Audit.Disabled {
+			return
+		}
+		log, err := s.AuditLog()
+		if err != nil {
+			s.logger.Warn("could not open audit log", "error", err)
+			return
+		}
+		s.audit = log
+	})
+	return s.audit
+}
+
+// addChange records the change in the result and the audit log
+func (s *Service) addChange(c results.Change) {
+	s.result.AddChange(c)
+	s.auditChanges(nil, c)
+}
+
+// auditChanges appends the changes to the audit log with the error of
+// the call that made them
+func (s *Service) auditChanges(err error, changes ...results.Change) {
+	log := s.auditLog()
+	if log == nil || len(changes) == 0 {
+		return
+	}
+	entries := make([]audit.Entry, 0, len(changes))
+	for _, c := range changes {
+		e := audit.Entry{
+			RunID:      s.result.RunID,
+			Command:    s.command,
+			Event:      s.event,
+			Action:     c.Action,
+			System:     c.System,
+			ObjectType: objectType(c.System, c.Model),
+			Model:      c.Model,
+			ID:         c.ID,
+			Name:       c.Name,
+			Field:      c.Field,
+			Old:        c.Old,
+			New:        c.New,
+			Result:     audit.ResultOK,
+		}
+		if err != nil {
+			e.Result = audit.ResultFailed
+			e.Error = err.Error()
+		}
+		entries = append(entries, e)
+	}
+	if err := log.Append(entries...); err != nil {
+		s.logger.Warn("could not write audit log", "error", err)
+	}
+}
+
+// auditFailure records the fields a failed update tried to set
+func (s *Service) auditFailure(system string, model string, id int64, data map[string]any, err error) {
+	var changes []results.Change
+	for field, value := range data {
+		changes = append(changes, results.Change{Action: results.Update, System: system, Model: model, ID: id, Field: field, New: value})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	s.auditChanges(err, changes...)
+}
+
+// auditCreateFailure records a failed create of the named object
+func (s *Service) auditCreateFailure(system string, model string, name string, err error) {
+	s.auditChanges(err, results.Change{Action: results.Create, System: system, Model: model, Name: name})
+}
+
+// auditDeleteFailure records a failed delete of the object
+func (s *Service) auditDeleteFailure(system string, model string, id int64, name string, err error) {
+	s.auditChanges(err, results.Change{Action: results.Delete, System: system, Model: model, ID: id, Name: name})
+}
+
+// objectType returns the audit log object type of the model
+func objectType(system string, model string) string {
+	if system != results.Netbox {
+		return system + "." + model
+	}
+	return nbapi.ObjectType(model)
+}
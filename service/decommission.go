@@ -0,0 +1,116 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/rsapc/hookcmd/librenms"
+	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/hookcmd/results"
+	"github.com/rsapc/netbox"
+)
+
+// decommission actions
+const (
+	DecommissionDisable = "disable"
+	DecommissionDelete  = "delete"
+	DecommissionNone    = "none"
+)
+
+// defaultDecommissionStatuses leaves out offline, which DeviceDown sets
+// when LibreNMS alerts that a device is down
+var defaultDecommissionStatuses = []string{"decommissioning"}
+
+// Decommission handles a Netbox device or VM webhook.  When the status
+// changes to one of the decommission statuses, or the object is deleted,
+// the LibreNMS device is disabled or deleted as configured, the
+// monitoring_id is cleared and a journal entry is written.  The prechange
+// snapshot is used so nothing is done unless the status actually changed.
+func (s *Service) Decommission(payload string) error {
+	hook, err := models.ParseWebhook(payload)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return err
+	}
+	if hook.Model != "device" && hook.Model != "virtualmachine" {
+		return fmt.Errorf("%w: decommission expects a device or virtualmachine webhook, got %s", models.ErrValidation, hook.Model)
+	}
+	cfg := s.config.LibreNMS.Decommission
+	if slices.Contains(cfg.IgnoreUsers, hook.Username) {
+		s.logger.Debug("ignoring change by user", "user", hook.Username, "model", hook.Model, "id", hook.ID())
+		return nil
+	}
+	statuses := cfg.Statuses
+	if len(statuses) == 0 {
+		statuses = defaultDecommissionStatuses
+	}
+
+	var action, reason string
+	switch hook.Event {
+	case models.EventDeleted:
+		action = cfg.OnDelete
+		if action == "" {
+			action = DecommissionDelete
+		}
+		reason = "the object was deleted from Netbox"
+	case models.EventUpdated:
+		before, after := hook.Pre().Value("status"), hook.Post().Value("status")
+		if before == "" || before == after || !slices.Contains(statuses, after) || slices.Contains(statuses, before) {
+			return nil
+		}
+		action = cfg.OnStatus
+		if action == "" {
+			action = DecommissionDisable
+		}
+		reason = fmt.Sprintf("status changed from %s to %s", before, after)
+	default:
+		return nil
+	}
+
+	monitoringID := hook.Pre().CustomFields().Int("monitoring_id")
+	if monitoringID == 0 {
+		monitoringID = hook.Data.CustomFields().Int("monitoring_id")
+	}
+	if monitoringID == 0 {
+		s.logger.Info("object is not monitored", "model", hook.Model, "id", hook.ID())
+		return nil
+	}
+
+	switch action {
+	case DecommissionNone:
+		return nil
+	case DecommissionDisable:
+		err = s.updateLibreDevice(monitoringID, map[string]interface{}{"disabled": 1})
+	case DecommissionDelete:
+		if err = s.librenms.DeleteDevice(monitoringID); err == nil {
+			s.recordDelete(results.LibreNMS, "device", int64(monitoringID), "")
+		} else if !errors.Is(err, librenms.ErrNotFound) {
+			s.auditDeleteFailure(results.LibreNMS, "device", int64(monitoringID), "", err)
+		}
+	default:
+		return fmt.Errorf("%w: invalid decommission action %s", models.ErrValidation, action)
+	}
+	if err != nil && !errors.Is(err, librenms.ErrNotFound) {
+		s.logger.Error("could not decommission LibreNMS device", "device", monitoringID, "action", action, "error", err)
+		if hook.Event != models.EventDeleted {
+			s.netbox.AddJournalEntry(hook.Model, hook.ID(), netbox.WarningLevel, "could not %s LibreNMS device %d: %v", action, monitoringID, err)
+		}
+		return err
+	}
+	s.logger.Info("decommissioned LibreNMS device", "device", monitoringID, "action", action, "model", hook.Model, "id", hook.ID(), "reason", reason)
+	if hook.Event == models.EventDeleted {
+		return nil
+	}
+
+	data := map[string]interface{}{"custom_fields": map[string]interface{}{"monitoring_id": nil}}
+	if err = s.updateObject(hook.Model, hook.ID(), data); err != nil {
+		s.logger.Error("could not clear monitoring_id", "model", hook.Model, "id", hook.ID(), "error", err)
+		return err
+	}
+	verb := "disabled"
+	if action == DecommissionDelete {
+		verb = "deleted"
+	}
+	return s.netbox.AddJournalEntry(hook.Model, hook.ID(), netbox.InfoLevel, "%s LibreNMS device %d and cleared monitoring_id as %s", verb, monitoringID, reason)
+}
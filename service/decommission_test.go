@@ -0,0 +1,44 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/rsapc/hookcmd/models"
+)
+
+func TestDecommissionStatuses(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      map[string]any
+		from, to string
+		disabled bool
+	}{
+		{"decommissioning", nil, "active", "decommissioning", true},
+		{"offline from devicedown is not a decommission", nil, "active", "offline", false},
+		{"offline when configured", map[string]any{"librenms": map[string]any{
+			"decommission": map[string]any{"statuses": []string{"decommissioning", "offline"}}}}, "active", "offline", true},
+		{"already decommissioning", nil, "decommissioning", "decommissioning", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestService(t, tt.cfg)
+			ts.librenms.handle("GET /api/v0/devices/12", http.StatusOK, libreDevice(map[string]any{"device_id": 12, "hostname": "10.0.0.1", "disabled": 0}))
+			ts.librenms.handle("PATCH /api/v0/devices/12", http.StatusOK, map[string]any{"status": "ok"})
+			ts.netbox.handle("GET /api/dcim/devices/5/", http.StatusOK, map[string]any{"id": 5, "custom_fields": map[string]any{"monitoring_id": 12}})
+			ts.netbox.handle("PATCH /api/dcim/devices/5/", http.StatusOK, map[string]any{"id": 5})
+			ts.netbox.handle("POST /api/extras/journal-entries/", http.StatusCreated, map[string]any{"id": 1})
+
+			cf := map[string]any{"monitoring_id": 12}
+			pre := map[string]any{"id": 5, "status": tt.from, "custom_fields": cf}
+			post := map[string]any{"id": 5, "status": tt.to, "custom_fields": cf}
+			if err := ts.Decommission(webhook(t, models.EventUpdated, "device", "admin", pre, post)); err != nil {
+				t.Fatal(err)
+			}
+			patches := ts.librenms.called(http.MethodPatch, "/api/v0/devices/12")
+			if disabled := len(patches) == 1; disabled != tt.disabled {
+				t.Errorf("disabled=%t, want %t", disabled, tt.disabled)
+			}
+		})
+	}
+}
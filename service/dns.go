@@ -0,0 +1,203 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/hookcmd/nbapi"
+	"github.com/rsapc/netbox"
+)
+
+// cfDNSStatus is the IP address custom field recording the result of
+// the forward-confirmed reverse DNS check
+const cfDNSStatus = "dns_status"
+
+// dns_status values
+const (
+	DNSConfirmed = "confirmed"
+	DNSMismatch  = "mismatch"
+	DNSMissing   = "missing"
+)
+
+// reverseDNS is the result of a forward-confirmed reverse DNS lookup
+type reverseDNS struct {
+	// Names are the PTR names, sorted and without the trailing dot
+	Names []string
+	// Confirmed is the first name that resolves back to the address
+	Confirmed string
+}
+
+// Status returns the dns_status for an address with the given dns_name
+func (r reverseDNS) Status(dnsName string) string {
+	if len(r.Names) == 0 {
+		return DNSMissing
+	}
+	if r.Confirmed == "" {
+		return DNSMismatch
+	}
+	if dnsName != "" && !strings.EqualFold(dnsName, r.Confirmed) {
+		return DNSMismatch
+	}
+	return DNSConfirmed
+}
+
+// lookupReverseDNS does a PTR lookup of ip and checks each name resolves
+// back to it, using the resolvers configured for the VRF.  An address with
+// no PTR records is not an error.
+func (s *Service) lookupReverseDNS(ip string, vrf string) (result reverseDNS, err error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return result, err
+	}
+	names, err := s.resolvers.ForAddr(addr, vrf).LookupAddr(ip)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return result, nil
+		}
+		return result, err
+	}
+	for _, name := range names {
+		result.Names = append(result.Names, strings.TrimSuffix(name, "."))
+	}
+	sort.Strings(result.Names)
+	for _, name := range result.Names {
+		addrs, err := s.resolvers.ForName(name, vrf).LookupHost(name)
+		if err != nil {
+			s.logger.Debug("forward lookup failed", "name", name, "error", err)
+			continue
+		}
+		for _, a := range addrs {
+			if fwd, err := netip.ParseAddr(a); err == nil && fwd == addr {
+				result.Confirmed = name
+				return result, nil
+			}
+		}
+	}
+	return result, nil
+}
+
+// ensureDNSField adds the dns_status custom field to IP addresses
+func (s *Service) ensureDNSField() error {
+	if err := s.nbapi.EnsureCustomField(cfDNSStatus, "DNS status", "text", "ipam.ipaddress"); err != nil {
+		s.logger.Error("could not add custom field", "field", cfDNSStatus, "error", err)
+		return err
+	}
+	return nil
+}
+
+// updateIPDNS sets dns_status on the Netbox address and fills in an empty
+// dns_name with the forward-confirmed name
+func (s *Service) updateIPDNS(nbip nbapi.IPAddress, result reverseDNS) error {
+	status := result.Status(nbip.DNSName)
+	data := make(map[string]interface{})
+	if nbip.DNSName == "" && result.Confirmed != "" {
+		data["dns_name"] = result.Confirmed
+		status = DNSConfirmed
+	}
+	if current, _ := nbip.CustomFields[cfDNSStatus].(string); current != status {
+		data["custom_fields"] = map[string]interface{}{cfDNSStatus: status}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if status == DNSMismatch {
+		s.logger.Warn("DNS mismatch", "address", nbip.Address, "dns_name", nbip.DNSName, "ptr", result.Names)
+	}
+	return s.updateObject("ipaddress", int64(nbip.ID), data)
+}
+
+// refreshIPDNS looks up the Netbox address with the resolver for its VRF
+// and updates dns_name and dns_status
+func (s *Service) refreshIPDNS(nbip nbapi.IPAddress) error {
+	result, err := s.lookupReverseDNS(netbox.IPfromCIDR(nbip.Address), nbip.VRFName())
+	if err != nil {
+		s.logger.Error("could not look up address", "address", nbip.Address, "err", err)
+		return err
+	}
+	if err = s.updateIPDNS(nbip, result); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to update Netbox IPAddress record: %v", err), "address", nbip.Address)
+		return fmt.Errorf("failed to update Netbox IPAddress record %s: %w", nbip.Address, err)
+	}
+	return nil
+}
+
+// IPdnsUpdatePrefix refreshes the DNS of every Netbox address in prefix
+// with up to concurrency lookups at a time.  Failures do not stop the run;
+// they are returned together once every address has been processed.
+func (s *Service) IPdnsUpdatePrefix(prefix string, concurrency int) error {
+	if _, err := netip.ParsePrefix(prefix); err != nil {
+		return models.WithKind(fmt.Errorf("invalid prefix %s: %w", prefix, err), models.ErrValidation)
+	}
+	if err := s.ensureDNSField(); err != nil {
+		return err
+	}
+	nbips, err := s.nbapi.ListIPAddresses("parent=" + prefix)
+	if err != nil {
+		s.logger.Error("could not get Netbox addresses", "prefix", prefix, "err", err)
+		return err
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var wg sync.WaitGroup
+	var mux sync.Mutex
+	var errs []error
+	jobs := make(chan nbapi.IPAddress)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for nbip := range jobs {
+				if err := s.refreshIPDNS(nbip); err != nil {
+					mux.Lock()
+					errs = append(errs, err)
+					mux.Unlock()
+				}
+			}
+		}()
+	}
+	for _, nbip := range nbips {
+		jobs <- nbip
+	}
+	close(jobs)
+	wg.Wait()
+	s.logger.Info("refreshed DNS for prefix", "prefix", prefix, "addresses", len(nbips), "failed", len(errs))
+	return errors.Join(errs...)
+}
+
+// AuditDNS checks the reverse DNS of every Netbox address in prefix and
+// writes a CSV of the addresses whose records are missing or do not match
+func (s *Service) AuditDNS(out io.Writer, prefix string) error {
+	if _, err := netip.ParsePrefix(prefix); err != nil {
+		return models.WithKind(fmt.Errorf("invalid prefix %s: %w", prefix, err), models.ErrValidation)
+	}
+	ips, err := s.nbapi.ListIPAddresses("parent=" + prefix)
+	if err != nil {
+		s.logger.Error("could not get Netbox addresses", "prefix", prefix, "err", err)
+		return err
+	}
+	io.WriteString(out, "Address,DNS Name,PTR,Confirmed,Status\n")
+	for _, nbip := range ips {
+		addr := netbox.IPfromCIDR(nbip.Address)
+		result, err := s.lookupReverseDNS(addr, nbip.VRFName())
+		if err != nil {
+			s.logger.Warn("reverse lookup failed", "address", addr, "error", err)
+			io.WriteString(out, fmt.Sprintf("%s,%s,,,error\n", nbip.Address, nbip.DNSName))
+			continue
+		}
+		status := result.Status(nbip.DNSName)
+		if status == DNSConfirmed {
+			continue
+		}
+		io.WriteString(out, fmt.Sprintf("%s,%s,%s,%s,%s\n", nbip.Address, nbip.DNSName, strings.Join(result.Names, " "), result.Confirmed, status))
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/hookcmd/nbapi"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newResolverServer returns the address of a UDP nameserver answering
+// PTR and A queries from records (name -> values).  Other names are
+// NXDOMAIN.
+func newResolverServer(t *testing.T, records map[string][]string) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := resolverAnswer(buf[:n], records); resp != nil {
+				conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func resolverAnswer(msg []byte, records map[string][]string) []byte {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(msg)
+	if err != nil {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil
+	}
+	name := strings.TrimSuffix(strings.ToLower(q.Name.String()), ".")
+	values, found := records[name]
+	rcode := dnsmessage.RCodeSuccess
+	if !found {
+		rcode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: hdr.ID, Response: true, Authoritative: true, RCode: rcode})
+	b.EnableCompression()
+	b.StartQuestions()
+	b.Question(q)
+	b.StartAnswers()
+	rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+	for _, value := range values {
+		switch q.Type {
+		case dnsmessage.TypePTR:
+			b.PTRResource(rh, dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(value + ".")})
+		case dnsmessage.TypeA:
+			if ip := net.ParseIP(value).To4(); ip != nil {
+				var a [4]byte
+				copy(a[:], ip)
+				b.AResource(rh, dnsmessage.AResource{A: a})
+			}
+		}
+	}
+	resp, err := b.Finish()
+	if err != nil {
+		return nil
+	}
+	return resp
+}
+
+// dnsRecords are the zones served to the DNS tests
+var dnsRecords = map[string][]string{
+	"5.0.0.10.in-addr.arpa": {"host.example.com"},
+	"host.example.com":      {"10.0.0.5"},
+	// the PTR name points elsewhere
+	"6.0.0.10.in-addr.arpa": {"stale.example.com"},
+	"stale.example.com":     {"10.0.0.99"},
+}
+
+func newDNSTestService(t *testing.T) *testService {
+	server := newResolverServer(t, dnsRecords)
+	return newTestService(t, map[string]any{"dns": map[string]any{"default": map[string]any{"servers": []string{server}}}})
+}
+
+func TestLookupReverseDNS(t *testing.T) {
+	ts := newDNSTestService(t)
+	tests := []struct {
+		ip, dnsName string
+		confirmed   string
+		status      string
+	}{
+		{"10.0.0.5", "", "host.example.com", DNSConfirmed},
+		{"10.0.0.5", "HOST.example.com", "host.example.com", DNSConfirmed},
+		{"10.0.0.5", "other.example.com", "host.example.com", DNSMismatch},
+		{"10.0.0.6", "", "", DNSMismatch},
+		{"10.0.0.7", "", "", DNSMissing},
+	}
+	for _, tt := range tests {
+		result, err := ts.lookupReverseDNS(tt.ip, "")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.ip, err)
+		}
+		if result.Confirmed != tt.confirmed || result.Status(tt.dnsName) != tt.status {
+			t.Errorf("%s %q: got %+v %s, want %q %s", tt.ip, tt.dnsName, result, result.Status(tt.dnsName), tt.confirmed, tt.status)
+		}
+	}
+}
+
+func TestAuditDNS(t *testing.T) {
+	ts := newDNSTestService(t)
+	ts.netbox.handle("GET /api/ipam/ip-addresses/", http.StatusOK, netboxList(
+		map[string]any{"id": 1, "address": "10.0.0.5/24", "dns_name": "host.example.com"},
+		map[string]any{"id": 2, "address": "10.0.0.6/24", "dns_name": ""},
+		map[string]any{"id": 3, "address": "10.0.0.7/24", "dns_name": "gone.example.com"},
+	))
+	var out bytes.Buffer
+	if err := ts.AuditDNS(&out, "10.0.0.0/24"); err != nil {
+		t.Fatal(err)
+	}
+	want := "Address,DNS Name,PTR,Confirmed,Status\n" +
+		"10.0.0.6/24,,stale.example.com,,mismatch\n" +
+		"10.0.0.7/24,gone.example.com,,,missing\n"
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestUpdateIPDNSFillsName(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.netbox.handle("GET /api/ipam/ip-addresses/1/", http.StatusOK, map[string]any{"id": 1, "address": "10.0.0.5/24"})
+	ts.netbox.handle("PATCH /api/ipam/ip-addresses/1/", http.StatusOK, map[string]any{"id": 1})
+	result := reverseDNS{Names: []string{"host.example.com"}, Confirmed: "host.example.com"}
+	if err := ts.updateIPDNS(nbipAddress(1, "10.0.0.5/24", "", ""), result); err != nil {
+		t.Fatal(err)
+	}
+	patches := ts.netbox.called(http.MethodPatch, "/api/ipam/ip-addresses/1/")
+	if len(patches) != 1 || patches[0].Body["dns_name"] != "host.example.com" {
+		t.Fatalf("got %+v, want dns_name set", patches)
+	}
+	if cf, _ := patches[0].Body["custom_fields"].(map[string]any); cf[cfDNSStatus] != DNSConfirmed {
+		t.Errorf("dns_status = %v, want confirmed", cf[cfDNSStatus])
+	}
+
+	// nothing is written when the status is current
+	if err := ts.updateIPDNS(nbipAddress(1, "10.0.0.5/24", "host.example.com", DNSConfirmed), result); err != nil {
+		t.Fatal(err)
+	}
+	if patches = ts.netbox.called(http.MethodPatch, "/api/ipam/ip-addresses/1/"); len(patches) != 1 {
+		t.Errorf("got %d updates, want 1", len(patches))
+	}
+}
+
+func nbipAddress(id int, address string, dnsName string, status string) nbapi.IPAddress {
+	return nbapi.IPAddress{ID: id, Address: address, DNSName: dnsName, CustomFields: map[string]any{cfDNSStatus: status}}
+}
+
+func TestIPdnsUpdatePrefix(t *testing.T) {
+	custA := newResolverServer(t, map[string][]string{
+		"5.0.0.10.in-addr.arpa": {"vm.cust-a.example"},
+		"vm.cust-a.example":     {"10.0.0.5"},
+	})
+	ts := newTestService(t, map[string]any{"dns": map[string]any{
+		"default":   map[string]any{"servers": []string{newResolverServer(t, dnsRecords)}},
+		"resolvers": []any{map[string]any{"vrf": "cust-a", "servers": []string{custA}}},
+	}})
+	ts.netbox.handle("GET /api/extras/custom-fields/", http.StatusOK, netboxList(map[string]any{"id": 1}))
+	ts.netbox.handle("GET /api/ipam/ip-addresses/?parent=10.0.0.0/24", http.StatusOK, netboxList(
+		map[string]any{"id": 1, "address": "10.0.0.5/24"},
+		map[string]any{"id": 2, "address": "10.0.0.5/24", "vrf": map[string]any{"id": 4, "name": "cust-a"}},
+		map[string]any{"id": 3, "address": "10.0.0.7/24"},
+	))
+	for id := 1; id <= 3; id++ {
+		path := fmt.Sprintf("/api/ipam/ip-addresses/%d/", id)
+		ts.netbox.handle("GET "+path, http.StatusOK, map[string]any{"id": id})
+		ts.netbox.handle("PATCH "+path, http.StatusOK, map[string]any{"id": id})
+	}
+	ts.netbox.handle("PATCH /api/ipam/ip-addresses/3/", http.StatusInternalServerError, map[string]any{"detail": "database unavailable"})
+
+	err := ts.IPdnsUpdatePrefix("10.0.0.0/24", 2)
+	if err == nil || !strings.Contains(err.Error(), "10.0.0.7/24") {
+		t.Errorf("got %v, want the 10.0.0.7/24 error", err)
+	}
+	want := map[string]any{"/api/ipam/ip-addresses/1/": "host.example.com", "/api/ipam/ip-addresses/2/": "vm.cust-a.example"}
+	for path, name := range want {
+		patches := ts.netbox.called(http.MethodPatch, path)
+		if len(patches) != 1 || patches[0].Body["dns_name"] != name {
+			t.Errorf("%s: got %+v, want dns_name %s", path, patches, name)
+		}
+	}
+	if err = ts.IPdnsUpdatePrefix("10.0.0.0/33", 1); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("got %v for an invalid prefix, want a validation error", err)
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/hookcmd/results"
+	"github.com/rsapc/netbox"
+)
+
+// dnsRecord is the dns_name and address of a Netbox IP address
+type dnsRecord struct {
+	name string
+	addr netip.Addr
+}
+
+func recordFromSnapshot(snap models.Snapshot) (rec dnsRecord) {
+	if snap == nil {
+		return rec
+	}
+	rec.name = snap.String("dns_name")
+	if prefix, err := netip.ParsePrefix(snap.String("address")); err == nil {
+		rec.addr = prefix.Addr()
+	}
+	return rec
+}
+
+// DNSPush sends RFC 2136 updates for a Netbox IP address webhook so DNS
+// follows the dns_name in Netbox.  The prechange snapshot is used to
+// remove the old A/AAAA and PTR records when the name or address changes
+// or the address is deleted.
+func (s *Service) DNSPush(payload string) error {
+	hook, err := models.ParseWebhook(payload)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return err
+	}
+	if hook.Model != "ipaddress" {
+		return fmt.Errorf("%w: dnspush expects an ipaddress webhook, got %s", models.ErrValidation, hook.Model)
+	}
+	if !s.dnsupdate.Enabled() {
+		return fmt.Errorf("%w: no DNS update zones are configured", models.ErrValidation)
+	}
+	before := recordFromSnapshot(hook.Pre())
+	after := recordFromSnapshot(hook.Post())
+	if before == after {
+		return nil
+	}
+
+	var errs []error
+	var changes []string
+	// record audits the update as a change to the DNS record
+	record := func(err error, action string, model string, name string, summary string) {
+		c := results.Change{Action: action, System: results.DNS, Model: model, Name: name}
+		if err != nil {
+			errs = append(errs, err)
+			s.auditChanges(err, c)
+			return
+		}
+		s.addChange(c)
+		changes = append(changes, summary)
+	}
+	if before.name != "" && before.addr.IsValid() {
+		if after.name != before.name || after.addr != before.addr {
+			err = s.dnsupdate.RemoveAddress(before.name, before.addr)
+			record(err, results.Delete, "address", fmt.Sprintf("%s -> %s", before.name, before.addr),
+				fmt.Sprintf("removed %s -> %s", before.name, before.addr))
+		}
+		if after.addr != before.addr || after.name == "" {
+			err = s.dnsupdate.RemovePTR(before.addr, before.name)
+			record(err, results.Delete, "ptr", fmt.Sprintf("%s -> %s", before.addr, before.name),
+				fmt.Sprintf("removed PTR %s -> %s", before.addr, before.name))
+		}
+	}
+	if after.name != "" && after.addr.IsValid() {
+		err = s.dnsupdate.ReplaceAddress(after.name, after.addr)
+		record(err, results.Create, "address", fmt.Sprintf("%s -> %s", after.name, after.addr),
+			fmt.Sprintf("set %s -> %s", after.name, after.addr))
+		err = s.dnsupdate.ReplacePTR(after.addr, after.name)
+		record(err, results.Create, "ptr", fmt.Sprintf("%s -> %s", after.addr, after.name),
+			fmt.Sprintf("set PTR %s -> %s", after.addr, after.name))
+	}
+
+	if hook.Event != models.EventDeleted {
+		if len(errs) > 0 {
+			s.netbox.AddJournalEntry("ipaddress", hook.ID(), netbox.WarningLevel, "DNS update failed:\n\n%v", errors.Join(errs...))
+		} else if len(changes) > 0 {
+			s.netbox.AddJournalEntry("ipaddress", hook.ID(), netbox.SuccessLevel, "DNS updated:\n\n* %s", strings.Join(changes, "\n* "))
+		}
+	}
+	return errors.Join(errs...)
+}
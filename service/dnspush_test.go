@@ -0,0 +1,81 @@
+package service
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/rsapc/hookcmd/audit"
+	"github.com/rsapc/hookcmd/results"
+)
+
+// newDNSServer returns the address of a TCP nameserver that answers
+// every update with rcode
+func newDNSServer(t *testing.T, rcode byte) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			var size [2]byte
+			if _, err = io.ReadFull(conn, size[:]); err == nil {
+				msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+				if _, err = io.ReadFull(conn, msg); err == nil && len(msg) >= 12 {
+					// header only: same ID and opcode, QR set, no records
+					resp := make([]byte, 14)
+					binary.BigEndian.PutUint16(resp, 12)
+					copy(resp[2:4], msg[:2])
+					resp[4] = msg[2] | 0x80
+					resp[5] = rcode
+					conn.Write(resp)
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestDNSPushAudit(t *testing.T) {
+	const refused = 5
+	ts := newTestService(t, map[string]any{"dns": map[string]any{"updates": map[string]any{"zones": []any{
+		map[string]any{"zone": "example.com", "server": newDNSServer(t, 0)},
+		map[string]any{"zone": "10.in-addr.arpa", "server": newDNSServer(t, refused)},
+	}}}})
+	ts.netbox.handle("POST /api/extras/journal-entries/", http.StatusCreated, map[string]any{"id": 1})
+	pre := map[string]any{"id": 9, "address": "10.0.0.5/24", "dns_name": "old.example.com"}
+	post := map[string]any{"id": 9, "address": "10.0.0.5/24", "dns_name": "www.example.com"}
+
+	if err := ts.DNSPush(webhook(t, "updated", "ipaddress", "admin", pre, post)); err == nil {
+		t.Fatal("the refused PTR update was not returned")
+	}
+	want := []struct {
+		action string
+		model  string
+		name   string
+		result string
+	}{
+		{results.Delete, "address", "old.example.com -> 10.0.0.5", audit.ResultOK},
+		{results.Create, "address", "www.example.com -> 10.0.0.5", audit.ResultOK},
+		{results.Create, "ptr", "10.0.0.5 -> www.example.com", audit.ResultFailed},
+	}
+	entries := ts.auditEntries(t)
+	if len(entries) != len(want) {
+		t.Fatalf("got %d audit entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.Action != w.action || e.System != results.DNS || e.ObjectType != "dns."+w.model || e.Name != w.name || e.Result != w.result {
+			t.Errorf("entry %d = %+v, want %s %s %s %s", i, e, w.action, w.model, w.name, w.result)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/rsapc/hookcmd/config"
+	"github.com/rsapc/hookcmd/librenms"
+	"github.com/rsapc/hookcmd/nbapi"
+	"github.com/rsapc/netbox"
+)
+
+const (
+	cfSoftwareVersion  = "software_version"
+	defaultFirmwareTag = "firmware-noncompliant"
+)
+
+// FirmwareReportOptions control the firmware report
+type FirmwareReportOptions struct {
+	// Update writes the running version to the software_version custom
+	// field and tags the devices that are out of policy
+	Update bool
+}
+
+// monitoredObject is a Netbox device or VM with a monitoring_id
+type monitoredObject struct {
+	model string
+	nbapi.ObjectContext
+}
+
+// firmwareGroup counts the devices running a version on a platform
+type firmwareGroup struct {
+	platform string
+	version  string
+}
+
+// FirmwareReport groups the LibreNMS devices by platform and version and
+// compares them with the firmware policies in the config.  A CSV is
+// written to out with:
+//
+//	version: the number of devices running each version of a platform
+//	noncompliant: each device running a version its policy does not allow
+//
+// The platform and role come from the Netbox object with the device's
+// monitoring_id.  Devices not in Netbox use the LibreNMS OS as their
+// platform.  Devices with no matching policy are not reported as
+// noncompliant.  The report is written even when updating some devices
+// fails; the errors are returned together.
+func (s *Service) FirmwareReport(out io.Writer, opts FirmwareReportOptions) error {
+	devices, err := s.librenms.GetDevices()
+	if err != nil {
+		s.logger.Error("could not get LibreNMS devices", "err", err)
+		return err
+	}
+	objects := make(map[int]monitoredObject)
+	for _, model := range []string{"device", "virtualmachine"} {
+		list, err := s.nbapi.ListMonitored(model)
+		if err != nil {
+			s.logger.Error("could not get monitored Netbox objects", "model", model, "err", err)
+			return err
+		}
+		for _, obj := range list {
+			objects[obj.MonitoringID()] = monitoredObject{model, obj}
+		}
+	}
+	tag := s.config.Firmware.Tag
+	if tag == "" {
+		tag = defaultFirmwareTag
+	}
+	if opts.Update {
+		if err = s.ensureFirmwareFields(tag); err != nil {
+			return err
+		}
+	}
+
+	groups := make(map[firmwareGroup]int)
+	var noncompliant []string
+	var errs []error
+	for _, device := range devices {
+		version := ""
+		if device.Version != nil {
+			version = *device.Version
+		}
+		obj, inNetbox := objects[device.DeviceID]
+		platform := obj.PlatformSlug()
+		if platform == "" {
+			platform = device.Os
+		}
+		role := obj.RoleSlug()
+		groups[firmwareGroup{platform, version}]++
+
+		policy, ok := firmwarePolicy(s.config.Firmware.Policies, platform, role)
+		compliant := !ok || versionAllowed(policy.Versions, version)
+		if !compliant {
+			noncompliant = append(noncompliant, fmt.Sprintf("noncompliant,%s,%s,%s,%s,%s,\n", platform, role, version, deviceName(device, obj), strings.Join(policy.Versions, " ")))
+		}
+		if opts.Update && inNetbox {
+			if err = s.updateFirmware(obj, version, compliant, tag); err != nil {
+				s.logger.Warn("could not update firmware", "model", obj.model, "id", obj.ID, "error", err)
+				errs = append(errs, fmt.Errorf("%s %s: %w", obj.model, deviceName(device, obj), err))
+			}
+		}
+	}
+
+	keys := make([]firmwareGroup, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].platform != keys[j].platform {
+			return keys[i].platform < keys[j].platform
+		}
+		return keys[i].version < keys[j].version
+	})
+	sort.Strings(noncompliant)
+	io.WriteString(out, "Type,Platform,Role,Version,Device,Target,Devices\n")
+	for _, key := range keys {
+		io.WriteString(out, fmt.Sprintf("version,%s,,%s,,,%d\n", key.platform, key.version, groups[key]))
+	}
+	for _, line := range noncompliant {
+		io.WriteString(out, line)
+	}
+	return errors.Join(errs...)
+}
+
+// firmwarePolicy returns the first policy for the platform and role
+func firmwarePolicy(policies []config.FirmwarePolicy, platform string, role string) (config.FirmwarePolicy, bool) {
+	for _, p := range policies {
+		if p.Platform == platform && (p.Role == "" || p.Role == role) {
+			return p, true
+		}
+	}
+	return config.FirmwarePolicy{}, false
+}
+
+// versionAllowed returns true if version is one of the allowed versions.
+// An allowed version ending in * matches by prefix.
+func versionAllowed(allowed []string, version string) bool {
+	for _, v := range allowed {
+		if v == version {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(v, "*"); ok && strings.HasPrefix(version, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceName returns the Netbox name of the device, or the LibreNMS
+// display name or hostname
+func deviceName(device librenms.LibreDevice, obj monitoredObject) string {
+	if obj.Name != "" {
+		return obj.Name
+	}
+	if device.Display != nil && *device.Display != "" {
+		return *device.Display
+	}
+	return device.Hostname
+}
+
+// updateFirmware sets the software_version custom field and adds or
+// removes the noncompliant tag
+func (s *Service) updateFirmware(obj monitoredObject, version string, compliant bool, tag string) error {
+	data := make(map[string]interface{})
+	if current, _ := obj.CustomFields[cfSoftwareVersion].(string); current != version {
+		data["custom_fields"] = map[string]interface{}{cfSoftwareVersion: version}
+	}
+	if obj.HasTag(tag) == compliant {
+		tags := []nbapi.Tag{}
+		for _, t := range obj.Tags {
+			if t.Slug != tag {
+				tags = append(tags, nbapi.Tag{Slug: t.Slug})
+			}
+		}
+		if !compliant {
+			tags = append(tags, nbapi.Tag{Slug: tag})
+		}
+		data["tags"] = tags
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if err := s.updateObject(obj.model, int64(obj.ID), data); err != nil {
+		return err
+	}
+	if !compliant && data["tags"] != nil {
+		return s.netbox.AddJournalEntry(obj.model, int64(obj.ID), netbox.WarningLevel, "software version %s is not approved for this platform and role", version)
+	}
+	return nil
+}
+
+// ensureFirmwareFields adds the software_version custom field and the
+// noncompliant tag
+func (s *Service) ensureFirmwareFields(tag string) error {
+	if err := s.nbapi.EnsureCustomField(cfSoftwareVersion, "Software version", "text", "dcim.device", "virtualization.virtualmachine"); err != nil {
+		s.logger.Error("could not add custom field", "field", cfSoftwareVersion, "error", err)
+		return err
+	}
+	if err := s.nbapi.EnsureTag("Firmware noncompliant", tag); err != nil {
+		s.logger.Error("could not add tag", "tag", tag, "error", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rsapc/hookcmd/config"
+)
+
+func TestFirmwarePolicy(t *testing.T) {
+	policies := []config.FirmwarePolicy{
+		{Platform: "ios", Role: "core-switch", Versions: []string{"17.9.4"}},
+		{Platform: "ios", Versions: []string{"17.6.*"}},
+		// never reached: the platform policy above comes first
+		{Platform: "ios", Role: "access-switch", Versions: []string{"16.12.10"}},
+		{Platform: "junos", Role: "firewall", Versions: []string{"22.4R3"}},
+	}
+	tests := []struct {
+		platform, role string
+		want           string // first allowed version, empty for no policy
+	}{
+		{"ios", "core-switch", "17.9.4"},
+		{"ios", "access-switch", "17.6.*"},
+		{"ios", "", "17.6.*"},
+		{"junos", "firewall", "22.4R3"},
+		{"junos", "router", ""},
+		{"eos", "core-switch", ""},
+	}
+	for _, tt := range tests {
+		policy, ok := firmwarePolicy(policies, tt.platform, tt.role)
+		if got := strings.Join(policy.Versions, " "); ok != (tt.want != "") || got != tt.want {
+			t.Errorf("firmwarePolicy(%s, %s) = %q (%t), want %q", tt.platform, tt.role, got, ok, tt.want)
+		}
+	}
+}
+
+func TestVersionAllowed(t *testing.T) {
+	allowed := []string{"17.9.4", "17.6.*", "8.*"}
+	tests := map[string]bool{
+		"17.9.4":  true,
+		"17.9.4a": false,
+		"17.9":    false,
+		"17.6.5":  true,
+		"17.6.":   true,
+		"17.60.1": false,
+		"8":       false,
+		"8.2.1":   true,
+		"":        false,
+	}
+	for version, want := range tests {
+		if got := versionAllowed(allowed, version); got != want {
+			t.Errorf("versionAllowed(%q) = %t, want %t", version, got, want)
+		}
+	}
+	if versionAllowed(nil, "17.9.4") {
+		t.Error("a policy without versions allowed 17.9.4")
+	}
+	if !versionAllowed([]string{"*"}, "anything") {
+		t.Error("* did not allow every version")
+	}
+}
+
+func TestFirmwareReportUpdateErrors(t *testing.T) {
+	ts := newTestService(t, map[string]any{"firmware": map[string]any{"policies": []any{
+		map[string]any{"platform": "ios", "versions": []string{"17.9.*"}},
+	}}})
+	ts.librenms.handle("GET /api/v0/devices", http.StatusOK, map[string]any{"status": "ok", "count": 2, "devices": []any{
+		map[string]any{"device_id": 12, "hostname": "10.0.0.12", "os": "ios", "version": "17.6.5"},
+		map[string]any{"device_id": 13, "hostname": "10.0.0.13", "os": "ios", "version": "17.6.5"},
+	}})
+	device := func(id int, name string, monitoringID int) map[string]any {
+		return map[string]any{"id": id, "name": name, "platform": map[string]any{"slug": "ios"}, "custom_fields": map[string]any{"monitoring_id": monitoringID}}
+	}
+	ts.netbox.handle("GET /api/dcim/devices/", http.StatusOK, netboxList(device(5, "sw1", 12), device(6, "sw2", 13)))
+	ts.netbox.handle("GET /api/virtualization/virtual-machines/", http.StatusOK, netboxList())
+	ts.netbox.handle("GET /api/extras/custom-fields/", http.StatusOK, netboxList(map[string]any{"id": 1}))
+	ts.netbox.handle("GET /api/extras/tags/", http.StatusOK, netboxList(map[string]any{"id": 1}))
+	ts.netbox.handle("GET /api/dcim/devices/5/", http.StatusOK, device(5, "sw1", 12))
+	ts.netbox.handle("PATCH /api/dcim/devices/5/", http.StatusInternalServerError, map[string]any{"detail": "database unavailable"})
+	ts.netbox.handle("GET /api/dcim/devices/6/", http.StatusOK, device(6, "sw2", 13))
+	ts.netbox.handle("PATCH /api/dcim/devices/6/", http.StatusOK, map[string]any{"id": 6})
+	ts.netbox.handle("POST /api/extras/journal-entries/", http.StatusInternalServerError, map[string]any{"detail": "database unavailable"})
+
+	var out bytes.Buffer
+	err := ts.FirmwareReport(&out, FirmwareReportOptions{Update: true})
+	if err == nil || !strings.Contains(err.Error(), "device sw1") || !strings.Contains(err.Error(), "device sw2") {
+		t.Errorf("got %v, want the sw1 update and sw2 journal errors", err)
+	}
+	if !strings.Contains(out.String(), "version,ios,,17.6.5,,,2\n") || strings.Count(out.String(), "noncompliant,") != 2 {
+		t.Errorf("the report was not written:\n%s", out.String())
+	}
+	if patches := ts.netbox.called(http.MethodPatch, "/api/dcim/devices/6/"); len(patches) != 1 {
+		t.Errorf("got %d updates of sw2, want 1", len(patches))
+	}
+}
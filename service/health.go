@@ -0,0 +1,305 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rsapc/hookcmd/librenms"
+	"github.com/rsapc/hookcmd/nbapi"
+	"github.com/rsapc/netbox"
+)
+
+// custom fields written by SyncHealth
+const (
+	cfHealth       = "health"
+	cfHealthStatus = "health_status"
+	cfOpticLevels  = "optic_levels"
+)
+
+// storageWarnPercent is the storage usage reported as a warning
+const storageWarnPercent = 90
+
+// opticTolerance is the drift in dBm of an optic level that is not
+// written to Netbox
+const opticTolerance = 0.5
+
+// opticLevelPattern parses a level of the optic_levels custom field
+var opticLevelPattern = regexp.MustCompile(`^(.*) (-?[0-9.]+) dBm(?: \((\w+)\))?$`)
+
+// SyncHealth summarises the LibreNMS health sensors and storage usage of
+// the device in the health and health_status custom fields of the Netbox
+// object.  A journal entry is written whenever the summary changes.
+// Sensors outside their limits are listed without their reading and
+// state sensors (eg. PSU and fan states) with their state, so the summary
+// only changes when something changes state.  A state in warning or
+// critical raises the health_status like a sensor outside its limits.
+// Optic levels are written to the optic_levels custom field of each
+// Netbox interface.
+func (s *Service) SyncHealth(deviceID int) (err error) {
+	defer s.notifyFailure("health", deviceID, &err)
+	netboxType, netboxID, err := s.netbox.FindMonitoredObject(deviceID)
+	if err != nil {
+		s.logger.Error("could not find netbox device", "device_id", deviceID, "error", err)
+		return err
+	}
+	s.linkObjects(netboxType, netboxID, deviceID)
+	if err = s.ensureHealthFields(); err != nil {
+		return err
+	}
+	sensors, err := s.librenms.GetSensorsForDevice(deviceID)
+	if err != nil && !errors.Is(err, librenms.ErrNotFound) {
+		return err
+	}
+	storage, err := s.libreStorage(deviceID)
+	if err != nil {
+		s.logger.Warn("could not get storage from LibreNMS", "device", deviceID, "error", err)
+	}
+	status, summary := healthSummary(sensors, storage)
+	for _, line := range strings.Split(summary, "\n") {
+		if line != "" {
+			s.result.Summaryf("%s", strings.TrimPrefix(line, "- "))
+		}
+	}
+
+	cf, err := s.nbapi.GetCustomFields(netboxType, netboxID)
+	if err != nil {
+		return err
+	}
+	if prev, _ := cf[cfHealth].(string); prev != summary {
+		data := map[string]interface{}{"custom_fields": map[string]interface{}{cfHealth: summary, cfHealthStatus: status}}
+		if err = s.updateObject(netboxType, netboxID, data); err != nil {
+			s.logger.Error("could not update health", "model", netboxType, "id", netboxID, "error", err)
+			return err
+		}
+		level := netbox.SuccessLevel
+		switch status {
+		case librenms.SensorWarning:
+			level = netbox.WarningLevel
+		case librenms.SensorCritical:
+			level = netbox.DangerLevel
+		}
+		s.netbox.AddJournalEntry(netboxType, netboxID, level, "health changed\n\n%s", summary)
+	}
+	if netboxType == "device" {
+		return s.syncOpticLevels(deviceID, netboxID, sensors)
+	}
+	return nil
+}
+
+// healthSummary returns the overall status and a markdown summary of the
+// sensors and storage
+func healthSummary(sensors []librenms.Sensor, storage []librenms.HealthSensor) (string, string) {
+	status := librenms.SensorOK
+	var lines []string
+	raise := func(s string) {
+		if s == librenms.SensorCritical || (s == librenms.SensorWarning && status == librenms.SensorOK) {
+			status = s
+		}
+	}
+	for _, sensor := range sensors {
+		if sensor.SensorClass == "state" {
+			value := sensor.StateDescr
+			if value == "" {
+				value = fmt.Sprintf("%g", sensor.Value())
+			}
+			line := fmt.Sprintf("state %s = %s", sensor.SensorDescr, value)
+			if st := sensor.Status(); st != librenms.SensorOK {
+				raise(st)
+				line = st + ": " + line
+			}
+			lines = append(lines, "- "+line)
+			continue
+		}
+		if sensor.SensorClass == "dbm" && sensor.PortIfIndex() != 0 {
+			// reported per interface
+			continue
+		}
+		if st := sensor.Status(); st != librenms.SensorOK {
+			raise(st)
+			lines = append(lines, fmt.Sprintf("- %s: %s %s outside %s", st, sensor.SensorClass, sensor.SensorDescr, limitText(sensor)))
+		}
+	}
+	for _, st := range storage {
+		if st.Float("storage_perc") >= storageWarnPercent {
+			raise(librenms.SensorWarning)
+			lines = append(lines, fmt.Sprintf("- %s: storage %s over %d%% used", librenms.SensorWarning, st.String("storage_descr"), storageWarnPercent))
+		}
+	}
+	sort.Strings(lines)
+	summary := fmt.Sprintf("%s (%d sensors)", status, len(sensors))
+	if len(lines) > 0 {
+		summary += "\n\n" + strings.Join(lines, "\n")
+	}
+	return status, summary
+}
+
+// limitText describes the range a sensor is expected to be in
+func limitText(sensor librenms.Sensor) string {
+	low, high := "", ""
+	if sensor.SensorLimitLow != nil {
+		low = fmt.Sprintf("%g", *sensor.SensorLimitLow)
+	}
+	if sensor.SensorLimit != nil {
+		high = fmt.Sprintf("%g", *sensor.SensorLimit)
+	}
+	return fmt.Sprintf("[%s..%s]", low, high)
+}
+
+// libreStorage returns the storage entries of the device
+func (s *Service) libreStorage(deviceID int) (storage []librenms.HealthSensor, err error) {
+	graphs, err := s.librenms.GetHealth(deviceID, "device_storage")
+	if err != nil {
+		if errors.Is(err, librenms.ErrNotFound) {
+			return storage, nil
+		}
+		return storage, err
+	}
+	for _, graph := range graphs {
+		st, err := s.librenms.GetHealthSensor(deviceID, "device_storage", graph.SensorID)
+		if err != nil {
+			return storage, err
+		}
+		storage = append(storage, st)
+	}
+	return storage, nil
+}
+
+// syncOpticLevels writes the dBm readings of each port's transceiver to
+// the optic_levels custom field of the Netbox interface when a level was
+// added or removed, changed status or drifted more than opticTolerance
+// from the levels already there
+func (s *Service) syncOpticLevels(deviceID int, netboxID int64, sensors []librenms.Sensor) error {
+	optics := make(map[int][]librenms.Sensor)
+	for _, sensor := range sensors {
+		if sensor.SensorClass == "dbm" && sensor.PortIfIndex() != 0 {
+			optics[sensor.PortIfIndex()] = append(optics[sensor.PortIfIndex()], sensor)
+		}
+	}
+	if len(optics) == 0 {
+		return nil
+	}
+	ports, err := s.librenms.GetPortsForDevice(deviceID)
+	if err != nil {
+		return err
+	}
+	intfs, err := s.nbapi.ListInterfaces(netboxID)
+	if err != nil {
+		return err
+	}
+	nbInts := make(map[string]nbapi.Interface)
+	for _, intf := range intfs {
+		nbInts[intf.Name] = intf
+	}
+	for _, port := range ports {
+		readings, ok := optics[port.IfIndex]
+		if !ok {
+			continue
+		}
+		intf, ok := nbInts[port.IfName]
+		if !ok {
+			continue
+		}
+		var levels []opticLevel
+		for _, sensor := range readings {
+			level := opticLevel{descr: strings.TrimSpace(strings.TrimPrefix(sensor.SensorDescr, port.IfName)), dbm: sensor.Value()}
+			if st := sensor.Status(); st != librenms.SensorOK {
+				level.status = st
+			}
+			levels = append(levels, level)
+		}
+		current, _ := intf.CustomFields[cfOpticLevels].(string)
+		if !opticLevelsChanged(parseOpticLevels(current), levels) {
+			continue
+		}
+		data := map[string]interface{}{"custom_fields": map[string]interface{}{cfOpticLevels: formatOpticLevels(levels)}}
+		if err = s.updateObject("interface", int64(intf.ID), data); err != nil {
+			s.logger.Error("could not update optic levels", "interface", port.IfName, "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// opticLevel is a transceiver reading of an interface
+type opticLevel struct {
+	descr  string
+	dbm    float64
+	status string // empty when ok
+}
+
+func (l opticLevel) String() string {
+	s := fmt.Sprintf("%s %.1f dBm", l.descr, l.dbm)
+	if l.status != "" {
+		s += " (" + l.status + ")"
+	}
+	return s
+}
+
+// formatOpticLevels returns the optic_levels custom field value
+func formatOpticLevels(levels []opticLevel) string {
+	var values []string
+	for _, level := range levels {
+		values = append(values, level.String())
+	}
+	sort.Strings(values)
+	return strings.Join(values, "; ")
+}
+
+// parseOpticLevels reads the optic_levels custom field value.  Levels
+// that cannot be parsed are dropped.
+func parseOpticLevels(value string) (levels []opticLevel) {
+	for _, s := range strings.Split(value, "; ") {
+		m := opticLevelPattern.FindStringSubmatch(s)
+		if m == nil {
+			continue
+		}
+		dbm, _ := strconv.ParseFloat(m[2], 64)
+		levels = append(levels, opticLevel{descr: m[1], dbm: dbm, status: m[3]})
+	}
+	return levels
+}
+
+// opticLevelsChanged returns true if a level was added or removed,
+// changed status or drifted more than opticTolerance
+func opticLevelsChanged(current []opticLevel, levels []opticLevel) bool {
+	if len(current) != len(levels) {
+		return true
+	}
+	byDescr := func(l []opticLevel) []opticLevel {
+		l = append([]opticLevel{}, l...)
+		sort.SliceStable(l, func(i, j int) bool { return l[i].descr < l[j].descr })
+		return l
+	}
+	current, levels = byDescr(current), byDescr(levels)
+	for i, level := range levels {
+		prev := current[i]
+		if prev.descr != level.descr || prev.status != level.status || math.Abs(prev.dbm-level.dbm) > opticTolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureHealthFields adds the custom fields used by SyncHealth
+func (s *Service) ensureHealthFields() error {
+	fields := []struct {
+		name, label, cfType string
+		objectTypes         []string
+	}{
+		{cfHealth, "Health", "longtext", []string{"dcim.device", "virtualization.virtualmachine"}},
+		{cfHealthStatus, "Health status", "text", []string{"dcim.device", "virtualization.virtualmachine"}},
+		{cfOpticLevels, "Optic levels", "text", []string{"dcim.interface"}},
+	}
+	for _, field := range fields {
+		if err := s.nbapi.EnsureCustomField(field.name, field.label, field.cfType, field.objectTypes...); err != nil {
+			s.logger.Error("could not add custom field", "field", field.name, "error", err)
+			return err
+		}
+	}
+	return nil
+}
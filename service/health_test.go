@@ -0,0 +1,98 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rsapc/hookcmd/librenms"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func state(descr string, value int) librenms.Sensor {
+	return librenms.Sensor{SensorClass: "state", SensorDescr: descr, SensorCurrent: float(1), StateDescr: map[int]string{0: "normal", 1: "warning", 2: "faulty"}[value], StateGenericValue: &value}
+}
+
+func TestHealthSummaryStates(t *testing.T) {
+	temp := librenms.Sensor{SensorClass: "temperature", SensorDescr: "Inlet", SensorCurrent: float(30), SensorLimit: float(60)}
+	tests := []struct {
+		name    string
+		sensors []librenms.Sensor
+		status  string
+		line    string
+	}{
+		{"all normal", []librenms.Sensor{state("PSU1", 0), temp}, librenms.SensorOK, "- state PSU1 = normal"},
+		{"fan warning", []librenms.Sensor{state("PSU1", 0), state("Fan1", 1), temp}, librenms.SensorWarning, "- warning: state Fan1 = warning"},
+		{"psu critical", []librenms.Sensor{state("PSU1", 2), state("Fan1", 1), temp}, librenms.SensorCritical, "- critical: state PSU1 = faulty"},
+		{"untranslated state", []librenms.Sensor{{SensorClass: "state", SensorDescr: "PSU2", SensorCurrent: float(3)}}, librenms.SensorOK, "- state PSU2 = 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, summary := healthSummary(tt.sensors, nil)
+			if status != tt.status {
+				t.Errorf("got status %s, want %s", status, tt.status)
+			}
+			if !strings.Contains(summary, tt.line+"\n") && !strings.HasSuffix(summary, tt.line) {
+				t.Errorf("summary does not contain %q:\n%s", tt.line, summary)
+			}
+		})
+	}
+}
+
+func TestSyncOpticLevelsUnchanged(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.librenms.handle("GET /api/v0/ports/search/device_id/42", http.StatusOK, map[string]any{"status": "ok", "ports": []any{
+		map[string]any{"port_id": 1, "device_id": 42, "ifIndex": 49, "ifName": "Te1/1/1"},
+		map[string]any{"port_id": 2, "device_id": 42, "ifIndex": 50, "ifName": "Te1/1/2"},
+	}})
+	ts.netbox.handle("GET /api/dcim/interfaces/", http.StatusOK, map[string]any{"count": 2, "results": []any{
+		map[string]any{"id": 101, "name": "Te1/1/1", "custom_fields": map[string]any{cfOpticLevels: "Rx Power -2.8 dBm"}},
+		map[string]any{"id": 102, "name": "Te1/1/2", "custom_fields": map[string]any{cfOpticLevels: nil}},
+	}})
+	ts.netbox.handle("GET /api/dcim/interfaces/102/", http.StatusOK, map[string]any{"id": 102, "name": "Te1/1/2", "custom_fields": map[string]any{cfOpticLevels: nil}})
+	ts.netbox.handle("PATCH /api/dcim/interfaces/102/", http.StatusOK, map[string]any{"id": 102})
+
+	ports := "ports"
+	sensors := []librenms.Sensor{
+		{SensorClass: "dbm", SensorDescr: "Te1/1/1 Rx Power", SensorCurrent: float(-2.5), EntPhysicalIndex: float64(49), EntPhysicalIndexMeasured: &ports},
+		{SensorClass: "dbm", SensorDescr: "Te1/1/2 Rx Power", SensorCurrent: float(-3.1), EntPhysicalIndex: float64(50), EntPhysicalIndexMeasured: &ports},
+	}
+	if err := ts.syncOpticLevels(42, 7, sensors); err != nil {
+		t.Fatal(err)
+	}
+	writes := ts.netbox.writes()
+	if len(writes) != 1 || writes[0].Path != "/api/dcim/interfaces/102/" {
+		t.Fatalf("got writes %+v, want only interface 102", writes)
+	}
+	cf, _ := writes[0].Body["custom_fields"].(map[string]any)
+	if cf[cfOpticLevels] != "Rx Power -3.1 dBm" {
+		t.Errorf("got %v", cf)
+	}
+}
+
+func TestOpticLevelsChanged(t *testing.T) {
+	current := "Rx Power -3.1 dBm; Tx Power -2.4 dBm (warning)"
+	tests := []struct {
+		name    string
+		levels  []opticLevel
+		changed bool
+	}{
+		{"same", []opticLevel{{"Tx Power", -2.4, "warning"}, {"Rx Power", -3.1, ""}}, false},
+		{"drift", []opticLevel{{"Rx Power", -3.53, ""}, {"Tx Power", -2.1, "warning"}}, false},
+		{"over tolerance", []opticLevel{{"Rx Power", -3.7, ""}, {"Tx Power", -2.4, "warning"}}, true},
+		{"status", []opticLevel{{"Rx Power", -3.1, ""}, {"Tx Power", -2.4, ""}}, true},
+		{"removed", []opticLevel{{"Rx Power", -3.1, ""}}, true},
+		{"renamed", []opticLevel{{"Rx Power Lane 1", -3.1, ""}, {"Tx Power", -2.4, "warning"}}, true},
+	}
+	for _, tt := range tests {
+		if got := opticLevelsChanged(parseOpticLevels(current), tt.levels); got != tt.changed {
+			t.Errorf("%s: got %t, want %t", tt.name, got, tt.changed)
+		}
+	}
+	if got := formatOpticLevels(parseOpticLevels(current)); got != current {
+		t.Errorf("formatted %q, want %q", got, current)
+	}
+}
@@ -0,0 +1,357 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rsapc/hookcmd/librenms"
+	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/hookcmd/nbapi"
+	"github.com/rsapc/hookcmd/results"
+	"github.com/rsapc/netbox"
+)
+
+// custom fields written by SyncInventory
+const (
+	// cfInventoryMissing marks inventory items LibreNMS no longer reports
+	cfInventoryMissing = "inventory_missing"
+	// cfInventoryDiscovered marks the modules hookcmd installed, like the
+	// discovered flag of inventory items
+	cfInventoryDiscovered = "inventory_discovered"
+)
+
+// what happens to items that are no longer found
+const (
+	InventoryMark   = "mark"
+	InventoryDelete = "delete"
+)
+
+// inventoryClasses are imported even without a serial number.  Other
+// entries (eg. transceivers) are only imported when they have a serial.
+var inventoryClasses = []string{"chassis", "module", "powerSupply", "fan"}
+
+// Netbox field lengths
+const (
+	maxNameLength        = 64
+	maxDescriptionLength = 200
+)
+
+// SyncInventory imports the ENTITY-MIB inventory LibreNMS discovered on
+// the device.  Modules whose Netbox module bay (matched by the entry or
+// its container name) exists and whose module type (matched by model) is
+// defined are installed as modules.  Everything else becomes an inventory
+// item, matched by name; an item of that name added by hand (not
+// discovered) is not changed.  Serial changes are journalled so RMA'd
+// parts can be tracked.
+//
+// Items hookcmd created that are no longer reported are marked with the
+// inventory_missing custom field (modules are set offline), or deleted
+// when the inventory missing policy is delete.  Modules hookcmd installed
+// are marked with the inventory_discovered custom field; other modules
+// are left alone.
+func (s *Service) SyncInventory(deviceID int) (err error) {
+	defer s.notifyFailure("inventory", deviceID, &err)
+	netboxType, netboxID, err := s.netbox.FindMonitoredObject(deviceID)
+	if err != nil {
+		s.logger.Error("could not find netbox device", "device_id", deviceID, "error", err)
+		return err
+	}
+	s.linkObjects(netboxType, netboxID, deviceID)
+	if netboxType != "device" {
+		return fmt.Errorf("%w: inventory can only be imported for devices, %d is a %s", models.ErrValidation, deviceID, netboxType)
+	}
+	entries, err := s.librenms.GetInventory(deviceID)
+	if err != nil {
+		if errors.Is(err, librenms.ErrNotFound) {
+			s.logger.Warn("no inventory found for device", "device", deviceID)
+			return nil
+		}
+		return err
+	}
+	if err = s.nbapi.EnsureCustomField(cfInventoryMissing, "Missing from LibreNMS", "boolean", "dcim.inventoryitem"); err != nil {
+		s.logger.Error("could not add custom field", "field", cfInventoryMissing, "error", err)
+		return err
+	}
+	if err = s.nbapi.EnsureCustomField(cfInventoryDiscovered, "Discovered by LibreNMS", "boolean", "dcim.module"); err != nil {
+		s.logger.Error("could not add custom field", "field", cfInventoryDiscovered, "error", err)
+		return err
+	}
+	bays, err := s.nbapi.ListModuleBays(netboxID)
+	if err != nil {
+		return err
+	}
+	modules, err := s.nbapi.ListModules(netboxID)
+	if err != nil {
+		return err
+	}
+	items, err := s.nbapi.ListInventoryItems(netboxID)
+	if err != nil {
+		return err
+	}
+
+	sync := inventorySync{
+		s:           s,
+		deviceID:    netboxID,
+		names:       inventoryNames(entries),
+		byIndex:     make(map[int]librenms.InventoryEntry),
+		bays:        make(map[string]nbapi.ModuleBay),
+		modules:     make(map[int]nbapi.Module),
+		items:       make(map[string]nbapi.InventoryItem),
+		seenModules: make(map[int]bool),
+		seenItems:   make(map[int]bool),
+	}
+	for _, e := range entries {
+		sync.byIndex[e.EntPhysicalIndex] = e
+	}
+	for _, bay := range bays {
+		sync.bays[bay.Name] = bay
+	}
+	for _, m := range modules {
+		if m.ModuleBay != nil {
+			sync.modules[m.ModuleBay.ID] = m
+		}
+	}
+	for _, item := range items {
+		sync.items[item.Name] = item
+	}
+
+	for _, e := range entries {
+		if e.EntPhysicalSerialNum == "" && !slices.Contains(inventoryClasses, e.EntPhysicalClass) {
+			continue
+		}
+		if e.EntPhysicalClass == "module" && e.EntPhysicalModelName != "" {
+			installed, err := sync.module(e)
+			if err != nil {
+				return err
+			}
+			if installed {
+				continue
+			}
+		}
+		if err = sync.item(e); err != nil {
+			return err
+		}
+	}
+	if err = sync.missing(modules, items); err != nil {
+		return err
+	}
+
+	s.logger.Info("synced inventory", "device", deviceID, "changes", len(sync.changes))
+	for _, change := range sync.changes {
+		s.result.Summaryf("%s", change)
+	}
+	if len(sync.changes) == 0 {
+		return nil
+	}
+	return s.netbox.AddJournalEntry(netboxType, netboxID, netbox.InfoLevel, "inventory updated from LibreNMS\n\n* %s", strings.Join(sync.changes, "\n* "))
+}
+
+// inventorySync holds the state of a SyncInventory run
+type inventorySync struct {
+	s        *Service
+	deviceID int64
+	// names are the unique Netbox names by entPhysicalIndex
+	names       map[int]string
+	byIndex     map[int]librenms.InventoryEntry
+	bays        map[string]nbapi.ModuleBay
+	modules     map[int]nbapi.Module // by module bay ID
+	items       map[string]nbapi.InventoryItem
+	seenModules map[int]bool
+	seenItems   map[int]bool
+	changes     []string
+}
+
+// module installs or updates the module in its bay.  Returns false if
+// there is no matching bay or module type.  A module already in the bay
+// is seen even when its type is not defined so it is not reported
+// missing.
+func (sync *inventorySync) module(e librenms.InventoryEntry) (bool, error) {
+	bay, ok := sync.bays[e.EntPhysicalName]
+	if !ok {
+		container, found := sync.byIndex[e.EntPhysicalContainedIn]
+		if bay, ok = sync.bays[container.EntPhysicalName]; !found || !ok {
+			return false, nil
+		}
+	}
+	existing, installed := sync.modules[bay.ID]
+	if installed {
+		sync.seenModules[existing.ID] = true
+	}
+	mt, err := sync.s.nbapi.FindModuleType(e.EntPhysicalModelName)
+	if err != nil {
+		if errors.Is(err, nbapi.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !installed {
+		data := map[string]interface{}{
+			"device":           sync.deviceID,
+			"module_bay":       bay.ID,
+			"module_type":      mt.ID,
+			"serial":           e.EntPhysicalSerialNum,
+			"status":           "active",
+			"adopt_components": true,
+			"custom_fields":    map[string]interface{}{cfInventoryDiscovered: true},
+		}
+		name := fmt.Sprintf("%s in %s", mt.Model, bay.Name)
+		added, err := sync.s.nbapi.AddModule(data)
+		if err != nil {
+			sync.s.logger.Error("could not add module", "bay", bay.Name, "model", mt.Model, "error", err)
+			sync.s.auditCreateFailure(results.Netbox, "module", name, err)
+			return false, err
+		}
+		sync.s.recordCreate(results.Netbox, "module", int64(added.ID), name)
+		sync.changes = append(sync.changes, fmt.Sprintf("installed %s (serial %s) in %s", mt.Model, e.EntPhysicalSerialNum, bay.Name))
+		return true, nil
+	}
+	data := make(map[string]interface{})
+	if existing.Serial != e.EntPhysicalSerialNum {
+		data["serial"] = e.EntPhysicalSerialNum
+		sync.changes = append(sync.changes, fmt.Sprintf("module in %s serial changed from %s to %s", bay.Name, existing.Serial, e.EntPhysicalSerialNum))
+	}
+	if existing.ModuleType == nil || existing.ModuleType.ID != mt.ID {
+		data["module_type"] = mt.ID
+		sync.changes = append(sync.changes, fmt.Sprintf("module in %s is now %s", bay.Name, mt.Model))
+	}
+	if existing.Status.Value != "active" {
+		data["status"] = "active"
+		sync.changes = append(sync.changes, fmt.Sprintf("module in %s is back", bay.Name))
+	}
+	if len(data) == 0 {
+		return true, nil
+	}
+	return true, sync.s.updateObject("module", int64(existing.ID), data)
+}
+
+// item adds or updates the inventory item for the entry.  Items with the
+// same name that were not discovered are left alone.
+func (sync *inventorySync) item(e librenms.InventoryEntry) error {
+	name := sync.names[e.EntPhysicalIndex]
+	data := map[string]interface{}{
+		"part_id":       e.EntPhysicalModelName,
+		"serial":        e.EntPhysicalSerialNum,
+		"description":   truncate(e.EntPhysicalDescr, maxDescriptionLength),
+		"custom_fields": map[string]interface{}{cfInventoryMissing: false},
+	}
+	existing, ok := sync.items[name]
+	if !ok {
+		data["device"] = sync.deviceID
+		data["name"] = name
+		data["discovered"] = true
+		added, err := sync.s.nbapi.AddInventoryItem(data)
+		if err != nil {
+			sync.s.logger.Error("could not add inventory item", "name", name, "error", err)
+			sync.s.auditCreateFailure(results.Netbox, "inventoryitem", name, err)
+			return err
+		}
+		sync.s.recordCreate(results.Netbox, "inventoryitem", int64(added.ID), name)
+		sync.changes = append(sync.changes, fmt.Sprintf("added %s %s (serial %s)", name, e.EntPhysicalModelName, e.EntPhysicalSerialNum))
+		return nil
+	}
+	if !existing.Discovered {
+		// added by hand; LibreNMS does not own it
+		sync.s.logger.Info("inventory item was not discovered, not updated", "name", name, "id", existing.ID)
+		sync.s.result.Summaryf("%s not updated: the Netbox item was not discovered", name)
+		return nil
+	}
+	sync.seenItems[existing.ID] = true
+	missing, _ := existing.CustomFields[cfInventoryMissing].(bool)
+	if existing.Serial == e.EntPhysicalSerialNum && existing.PartID == e.EntPhysicalModelName &&
+		existing.Description == data["description"] && !missing {
+		return nil
+	}
+	if existing.Serial != e.EntPhysicalSerialNum {
+		sync.changes = append(sync.changes, fmt.Sprintf("%s serial changed from %s to %s", name, existing.Serial, e.EntPhysicalSerialNum))
+	}
+	if missing {
+		sync.changes = append(sync.changes, fmt.Sprintf("%s is back", name))
+	}
+	return sync.s.updateObject("inventoryitem", int64(existing.ID), data)
+}
+
+// missing marks or deletes the discovered items and modules that were
+// not reported this time.  Items and modules hookcmd did not create are
+// never changed.
+func (sync *inventorySync) missing(modules []nbapi.Module, items []nbapi.InventoryItem) error {
+	remove := sync.s.config.Inventory.Missing == InventoryDelete
+	for _, item := range items {
+		if !item.Discovered || sync.seenItems[item.ID] {
+			continue
+		}
+		if remove {
+			if err := sync.s.nbapi.DeleteInventoryItem(item.ID); err != nil {
+				sync.s.auditDeleteFailure(results.Netbox, "inventoryitem", int64(item.ID), item.Name, err)
+				return err
+			}
+			sync.s.recordDelete(results.Netbox, "inventoryitem", int64(item.ID), item.Name)
+			sync.changes = append(sync.changes, fmt.Sprintf("removed missing %s (serial %s)", item.Name, item.Serial))
+			continue
+		}
+		if missing, _ := item.CustomFields[cfInventoryMissing].(bool); missing {
+			continue
+		}
+		data := map[string]interface{}{"custom_fields": map[string]interface{}{cfInventoryMissing: true}}
+		if err := sync.s.updateObject("inventoryitem", int64(item.ID), data); err != nil {
+			return err
+		}
+		sync.changes = append(sync.changes, fmt.Sprintf("%s (serial %s) is missing", item.Name, item.Serial))
+	}
+	for _, m := range modules {
+		if discovered, _ := m.CustomFields[cfInventoryDiscovered].(bool); !discovered || sync.seenModules[m.ID] || m.ModuleBay == nil {
+			continue
+		}
+		if remove {
+			if err := sync.s.nbapi.DeleteModule(m.ID); err != nil {
+				sync.s.auditDeleteFailure(results.Netbox, "module", int64(m.ID), m.ModuleBay.Name, err)
+				return err
+			}
+			sync.s.recordDelete(results.Netbox, "module", int64(m.ID), m.ModuleBay.Name)
+			sync.changes = append(sync.changes, fmt.Sprintf("removed missing module from %s (serial %s)", m.ModuleBay.Name, m.Serial))
+			continue
+		}
+		if m.Status.Value == "offline" {
+			continue
+		}
+		if err := sync.s.updateObject("module", int64(m.ID), map[string]interface{}{"status": "offline"}); err != nil {
+			return err
+		}
+		sync.changes = append(sync.changes, fmt.Sprintf("module in %s (serial %s) is missing", m.ModuleBay.Name, m.Serial))
+	}
+	return nil
+}
+
+// inventoryNames gives each entry a unique Netbox name: the entity name,
+// else its description, else its class and index
+func inventoryNames(entries []librenms.InventoryEntry) map[int]string {
+	names := make(map[int]string)
+	used := make(map[string]bool)
+	for _, e := range entries {
+		name := e.EntPhysicalName
+		if name == "" {
+			name = e.EntPhysicalDescr
+		}
+		if name == "" {
+			name = fmt.Sprintf("%s %d", e.EntPhysicalClass, e.EntPhysicalIndex)
+		}
+		name = truncate(name, maxNameLength)
+		if used[name] {
+			suffix := fmt.Sprintf(" (%d)", e.EntPhysicalIndex)
+			name = truncate(name, maxNameLength-len(suffix)) + suffix
+		}
+		used[name] = true
+		names[e.EntPhysicalIndex] = name
+	}
+	return names
+}
+
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rsapc/hookcmd/audit"
+	"github.com/rsapc/hookcmd/results"
+)
+
+func TestSyncInventoryMissingModules(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.netbox.handle("GET /api/dcim/devices/", http.StatusOK, netboxList(map[string]any{"id": 7}))
+	ts.netbox.handle("GET /api/extras/custom-fields/", http.StatusOK, netboxList(map[string]any{"id": 1}))
+	ts.netbox.handle("GET /api/dcim/module-bays/", http.StatusOK, netboxList(
+		map[string]any{"id": 1, "name": "Slot 1"},
+		map[string]any{"id": 2, "name": "Slot 2"},
+		map[string]any{"id": 3, "name": "Slot 3"},
+		map[string]any{"id": 4, "name": "Slot 4"},
+	))
+	discovered := map[string]any{cfInventoryDiscovered: true}
+	module := func(id int, bay int, serial string, cf map[string]any) map[string]any {
+		return map[string]any{"id": id, "module_bay": map[string]any{"id": bay, "name": "Slot"}, "module_type": map[string]any{"id": 5, "model": "WS-X1"},
+			"serial": serial, "status": map[string]any{"value": "active", "label": "Active"}, "custom_fields": cf}
+	}
+	ts.netbox.handle("GET /api/dcim/modules/", http.StatusOK, netboxList(
+		// reported with a known type
+		module(11, 1, "S1", discovered),
+		// reported but its type is not defined in Netbox
+		module(12, 2, "S2", discovered),
+		// added by hand and not reported
+		module(13, 3, "S3", map[string]any{cfInventoryDiscovered: nil}),
+		// installed by hookcmd and no longer reported
+		module(14, 4, "S4", discovered),
+	))
+	ts.netbox.handle("GET /api/dcim/module-types/?model=WS-X1", http.StatusOK, netboxList(map[string]any{"id": 5, "model": "WS-X1"}))
+	ts.netbox.handle("GET /api/dcim/module-types/", http.StatusOK, netboxList())
+	ts.netbox.handle("GET /api/dcim/inventory-items/", http.StatusOK, netboxList())
+	ts.netbox.handle("POST /api/dcim/inventory-items/", http.StatusCreated, map[string]any{"id": 50})
+	ts.netbox.handle("GET /api/dcim/modules/14/", http.StatusOK, module(14, 4, "S4", discovered))
+	ts.netbox.handle("PATCH /api/dcim/modules/14/", http.StatusOK, map[string]any{"id": 14})
+	ts.netbox.handle("POST /api/extras/journal-entries/", http.StatusCreated, map[string]any{"id": 1})
+	ts.librenms.handle("GET /api/v0/inventory/42/all", http.StatusOK, map[string]any{"status": "ok", "count": 2, "inventory": []any{
+		map[string]any{"entPhysicalIndex": 1001, "entPhysicalClass": "module", "entPhysicalName": "Slot 1", "entPhysicalModelName": "WS-X1", "entPhysicalSerialNum": "S1"},
+		map[string]any{"entPhysicalIndex": 1002, "entPhysicalClass": "module", "entPhysicalName": "Slot 2", "entPhysicalModelName": "WS-UNKNOWN", "entPhysicalSerialNum": "S2"},
+	}})
+
+	if err := ts.SyncInventory(42); err != nil {
+		t.Fatal(err)
+	}
+	var changed []string
+	for _, req := range ts.netbox.writes() {
+		if req.Path != "/api/extras/journal-entries/" {
+			changed = append(changed, req.Method+" "+req.Path)
+		}
+	}
+	want := []string{"POST /api/dcim/inventory-items/", "PATCH /api/dcim/modules/14/"}
+	if len(changed) != len(want) || changed[0] != want[0] || changed[1] != want[1] {
+		t.Fatalf("got changes %v, want %v", changed, want)
+	}
+	if status := ts.netbox.called(http.MethodPatch, "/api/dcim/modules/14/")[0].Body["status"]; status != "offline" {
+		t.Errorf("module 14 status set to %v, want offline", status)
+	}
+}
+
+func TestSyncInventoryAuditsModules(t *testing.T) {
+	ts := newTestService(t, map[string]any{"inventory": map[string]any{"missing": InventoryDelete}})
+	ts.netbox.handle("GET /api/dcim/devices/", http.StatusOK, netboxList(map[string]any{"id": 7}))
+	ts.netbox.handle("GET /api/extras/custom-fields/", http.StatusOK, netboxList(map[string]any{"id": 1}))
+	ts.netbox.handle("GET /api/dcim/module-bays/", http.StatusOK, netboxList(
+		map[string]any{"id": 1, "name": "Slot 1"},
+		map[string]any{"id": 4, "name": "Slot 4"},
+	))
+	ts.netbox.handle("GET /api/dcim/modules/", http.StatusOK, netboxList(
+		map[string]any{"id": 14, "module_bay": map[string]any{"id": 4, "name": "Slot 4"}, "module_type": map[string]any{"id": 5, "model": "WS-X1"},
+			"serial": "S4", "status": map[string]any{"value": "active", "label": "Active"}, "custom_fields": map[string]any{cfInventoryDiscovered: true}},
+	))
+	ts.netbox.handle("GET /api/dcim/module-types/?model=WS-X1", http.StatusOK, netboxList(map[string]any{"id": 5, "model": "WS-X1"}))
+	ts.netbox.handle("GET /api/dcim/inventory-items/", http.StatusOK, netboxList())
+	ts.netbox.handle("POST /api/dcim/modules/", http.StatusCreated, map[string]any{"id": 60})
+	ts.netbox.handle("DELETE /api/dcim/modules/14/", http.StatusInternalServerError, map[string]any{"detail": "database unavailable"})
+	ts.netbox.handle("POST /api/extras/journal-entries/", http.StatusCreated, map[string]any{"id": 1})
+	ts.librenms.handle("GET /api/v0/inventory/42/all", http.StatusOK, map[string]any{"status": "ok", "count": 1, "inventory": []any{
+		map[string]any{"entPhysicalIndex": 1001, "entPhysicalClass": "module", "entPhysicalName": "Slot 1", "entPhysicalModelName": "WS-X1", "entPhysicalSerialNum": "S1"},
+	}})
+
+	if err := ts.SyncInventory(42); err == nil {
+		t.Fatal("the failed delete was not returned")
+	}
+	entries := ts.auditEntries(t)
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2: %+v", len(entries), entries)
+	}
+	if e := entries[0]; e.Action != results.Create || e.ObjectType != "dcim.module" || e.ID != 60 || e.Result != audit.ResultOK {
+		t.Errorf("got %+v, want module 60 created", e)
+	}
+	if e := entries[1]; e.Action != results.Delete || e.ID != 14 || e.Result != audit.ResultFailed || e.Error == "" {
+		t.Errorf("got %+v, want the failed delete of module 14", e)
+	}
+}
+
+func TestSyncInventoryItems(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.netbox.handle("GET /api/dcim/devices/", http.StatusOK, netboxList(map[string]any{"id": 7}))
+	ts.netbox.handle("GET /api/extras/custom-fields/", http.StatusOK, netboxList(map[string]any{"id": 1}))
+	ts.netbox.handle("GET /api/dcim/module-bays/", http.StatusOK, netboxList())
+	ts.netbox.handle("GET /api/dcim/modules/", http.StatusOK, netboxList())
+	ts.netbox.handle("GET /api/dcim/inventory-items/", http.StatusOK, netboxList(
+		// added by hand
+		map[string]any{"id": 21, "name": "PSU 1", "serial": "HAND1", "discovered": false},
+		map[string]any{"id": 22, "name": "Fan 1", "serial": "F1", "discovered": true, "custom_fields": map[string]any{cfInventoryMissing: false}},
+	))
+	ts.netbox.handle("GET /api/dcim/inventory-items/22/", http.StatusOK, map[string]any{"id": 22, "name": "Fan 1", "serial": "F1"})
+	ts.netbox.handle("PATCH /api/dcim/inventory-items/22/", http.StatusOK, map[string]any{"id": 22})
+	ts.netbox.handle("POST /api/dcim/inventory-items/", http.StatusCreated, map[string]any{"id": 50})
+	ts.netbox.handle("POST /api/extras/journal-entries/", http.StatusCreated, map[string]any{"id": 1})
+	descr := strings.Repeat("é", maxDescriptionLength+10)
+	ts.librenms.handle("GET /api/v0/inventory/42/all", http.StatusOK, map[string]any{"status": "ok", "count": 3, "inventory": []any{
+		map[string]any{"entPhysicalIndex": 1, "entPhysicalClass": "powerSupply", "entPhysicalName": "PSU 1", "entPhysicalSerialNum": "P1"},
+		map[string]any{"entPhysicalIndex": 2, "entPhysicalClass": "fan", "entPhysicalName": "Fan 1", "entPhysicalSerialNum": "F2"},
+		map[string]any{"entPhysicalIndex": 3, "entPhysicalClass": "port", "entPhysicalName": strings.Repeat("ü", maxNameLength+1), "entPhysicalDescr": descr, "entPhysicalSerialNum": "T1"},
+	}})
+
+	if err := ts.SyncInventory(42); err != nil {
+		t.Fatal(err)
+	}
+	if patches := ts.netbox.called(http.MethodPatch, "/api/dcim/inventory-items/21/"); len(patches) != 0 {
+		t.Errorf("the item added by hand was updated: %+v", patches)
+	}
+	if patches := ts.netbox.called(http.MethodPatch, "/api/dcim/inventory-items/22/"); len(patches) != 1 || patches[0].Body["serial"] != "F2" {
+		t.Errorf("got %+v, want the Fan 1 serial updated", patches)
+	}
+	posts := ts.netbox.called(http.MethodPost, "/api/dcim/inventory-items/")
+	if len(posts) != 1 {
+		t.Fatalf("got %d items added, want 1", len(posts))
+	}
+	name, _ := posts[0].Body["name"].(string)
+	description, _ := posts[0].Body["description"].(string)
+	if name != strings.Repeat("ü", maxNameLength) || description != strings.Repeat("é", maxDescriptionLength) {
+		t.Errorf("got name %q and description %q, want them cut at %d and %d characters", name, description, maxNameLength, maxDescriptionLength)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"Gi1/0/1", 64, "Gi1/0/1"},
+		{"abcdef", 3, "abc"},
+		{"Châssis", 3, "Châ"},
+		{"日本語の説明", 2, "日本"},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rsapc/hookcmd/librenms"
+	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/hookcmd/nbapi"
+	"github.com/rsapc/hookcmd/notify"
+	"github.com/rsapc/hookcmd/results"
+	"github.com/rsapc/netbox"
+)
+
+var ErrIPConflict = models.NewError("IP address is assigned to a different object", models.ErrConflict)
+
+// SyncIPAddresses creates or updates the Netbox IP addresses for every
+// address LibreNMS has discovered on the device and assigns them to the
+// matching interface.  Addresses already assigned to another object are
+// reported in the journal and left alone.  The primary IPs are set when
+// they are not already set in Netbox.
+func (s *Service) SyncIPAddresses(deviceID int) (err error) {
+	defer s.notifyFailure("ip address", deviceID, &err)
+	netboxType, netboxID, err := s.netbox.FindMonitoredObject(deviceID)
+	if err != nil {
+		s.logger.Error("could not find netbox device", "device_id", deviceID, "error", err)
+		return err
+	}
+	s.linkObjects(netboxType, netboxID, deviceID)
+	device, err := s.librenms.GetDevice(deviceID)
+	if err != nil {
+		return err
+	}
+	ips, err := s.librenms.GetDeviceIPs(deviceID)
+	if err != nil {
+		if errors.Is(err, librenms.ErrNotFound) {
+			s.logger.Warn("no IP addresses found for device", "device", deviceID)
+			return nil
+		}
+		return err
+	}
+	ports, err := s.librenms.GetPortsForDevice(deviceID)
+	if err != nil {
+		return err
+	}
+	portNames := make(map[int]string)
+	for _, port := range ports {
+		portNames[port.PortID] = port.IfName
+	}
+	intfs, err := s.netbox.GetInterfacesForObject(netboxType, netboxID)
+	if err != nil {
+		s.logger.Error("could not load interfaces from netbox", "error", err)
+		return err
+	}
+	nbInts := make(map[string]netbox.Interface)
+	for _, intf := range intfs {
+		nbInts[intf.Name] = intf
+	}
+
+	objectType := nbapi.InterfaceObjectType(netboxType)
+	vrfs := make(map[string]int)
+	var primary4, primary6 int
+	var synced, conflicts []string
+	for _, ip := range ips {
+		ifName, ok := portNames[ip.PortID]
+		if !ok {
+			s.logger.Warn("no port found for IP", "ip", ip.CIDR(), "port_id", ip.PortID)
+			continue
+		}
+		intf, ok := nbInts[ifName]
+		if !ok {
+			s.logger.Warn("interface not found in netbox", "ip", ip.CIDR(), "interface", ifName)
+			s.notify.Send(notify.Event{Type: notify.UnmappedInterface, Model: netboxType, ID: netboxID, DeviceID: deviceID,
+				Subject: fmt.Sprintf("interface %s not found in Netbox", ifName), Message: fmt.Sprintf("%s was not synced", ip.CIDR())})
+			continue
+		}
+		vrfID, err := s.lookupVRF(ip.ContextName, vrfs)
+		if err != nil {
+			s.logger.Warn("could not find VRF in netbox", "ip", ip.CIDR(), "vrf", ip.ContextName, "error", err)
+			continue
+		}
+		nbip, err := s.syncIPAddress(ip, vrfID, objectType, intf.ID)
+		if err != nil {
+			if errors.Is(err, ErrIPConflict) {
+				conflicts = append(conflicts, err.Error())
+				continue
+			}
+			return err
+		}
+		synced = append(synced, fmt.Sprintf("%s on %s", ip.CIDR(), ifName))
+		if ip.Address() == device.IP {
+			if ip.IsIPv6() {
+				primary6 = nbip.ID
+			} else {
+				primary4 = nbip.ID
+			}
+		}
+	}
+
+	if err = s.setPrimaryIPs(netboxType, netboxID, primary4, primary6); err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		s.netbox.AddJournalEntry(netboxType, netboxID, netbox.WarningLevel, "IP addresses from LibreNMS are assigned to other objects in Netbox:\n\n* %s", strings.Join(conflicts, "\n* "))
+	}
+	s.logger.Info("synced IP addresses from LibreNMS", "deviceType", netboxType, "ID", netboxID, "synced", len(synced), "conflicts", len(conflicts))
+	s.result.Summaryf("synced %d IP addresses from LibreNMS", len(synced))
+	for _, conflict := range conflicts {
+		s.result.Summaryf("assigned to another object: %s", conflict)
+	}
+	return nil
+}
+
+// syncIPAddress creates the IP in Netbox or updates the prefix length
+// and assignment of an existing one.  ErrIPConflict is returned when the
+// address is assigned to a different interface.
+func (s *Service) syncIPAddress(ip librenms.IP, vrfID int, objectType string, intfID int) (nbapi.IPAddress, error) {
+	existing, err := s.nbapi.FindIPAddresses(ip.Address(), vrfID)
+	if err != nil {
+		return nbapi.IPAddress{}, err
+	}
+	if len(existing) == 0 {
+		nbip, err := s.nbapi.AddIPAddress(ip.CIDR(), vrfID, objectType, intfID)
+		if err != nil {
+			s.logger.Error("failed to add IP address", "ip", ip.CIDR(), "error", err)
+			s.auditCreateFailure(results.Netbox, "ipaddress", ip.CIDR(), err)
+			return nbip, err
+		}
+		s.netbox.AddJournalEntry("ipaddress", int64(nbip.ID), netbox.SuccessLevel, "added IP address %s from LibreNMS", ip.CIDR())
+		s.recordCreate(results.Netbox, "ipaddress", int64(nbip.ID), ip.CIDR())
+		return nbip, nil
+	}
+	if len(existing) > 1 {
+		s.logger.Warn("duplicate IP addresses found in netbox", "ip", ip.Address(), "count", len(existing))
+	}
+	nbip := existing[0]
+	data := make(map[string]interface{})
+	if nbip.Address != ip.CIDR() {
+		data["address"] = ip.CIDR()
+	}
+	if nbip.AssignedObjectID == nil {
+		data["assigned_object_type"] = objectType
+		data["assigned_object_id"] = intfID
+	} else if *nbip.AssignedObjectType != objectType || *nbip.AssignedObjectID != intfID {
+		owner := fmt.Sprintf("%s %d", *nbip.AssignedObjectType, *nbip.AssignedObjectID)
+		if nbip.AssignedObject != nil {
+			owner = nbip.AssignedObject.String()
+		}
+		return nbip, fmt.Errorf("%w: %s is assigned to %s", ErrIPConflict, nbip.Address, owner)
+	}
+	if len(data) == 0 {
+		return nbip, nil
+	}
+	if err = s.updateObject("ipaddress", int64(nbip.ID), data); err != nil {
+		s.logger.Error("failed to update IP address", "ip", ip.CIDR(), "error", err)
+		return nbip, err
+	}
+	s.netbox.AddJournalEntry("ipaddress", int64(nbip.ID), netbox.SuccessLevel, "updated IP address from LibreNMS\n\n```\n%v\n```", data)
+	return nbip, nil
+}
+
+// lookupVRF returns the Netbox VRF ID for the LibreNMS context name.  The
+// global table (no context) is 0.  Results are cached in vrfs.
+func (s *Service) lookupVRF(contextName string, vrfs map[string]int) (int, error) {
+	if contextName == "" {
+		return 0, nil
+	}
+	if id, ok := vrfs[contextName]; ok {
+		return id, nil
+	}
+	vrf, err := s.nbapi.GetVRF(contextName)
+	if err != nil {
+		return 0, err
+	}
+	vrfs[contextName] = vrf.ID
+	return vrf.ID, nil
+}
+
+// setPrimaryIPs sets primary_ip4/primary_ip6 on the device or VM when they
+// are not already set.  An ID of 0 leaves the field alone.
+func (s *Service) setPrimaryIPs(netboxType string, netboxID int64, primary4 int, primary6 int) error {
+	if primary4 == 0 && primary6 == 0 {
+		return nil
+	}
+	current, err := s.nbapi.GetPrimaryIPs(netboxType, netboxID)
+	if err != nil {
+		return err
+	}
+	data := make(map[string]interface{})
+	if current.PrimaryIP4 == nil && primary4 != 0 {
+		data["primary_ip4"] = primary4
+	}
+	if current.PrimaryIP6 == nil && primary6 != 0 {
+		data["primary_ip6"] = primary6
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if err = s.updateObject(netboxType, netboxID, data); err != nil {
+		s.netbox.AddJournalEntry(netboxType, netboxID, netbox.WarningLevel, "could not set primary IP:\n\n%s", err.Error())
+		return err
+	}
+	return s.netbox.AddJournalEntry(netboxType, netboxID, netbox.SuccessLevel, "set primary IP from LibreNMS\n\n```\n%v\n```", data)
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSyncIPAddresses(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.netbox.handle("GET /api/dcim/devices/?cf_monitoring_id=42", http.StatusOK, netboxList(map[string]any{"id": 7}))
+	ts.netbox.handle("GET /api/dcim/interfaces/", http.StatusOK, netboxList(
+		map[string]any{"id": 71, "name": "Gi1/0/1"},
+		map[string]any{"id": 72, "name": "Gi1/0/2"},
+	))
+	ts.netbox.handleFunc("GET /api/ipam/ip-addresses/", func(req fakeRequest) (int, any) {
+		query, _ := url.ParseQuery(req.Query)
+		if query.Get("address") == "10.30.0.1" {
+			// documented on another device
+			return http.StatusOK, netboxList(map[string]any{"id": 90, "address": "10.30.0.1/24",
+				"assigned_object_type": "dcim.interface", "assigned_object_id": 500,
+				"assigned_object": map[string]any{"id": 500, "name": "eth0", "device": map[string]any{"id": 9, "name": "other"}}})
+		}
+		return http.StatusOK, netboxList()
+	})
+	ts.netbox.handle("POST /api/ipam/ip-addresses/", http.StatusCreated, map[string]any{"id": 100, "address": "10.20.0.1/24"})
+	ts.netbox.handle("GET /api/dcim/devices/7/", http.StatusOK, map[string]any{"id": 7, "name": "sw1", "primary_ip4": nil, "primary_ip6": nil})
+	ts.netbox.handle("PATCH /api/dcim/devices/7/", http.StatusOK, map[string]any{"id": 7})
+	ts.netbox.handle("POST /api/extras/journal-entries/", http.StatusCreated, map[string]any{"id": 1})
+	ts.librenms.handle("GET /api/v0/devices/42", http.StatusOK, libreDevice(map[string]any{"device_id": 42, "hostname": "sw1", "ip": "10.20.0.1"}))
+	ts.librenms.handle("GET /api/v0/devices/42/ip", http.StatusOK, map[string]any{"status": "ok", "addresses": []any{
+		map[string]any{"ipv4_address": "10.20.0.1", "ipv4_prefixlen": 24, "port_id": 1201},
+		map[string]any{"ipv4_address": "10.30.0.1", "ipv4_prefixlen": 24, "port_id": 1202},
+		// on a port that is not in Netbox
+		map[string]any{"ipv4_address": "10.40.0.1", "ipv4_prefixlen": 24, "port_id": 1203},
+	}})
+	ts.librenms.handle("GET /api/v0/ports/search/device_id/42", http.StatusOK, map[string]any{"status": "ok", "ports": []any{
+		map[string]any{"port_id": 1201, "device_id": 42, "ifName": "Gi1/0/1"},
+		map[string]any{"port_id": 1202, "device_id": 42, "ifName": "Gi1/0/2"},
+		map[string]any{"port_id": 1203, "device_id": 42, "ifName": "Gi1/0/3"},
+	}})
+
+	if err := ts.SyncIPAddresses(42); err != nil {
+		t.Fatal(err)
+	}
+	posts := ts.netbox.called(http.MethodPost, "/api/ipam/ip-addresses/")
+	if len(posts) != 1 {
+		t.Fatalf("added %d IP addresses, want 1", len(posts))
+	}
+	if body := posts[0].Body; body["address"] != "10.20.0.1/24" || body["assigned_object_type"] != "dcim.interface" || body["assigned_object_id"] != float64(71) {
+		t.Errorf("added %v, want 10.20.0.1/24 on interface 71", body)
+	}
+	patches := ts.netbox.called(http.MethodPatch, "/api/dcim/devices/7/")
+	if len(patches) != 1 || patches[0].Body["primary_ip4"] != float64(100) {
+		t.Errorf("got %+v, want primary_ip4 set to 100", patches)
+	}
+	var conflict bool
+	for _, req := range ts.netbox.called(http.MethodPost, "/api/extras/journal-entries/") {
+		if comments, _ := req.Body["comments"].(string); strings.Contains(comments, "10.30.0.1/24") {
+			conflict = true
+		}
+	}
+	if !conflict {
+		t.Error("the address assigned to another device was not journaled")
+	}
+}
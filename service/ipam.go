@@ -0,0 +1,173 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+
+	"github.com/rsapc/hookcmd/results"
+)
+
+// IPAMReconcileOptions control the IPAM reconcile report
+type IPAMReconcileOptions struct {
+	// Create adds the discovered networks that are missing from Netbox
+	Create bool
+	// Parent limits created prefixes to those within this prefix
+	Parent string
+	// VRF is the Netbox VRF prefixes discovered in the global context
+	// are created in.  Prefixes from other contexts are created in the
+	// VRF named after the LibreNMS context.
+	VRF string
+}
+
+// vrfPrefix identifies a network within a VRF
+type vrfPrefix struct {
+	vrf    string
+	prefix netip.Prefix
+}
+
+// ReconcileIPAM compares the networks discovered by LibreNMS with the
+// prefixes in Netbox and writes a CSV report to out with:
+//
+//	missing: networks discovered in LibreNMS with no Netbox prefix
+//	created: missing networks that were added to Netbox
+//	unused:  Netbox prefixes with no addresses in LibreNMS
+//	utilisation: live and Netbox address counts for the remaining prefixes
+//
+// With opts.Create, the missing networks within opts.Parent are added to
+// Netbox as active prefixes.  A prefix that cannot be added is reported
+// as missing and the errors are returned once the report is written.
+func (s *Service) ReconcileIPAM(out io.Writer, opts IPAMReconcileOptions) error {
+	var parent netip.Prefix
+	var err error
+	if opts.Create {
+		if parent, err = netip.ParsePrefix(opts.Parent); err != nil {
+			return fmt.Errorf("a valid parent prefix is required to create prefixes: %w", err)
+		}
+	}
+	libreIPs, err := s.librenms.GetIPs()
+	if err != nil {
+		s.logger.Error("could not get LibreNMS addresses", "err", err)
+		return err
+	}
+	prefixes, err := s.nbapi.ListPrefixes()
+	if err != nil {
+		s.logger.Error("could not get Netbox prefixes", "err", err)
+		return err
+	}
+	nbIPs, err := s.nbapi.ListIPAddresses()
+	if err != nil {
+		s.logger.Error("could not get Netbox addresses", "err", err)
+		return err
+	}
+
+	// networks discovered in LibreNMS and the live addresses in each VRF
+	discovered := make(map[vrfPrefix]int)
+	live := make(map[string][]netip.Addr)
+	for _, ip := range libreIPs {
+		addr, err := netip.ParseAddr(ip.Address())
+		if err != nil {
+			s.logger.Warn("invalid address from LibreNMS", "address", ip.Address(), "error", err)
+			continue
+		}
+		live[ip.ContextName] = append(live[ip.ContextName], addr)
+		if ip.PrefixLen() >= addr.BitLen() {
+			continue
+		}
+		network, err := addr.Prefix(ip.PrefixLen())
+		if err != nil {
+			continue
+		}
+		discovered[vrfPrefix{ip.ContextName, network}]++
+	}
+	documented := make(map[string][]netip.Addr)
+	for _, ip := range nbIPs {
+		if prefix, err := netip.ParsePrefix(ip.Address); err == nil {
+			documented[ip.VRFName()] = append(documented[ip.VRFName()], prefix.Addr())
+		}
+	}
+
+	inNetbox := make(map[vrfPrefix]bool)
+	io.WriteString(out, "Type,Prefix,VRF,Live Addresses,Netbox Addresses\n")
+	for _, p := range prefixes {
+		prefix, err := netip.ParsePrefix(p.Prefix)
+		if err != nil {
+			continue
+		}
+		inNetbox[vrfPrefix{p.VRFName(), prefix.Masked()}] = true
+		liveCount := countContained(prefix, live[p.VRFName()])
+		nbCount := countContained(prefix, documented[p.VRFName()])
+		kind := "utilisation"
+		if liveCount == 0 {
+			kind = "unused"
+		}
+		io.WriteString(out, fmt.Sprintf("%s,%s,%s,%d,%d\n", kind, p.Prefix, p.VRFName(), liveCount, nbCount))
+	}
+
+	var missing []vrfPrefix
+	for network := range discovered {
+		if !inNetbox[network] {
+			missing = append(missing, network)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		if missing[i].vrf != missing[j].vrf {
+			return missing[i].vrf < missing[j].vrf
+		}
+		return missing[i].prefix.String() < missing[j].prefix.String()
+	})
+	vrfs := make(map[string]int)
+	var errs []error
+	for _, network := range missing {
+		kind, vrfName := "missing", network.vrf
+		if opts.Create && parent.Overlaps(network.prefix) && network.prefix.Bits() >= parent.Bits() {
+			// --vrf only places the global table, so overlapping
+			// networks from other VRFs are not merged into it
+			into := network.vrf
+			if into == "" {
+				into = opts.VRF
+			}
+			created, err := s.createDiscoveredPrefix(network, into, vrfs)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("prefix %s: %w", network.prefix, err))
+			} else if created {
+				kind, vrfName = "created", into
+			}
+		}
+		liveCount := countContained(network.prefix, live[network.vrf])
+		io.WriteString(out, fmt.Sprintf("%s,%s,%s,%d,%d\n", kind, network.prefix, vrfName, liveCount, countContained(network.prefix, documented[network.vrf])))
+	}
+	return errors.Join(errs...)
+}
+
+// createDiscoveredPrefix adds the network to Netbox as an active prefix
+// in the named VRF.  False is returned if the VRF is not in Netbox.
+func (s *Service) createDiscoveredPrefix(network vrfPrefix, vrfName string, vrfs map[string]int) (bool, error) {
+	vrfID, err := s.lookupVRF(vrfName, vrfs)
+	if err != nil {
+		s.logger.Warn("could not find VRF in netbox", "prefix", network.prefix, "vrf", vrfName, "error", err)
+		return false, nil
+	}
+	p, err := s.nbapi.AddPrefix(network.prefix.String(), vrfID, "active", "discovered by LibreNMS")
+	if err != nil {
+		s.logger.Error("failed to add prefix", "prefix", network.prefix, "error", err)
+		s.auditCreateFailure(results.Netbox, "prefix", network.prefix.String(), err)
+		return false, err
+	}
+	s.logger.Info("added prefix", "prefix", p.Prefix, "vrf", vrfName, "id", p.ID)
+	s.recordCreate(results.Netbox, "prefix", int64(p.ID), p.Prefix)
+	return true, nil
+}
+
+// countContained returns the number of addrs within prefix
+func countContained(prefix netip.Prefix, addrs []netip.Addr) int {
+	count := 0
+	for _, addr := range addrs {
+		if prefix.Contains(addr) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestReconcileIPAMCreate(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.librenms.handle("GET /api/v0/resources/ip/addresses", http.StatusOK, map[string]any{"status": "ok", "ip_addresses": []any{
+		map[string]any{"ipv4_address": "10.1.0.5", "ipv4_prefixlen": 24, "context_name": ""},
+		map[string]any{"ipv4_address": "10.1.0.9", "ipv4_prefixlen": 24, "context_name": "cust-a"},
+		map[string]any{"ipv4_address": "10.2.0.1", "ipv4_prefixlen": 24, "context_name": ""},
+		map[string]any{"ipv4_address": "192.168.1.1", "ipv4_prefixlen": 24, "context_name": ""},
+	}})
+	ts.netbox.handle("GET /api/ipam/prefixes/", http.StatusOK, netboxList(map[string]any{"id": 1, "prefix": "10.9.0.0/24"}))
+	ts.netbox.handle("GET /api/ipam/ip-addresses/", http.StatusOK, netboxList())
+	ts.netbox.handleFunc("GET /api/ipam/vrfs/", func(req fakeRequest) (int, any) {
+		query, _ := url.ParseQuery(req.Query)
+		ids := map[string]int{"CORP": 3, "cust-a": 4}
+		return http.StatusOK, netboxList(map[string]any{"id": ids[query.Get("name")], "name": query.Get("name")})
+	})
+	ts.netbox.handleFunc("POST /api/ipam/prefixes/", func(req fakeRequest) (int, any) {
+		if req.Body["prefix"] == "10.2.0.0/24" {
+			return http.StatusInternalServerError, map[string]any{"detail": "database unavailable"}
+		}
+		return http.StatusCreated, map[string]any{"id": 20, "prefix": req.Body["prefix"]}
+	})
+
+	var out bytes.Buffer
+	err := ts.ReconcileIPAM(&out, IPAMReconcileOptions{Create: true, Parent: "10.0.0.0/8", VRF: "CORP"})
+	if err == nil || !strings.Contains(err.Error(), "10.2.0.0/24") {
+		t.Errorf("got %v, want the 10.2.0.0/24 error", err)
+	}
+	want := "Type,Prefix,VRF,Live Addresses,Netbox Addresses\n" +
+		"unused,10.9.0.0/24,,0,0\n" +
+		"created,10.1.0.0/24,CORP,1,0\n" +
+		"missing,10.2.0.0/24,,1,0\n" +
+		"missing,192.168.1.0/24,,1,0\n" +
+		"created,10.1.0.0/24,cust-a,1,0\n"
+	if out.String() != want {
+		t.Errorf("got report\n%s\nwant\n%s", out.String(), want)
+	}
+	var vrfs []any
+	for _, req := range ts.netbox.called(http.MethodPost, "/api/ipam/prefixes/") {
+		if req.Body["prefix"] == "10.1.0.0/24" {
+			vrfs = append(vrfs, req.Body["vrf"])
+		}
+	}
+	// the global network goes to --vrf, the cust-a one stays in cust-a
+	if len(vrfs) != 2 || vrfs[0] != float64(3) || vrfs[1] != float64(4) {
+		t.Errorf("10.1.0.0/24 created in VRFs %v, want 3 and 4", vrfs)
+	}
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/rsapc/hookcmd/librenms"
+	"github.com/rsapc/hookcmd/nbapi"
+	"github.com/rsapc/hookcmd/results"
+	"github.com/rsapc/netbox"
+)
+
+// locationName returns the LibreNMS location for the Netbox object: its
+// site name, or "Site / Location" with the hierarchy option
+func (s *Service) locationName(obj nbapi.ObjectContext) string {
+	if obj.Site == nil {
+		return ""
+	}
+	if s.config.Locations.Hierarchy && obj.Location != nil {
+		return fmt.Sprintf("%s / %s", obj.Site.Name, obj.Location.Name)
+	}
+	return obj.Site.Name
+}
+
+// SyncLocations creates a LibreNMS location for each Netbox site (and
+// location with the hierarchy option) and pushes the site coordinates to
+// it.  Each monitored Netbox device is then assigned to its location in
+// LibreNMS.  Sites without coordinates are skipped.  A location or device
+// that cannot be updated is logged and the rest are still synced; the
+// errors are returned at the end.
+func (s *Service) SyncLocations() error {
+	sites, err := s.nbapi.ListSites()
+	if err != nil {
+		s.logger.Error("could not get Netbox sites", "err", err)
+		return err
+	}
+	coords := make(map[string]nbapi.Site)
+	for _, site := range sites {
+		coords[site.Name] = site
+	}
+	locations, err := s.libreLocations()
+	if err != nil {
+		return err
+	}
+	objects, err := s.nbapi.ListMonitored("device")
+	if err != nil {
+		s.logger.Error("could not get monitored Netbox devices", "err", err)
+		return err
+	}
+
+	wanted := make(map[string]nbapi.Site)
+	for _, site := range sites {
+		wanted[site.Name] = site
+	}
+	for _, obj := range objects {
+		if name := s.locationName(obj); name != "" {
+			wanted[name] = coords[obj.Site.Name]
+		}
+	}
+	names := make([]string, 0, len(wanted))
+	for name := range wanted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		if err = s.syncLocation(name, wanted[name], locations); err != nil {
+			errs = append(errs, fmt.Errorf("location %s: %w", name, err))
+		}
+	}
+	// reload for the IDs of the added locations
+	if locations, err = s.libreLocations(); err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	devices, err := s.librenms.GetDevices()
+	if err != nil {
+		s.logger.Error("could not get LibreNMS devices", "err", err)
+		return errors.Join(append(errs, err)...)
+	}
+	byID := make(map[int]librenms.LibreDevice)
+	for _, device := range devices {
+		byID[device.DeviceID] = device
+	}
+
+	for _, obj := range objects {
+		name := s.locationName(obj)
+		location, ok := locations[name]
+		if name == "" || !ok {
+			continue
+		}
+		device, ok := byID[obj.MonitoringID()]
+		if !ok || device.LocationID == location.ID {
+			continue
+		}
+		fields := map[string]interface{}{"location_id": location.ID, "override_sysLocation": 1}
+		if err = s.updateLibreDevice(device.DeviceID, fields); err != nil {
+			s.logger.Error("could not set LibreNMS location", "device", device.DeviceID, "location", name, "error", err)
+			errs = append(errs, fmt.Errorf("device %d: %w", device.DeviceID, err))
+			continue
+		}
+		s.logger.Info("set LibreNMS location", "device", device.DeviceID, "from", device.Location, "to", name)
+		s.netbox.AddJournalEntry("device", int64(obj.ID), netbox.InfoLevel, "LibreNMS location changed from %s to %s", device.Location, name)
+	}
+	return errors.Join(errs...)
+}
+
+// libreLocations returns the LibreNMS locations by name
+func (s *Service) libreLocations() (map[string]librenms.Location, error) {
+	list, err := s.librenms.GetLocations()
+	if err != nil {
+		s.logger.Error("could not get LibreNMS locations", "err", err)
+		return nil, err
+	}
+	locations := make(map[string]librenms.Location)
+	for _, location := range list {
+		locations[location.Location] = location
+	}
+	return locations, nil
+}
+
+// syncLocation adds the location or updates its coordinates from the
+// site.  LibreNMS requires coordinates so a location is not added for a
+// site without them.
+func (s *Service) syncLocation(name string, site nbapi.Site, locations map[string]librenms.Location) error {
+	existing, ok := locations[name]
+	if !ok {
+		if site.Latitude == nil || site.Longitude == nil {
+			s.logger.Warn("site has no coordinates, LibreNMS location not added", "location", name)
+			s.result.Summaryf("skipped location %s: the site has no coordinates", name)
+			return nil
+		}
+		location := librenms.Location{Location: name, Lat: site.Latitude, Lng: site.Longitude, FixedCoordinates: 1}
+		id, err := s.librenms.AddLocation(location)
+		if err != nil {
+			s.logger.Error("could not add LibreNMS location", "location", name, "error", err)
+			s.auditCreateFailure(results.LibreNMS, "location", name, err)
+			return err
+		}
+		if id == 0 {
+			// older LibreNMS versions do not give the ID
+			if added, err := s.libreLocations(); err == nil {
+				id = added[name].ID
+			}
+		}
+		s.logger.Info("added LibreNMS location", "location", name, "id", id)
+		s.recordCreate(results.LibreNMS, "location", int64(id), name)
+		return nil
+	}
+	if site.Latitude == nil || site.Longitude == nil {
+		return nil
+	}
+	if existing.Lat != nil && existing.Lng != nil && *existing.Lat == *site.Latitude && *existing.Lng == *site.Longitude {
+		return nil
+	}
+	if err := s.librenms.UpdateLocation(name, *site.Latitude, *site.Longitude); err != nil {
+		s.logger.Error("could not update LibreNMS location", "location", name, "error", err)
+		s.auditFailure(results.LibreNMS, "location", int64(existing.ID), map[string]any{"lat": *site.Latitude, "lng": *site.Longitude}, err)
+		return err
+	}
+	s.logger.Info("updated LibreNMS location coordinates", "location", name)
+	s.recordUpdate(results.LibreNMS, "location", int64(existing.ID), "", toMap(existing), map[string]any{"lat": *site.Latitude, "lng": *site.Longitude})
+	return nil
+}
+
+// LocationReport writes a CSV of the monitored Netbox devices whose
+// LibreNMS location does not match their Netbox site (or site /
+// location with the hierarchy option)
+func (s *Service) LocationReport(out io.Writer) error {
+	objects, err := s.nbapi.ListMonitored("device")
+	if err != nil {
+		s.logger.Error("could not get monitored Netbox devices", "err", err)
+		return err
+	}
+	devices, err := s.librenms.GetDevices()
+	if err != nil {
+		s.logger.Error("could not get LibreNMS devices", "err", err)
+		return err
+	}
+	byID := make(map[int]librenms.LibreDevice)
+	for _, device := range devices {
+		byID[device.DeviceID] = device
+	}
+	var rows []string
+	for _, obj := range objects {
+		device, ok := byID[obj.MonitoringID()]
+		if !ok {
+			continue
+		}
+		want := s.locationName(obj)
+		if strings.EqualFold(strings.TrimSpace(device.Location), want) {
+			continue
+		}
+		rows = append(rows, fmt.Sprintf("%s,%d,%s,%s\n", obj.Name, device.DeviceID, want, device.Location))
+	}
+	sort.Strings(rows)
+	io.WriteString(out, "Device,LibreNMS ID,Netbox Location,LibreNMS Location\n")
+	for _, row := range rows {
+		io.WriteString(out, row)
+	}
+	return nil
+}
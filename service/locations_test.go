@@ -0,0 +1,112 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rsapc/hookcmd/audit"
+	"github.com/rsapc/hookcmd/librenms"
+	"github.com/rsapc/hookcmd/results"
+	"github.com/rsapc/netbox"
+)
+
+func TestSyncLocationsSkipsFailures(t *testing.T) {
+	ts := newTestService(t, nil)
+	site := func(id int, name string, lat, lng any) map[string]any {
+		return map[string]any{"id": id, "name": name, "slug": strings.ToLower(name), "latitude": lat, "longitude": lng}
+	}
+	ts.netbox.handle("GET /api/dcim/sites/", http.StatusOK, netboxList(
+		site(1, "HQ", 51.5, -0.12),
+		site(2, "Depot", nil, nil),
+		site(3, "Branch", 53.4, -2.2),
+		site(4, "Annex", 52.2, 0.12),
+	))
+	ts.netbox.handle("GET /api/dcim/devices/", http.StatusOK, netboxList(
+		map[string]any{"id": 20, "name": "hq-sw1", "site": map[string]any{"id": 1, "name": "HQ", "slug": "hq"}, "custom_fields": map[string]any{"monitoring_id": 12}},
+		map[string]any{"id": 21, "name": "depot-sw1", "site": map[string]any{"id": 2, "name": "Depot", "slug": "depot"}, "custom_fields": map[string]any{"monitoring_id": 13}},
+		map[string]any{"id": 22, "name": "hq-sw2", "site": map[string]any{"id": 1, "name": "HQ", "slug": "hq"}, "custom_fields": map[string]any{"monitoring_id": 14}},
+		// not in LibreNMS
+		map[string]any{"id": 23, "name": "hq-sw3", "site": map[string]any{"id": 1, "name": "HQ", "slug": "hq"}, "custom_fields": map[string]any{"monitoring_id": 15}},
+	))
+	ts.netbox.handle("POST /api/extras/journal-entries/", http.StatusCreated, map[string]any{"id": 1})
+	ts.librenms.handle("GET /api/v0/resources/locations", http.StatusOK, map[string]any{"status": "ok", "count": 1, "locations": []any{
+		map[string]any{"id": 3, "location": "HQ", "lat": 51.5, "lng": -0.12, "fixed_coordinates": 1},
+	}})
+	ts.librenms.handleFunc("POST /api/v0/locations", func(req fakeRequest) (int, any) {
+		if req.Body["location"] == "Branch" {
+			return http.StatusInternalServerError, map[string]any{"status": "error", "message": "database unavailable"}
+		}
+		return http.StatusCreated, map[string]any{"status": "ok", "message": "Location added with id #5"}
+	})
+	ts.librenms.handle("GET /api/v0/devices", http.StatusOK, map[string]any{"status": "ok", "count": 3, "devices": []any{
+		map[string]any{"device_id": 12, "hostname": "10.0.0.12", "location_id": 1, "location": "somewhere"},
+		map[string]any{"device_id": 13, "hostname": "10.0.0.13"},
+		map[string]any{"device_id": 14, "hostname": "10.0.0.14", "location_id": 3, "location": "HQ"},
+	}})
+	ts.librenms.handle("GET /api/v0/devices/12", http.StatusOK, libreDevice(map[string]any{"device_id": 12, "hostname": "10.0.0.12", "location_id": 1, "location": "somewhere"}))
+	ts.librenms.handle("PATCH /api/v0/devices/12", http.StatusOK, map[string]any{"status": "ok"})
+
+	err := ts.SyncLocations()
+	if err == nil || !strings.Contains(err.Error(), "Branch") {
+		t.Fatalf("got %v, want the Branch error", err)
+	}
+	var added []any
+	for _, req := range ts.librenms.called(http.MethodPost, "/api/v0/locations") {
+		added = append(added, req.Body["location"])
+	}
+	if len(added) != 2 || added[0] != "Annex" || added[1] != "Branch" {
+		t.Errorf("added %v, want Annex and Branch", added)
+	}
+	patches := ts.librenms.called(http.MethodPatch, "/api/v0/devices/12")
+	if len(patches) != 1 {
+		t.Fatalf("device 12 was not assigned its location after the Branch error")
+	}
+	if writes := ts.librenms.writes(); len(writes) != 3 {
+		t.Errorf("got LibreNMS writes %+v, want the two locations and device 12", writes)
+	}
+	for _, id := range []string{"13", "14", "15"} {
+		if reqs := ts.librenms.called(http.MethodGet, "/api/v0/devices/"+id); len(reqs) != 0 {
+			t.Errorf("device %s was fetched on its own", id)
+		}
+	}
+	var locations []audit.Entry
+	for _, e := range ts.auditEntries(t) {
+		if e.Model == "location" {
+			locations = append(locations, e)
+		}
+	}
+	if len(locations) != 2 {
+		t.Fatalf("got %d location audit entries, want 2: %+v", len(locations), locations)
+	}
+	if e := locations[0]; e.Name != "Annex" || e.ID != 5 || e.Result != audit.ResultOK {
+		t.Errorf("got %+v, want Annex created as location 5", e)
+	}
+	if e := locations[1]; e.Name != "Branch" || e.Action != results.Create || e.Result != audit.ResultFailed {
+		t.Errorf("got %+v, want the failed create of Branch", e)
+	}
+}
+
+func TestUpdateNetboxDeviceKeepsSiteCoordinates(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.netbox.handle("GET /api/dcim/devices/20/", http.StatusOK, map[string]any{"id": 20, "name": "hq-sw1"})
+	ts.netbox.handle("PATCH /api/dcim/devices/20/", http.StatusOK, map[string]any{"id": 20})
+	lat, lng, serial := float32(40.7), float32(-74.0), "FOC1234"
+	device := librenms.LibreDevice{DeviceID: 12, Lat: &lat, Lng: &lng, Serial: &serial}
+	nbdev := netbox.DeviceOrVM{ID: 20, URL: "http://netbox/api/dcim/devices/20/", Description: "core switch"}
+	if _, err := ts.updateNetboxDevice(device, nbdev); err != nil {
+		t.Fatal(err)
+	}
+	patches := ts.netbox.called(http.MethodPatch, "/api/dcim/devices/20/")
+	if len(patches) != 1 {
+		t.Fatalf("got %d updates, want 1", len(patches))
+	}
+	for _, field := range []string{"latitude", "longitude"} {
+		if _, ok := patches[0].Body[field]; ok {
+			t.Errorf("%s was copied from LibreNMS", field)
+		}
+	}
+	if patches[0].Body["serial"] != serial {
+		t.Errorf("got %v, want the serial updated", patches[0].Body)
+	}
+}
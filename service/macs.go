@@ -0,0 +1,165 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rsapc/hookcmd/librenms"
+	"github.com/rsapc/hookcmd/nbapi"
+	"github.com/rsapc/hookcmd/results"
+	"github.com/rsapc/netbox"
+)
+
+// custom fields on the Netbox MAC address objects
+const (
+	cfMacFirstSeen = "mac_first_seen"
+	cfMacLastSeen  = "mac_last_seen"
+	cfMacSeenOn    = "mac_seen_on"
+	cfMacSeenIP    = "mac_seen_ip"
+)
+
+// SyncMACLocations records in Netbox where each MAC address learned on the
+// switch was last seen.  The MAC address objects get the switch:port, the
+// IP from the ARP tables and first/last seen timestamps as custom fields.
+//
+// Trunk ports and ports with more than maxMACs addresses are skipped as
+// they are uplinks rather than where hosts are plugged in.
+func (s *Service) SyncMACLocations(deviceID int, maxMACs int) (err error) {
+	defer s.notifyFailure("MAC address", deviceID, &err)
+	netboxType, netboxID, err := s.netbox.FindMonitoredObject(deviceID)
+	if err != nil {
+		s.logger.Error("could not find netbox device", "device_id", deviceID, "error", err)
+		return err
+	}
+	s.linkObjects(netboxType, netboxID, deviceID)
+	nbdev, err := s.netbox.GetDeviceOrVMbyType(netboxType, netboxID)
+	if err != nil {
+		return err
+	}
+	if err = s.ensureMACFields(); err != nil {
+		return err
+	}
+	fdb, err := s.librenms.GetFDBForDevice(deviceID)
+	if err != nil {
+		if errors.Is(err, librenms.ErrNotFound) {
+			s.logger.Warn("no fdb entries found for device", "device", deviceID)
+			return nil
+		}
+		return err
+	}
+	ports, err := s.librenms.GetPortsForDevice(deviceID)
+	if err != nil {
+		return err
+	}
+	portMap := make(map[int]librenms.Port)
+	for _, port := range ports {
+		portMap[port.PortID] = port
+	}
+	macsPerPort := make(map[int]int)
+	for _, entry := range fdb {
+		macsPerPort[entry.PortID]++
+	}
+	recorded, unresolved := 0, 0
+	for _, entry := range fdb {
+		port, ok := portMap[entry.PortID]
+		if !ok {
+			unresolved++
+			continue
+		}
+		if port.IsTrunk() || macsPerPort[entry.PortID] > maxMACs {
+			continue
+		}
+		mac := librenms.FormatMAC(entry.MacAddress)
+		seenOn := fmt.Sprintf("%s:%s", nbdev.Name, port.IfName)
+		if err = s.recordMACLocation(mac, seenOn, s.arpAddress(entry.MacAddress), entry); err != nil {
+			return err
+		}
+		recorded++
+	}
+	if unresolved == len(fdb) {
+		return fmt.Errorf("none of the %d forwarding table entries of device %d matched a LibreNMS port", len(fdb), deviceID)
+	}
+	if unresolved > 0 {
+		s.logger.Warn("forwarding table entries on unknown ports", "device", deviceID, "count", unresolved)
+	}
+	s.logger.Info("recorded MAC locations", "device", nbdev.Name, "count", recorded)
+	s.result.Summaryf("recorded the location of %d MAC addresses", recorded)
+	return s.netbox.AddJournalEntry(netboxType, netboxID, netbox.InfoLevel, "recorded location of %d MAC addresses from the LibreNMS forwarding table", recorded)
+}
+
+// arpAddress returns the IPv4 address most recently seen with the MAC in
+// the ARP tables, or an empty string.  Only the MAC is looked up so the
+// ARP tables of every device are not downloaded.
+func (s *Service) arpAddress(mac string) string {
+	arp, err := s.librenms.GetARP(mac)
+	if err != nil {
+		if !errors.Is(err, librenms.ErrNotFound) {
+			s.logger.Warn("could not look up ARP entries", "mac", mac, "error", err)
+		}
+		return ""
+	}
+	var latest librenms.ArpEntry
+	for _, entry := range arp {
+		if entry.UpdatedAt > latest.UpdatedAt {
+			latest = entry
+		}
+	}
+	return latest.Ipv4Address
+}
+
+// recordMACLocation creates or updates the Netbox MAC address object
+// with where it was seen.  The first seen time is only moved earlier.
+func (s *Service) recordMACLocation(mac string, seenOn string, ip string, entry librenms.FdbEntry) error {
+	cf := make(map[string]interface{})
+	cf[cfMacSeenOn] = seenOn
+	cf[cfMacLastSeen] = entry.UpdatedAt
+	if ip != "" {
+		cf[cfMacSeenIP] = ip
+	}
+	existing, err := s.nbapi.FindMACAddress(mac)
+	if err != nil {
+		if !errors.Is(err, nbapi.ErrNotFound) {
+			return err
+		}
+		cf[cfMacFirstSeen] = entry.CreatedAt
+		added, err := s.nbapi.AddMACAddress(mac, cf)
+		if err != nil {
+			s.auditCreateFailure(results.Netbox, "macaddress", mac, err)
+			return err
+		}
+		s.recordCreate(results.Netbox, "macaddress", int64(added.ID), mac)
+		return nil
+	}
+	firstSeen, _ := existing.CustomFields[cfMacFirstSeen].(string)
+	if firstSeen == "" || entry.CreatedAt < firstSeen {
+		cf[cfMacFirstSeen] = entry.CreatedAt
+	}
+	prevSeenOn, _ := existing.CustomFields[cfMacSeenOn].(string)
+	lastSeen, _ := existing.CustomFields[cfMacLastSeen].(string)
+	if prevSeenOn == seenOn && lastSeen == entry.UpdatedAt && cf[cfMacFirstSeen] == nil {
+		return nil
+	}
+	if prevSeenOn != "" && prevSeenOn != seenOn {
+		s.logger.Info("MAC address moved", "mac", mac, "from", prevSeenOn, "to", seenOn)
+	}
+	data := make(map[string]interface{})
+	data["custom_fields"] = cf
+	return s.updateObject("macaddress", int64(existing.ID), data)
+}
+
+// ensureMACFields adds the custom fields used by SyncMACLocations
+func (s *Service) ensureMACFields() error {
+	fields := [][2]string{
+		{cfMacSeenOn, "Last seen on"},
+		{cfMacSeenIP, "Last seen IP"},
+		{cfMacFirstSeen, "First seen"},
+		{cfMacLastSeen, "Last seen"},
+	}
+	for _, field := range fields {
+		if err := s.nbapi.EnsureCustomField(field[0], field[1], "text", "dcim.macaddress"); err != nil {
+			s.logger.Error("could not add custom field", "field", field[0], "error", err)
+			return err
+		}
+	}
+	return nil
+}
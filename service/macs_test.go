@@ -0,0 +1,45 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSyncMACLocations(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.netbox.handle("GET /api/dcim/devices/?cf_monitoring_id=42", http.StatusOK, netboxList(map[string]any{"id": 7}))
+	ts.netbox.handle("GET /api/dcim/devices/7/", http.StatusOK, map[string]any{"id": 7, "name": "sw1"})
+	ts.netbox.handle("GET /api/extras/custom-fields/", http.StatusOK, netboxList(map[string]any{"id": 1}))
+	ts.netbox.handle("GET /api/dcim/mac-addresses/", http.StatusOK, netboxList())
+	ts.netbox.handle("POST /api/dcim/mac-addresses/", http.StatusCreated, map[string]any{"id": 30})
+	ts.netbox.handle("POST /api/extras/journal-entries/", http.StatusCreated, map[string]any{"id": 1})
+	ts.librenms.handle("GET /api/v0/devices/42/fdb", http.StatusOK, map[string]any{"status": "ok", "ports_fdb": []any{
+		map[string]any{"port_id": 1201, "device_id": 42, "mac_address": "a4bb6d3c0f12", "created_at": "2024-02-01 08:12:44", "updated_at": "2024-03-05 17:10:02"},
+		map[string]any{"port_id": 1248, "device_id": 42, "mac_address": "001122334455", "created_at": "2024-01-11 10:00:00", "updated_at": "2024-03-05 17:10:02"},
+	}})
+	ts.librenms.handle("GET /api/v0/ports/search/device_id/42", http.StatusOK, map[string]any{"status": "ok", "ports": []any{
+		map[string]any{"port_id": 1201, "device_id": 42, "ifName": "Gi1/0/1"},
+		map[string]any{"port_id": 1248, "device_id": 42, "ifName": "Te1/1/1", "ifTrunk": "dot1Q"},
+	}})
+	ts.librenms.handle("GET /api/v0/resources/ip/arp/a4bb6d3c0f12", http.StatusOK, map[string]any{"status": "ok", "arp": []any{
+		map[string]any{"mac_address": "a4bb6d3c0f12", "ipv4_address": "10.0.3.20", "updated_at": "2024-03-01 10:00:00"},
+		map[string]any{"mac_address": "a4bb6d3c0f12", "ipv4_address": "10.0.3.21", "updated_at": "2024-03-05 10:00:00"},
+	}})
+
+	if err := ts.SyncMACLocations(42, 4); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/api/v0/resources/fdb", "/api/v0/resources/ip/arp/all", "/api/v0/resources/ip/arp/001122334455"} {
+		if len(ts.librenms.called(http.MethodGet, path)) != 0 {
+			t.Errorf("%s was requested", path)
+		}
+	}
+	posts := ts.netbox.called(http.MethodPost, "/api/dcim/mac-addresses/")
+	if len(posts) != 1 {
+		t.Fatalf("added %d MAC addresses, want 1 (the trunk port is skipped)", len(posts))
+	}
+	cf, _ := posts[0].Body["custom_fields"].(map[string]any)
+	if posts[0].Body["mac_address"] != "A4:BB:6D:3C:0F:12" || cf[cfMacSeenOn] != "sw1:Gi1/0/1" || cf[cfMacSeenIP] != "10.0.3.21" {
+		t.Errorf("added %v, want A4:BB:6D:3C:0F:12 seen on sw1:Gi1/0/1 with 10.0.3.21", posts[0].Body)
+	}
+}
@@ -0,0 +1,17 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/rsapc/hookcmd/notify"
+)
+
+// notifyFailure sends a sync_failed event when *err is set.  It is
+// deferred by the sync commands with their named error result.
+func (s *Service) notifyFailure(sync string, deviceID int, err *error) {
+	if *err == nil {
+		return
+	}
+	s.notify.Send(notify.Event{Type: notify.SyncFailed, DeviceID: deviceID,
+		Subject: fmt.Sprintf("%s sync failed for LibreNMS device %d", sync, deviceID), Message: (*err).Error()})
+}
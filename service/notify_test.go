@@ -0,0 +1,27 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSyncFailureNotifies(t *testing.T) {
+	hooks, url := newFakeAPI(t)
+	hooks.handle("POST /events", http.StatusNoContent, nil)
+	ts := newTestService(t, map[string]any{"notify": map[string]any{"sinks": []any{
+		map[string]any{"type": "webhook", "url": url + "/events", "events": []string{"sync_failed"}},
+	}}})
+	ts.netbox.handle("GET /api/dcim/devices/", http.StatusOK, netboxList())
+	ts.netbox.handle("GET /api/virtualization/virtual-machines/", http.StatusOK, netboxList())
+
+	if err := ts.SyncInventory(42); err == nil {
+		t.Fatal("got no error for a device that is not in Netbox")
+	}
+	posts := hooks.called(http.MethodPost, "/events")
+	if len(posts) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(posts))
+	}
+	if body := posts[0].Body; body["type"] != "sync_failed" || body["device_id"] != float64(42) || body["subject"] != "inventory sync failed for LibreNMS device 42" {
+		t.Errorf("got %v", body)
+	}
+}
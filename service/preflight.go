@@ -0,0 +1,77 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rsapc/hookcmd/config"
+	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/hookcmd/probe"
+	"github.com/rsapc/netbox"
+)
+
+var (
+	ErrPreflightFailed = models.NewError("pre-flight check failed", models.ErrUnavailable)
+	// ErrPreflightAuth is returned when the device rejects the profile's
+	// SNMP credentials
+	ErrPreflightAuth = models.NewError("pre-flight check failed", models.ErrAuth)
+)
+
+// AddOptions control AddToLibreNMS
+type AddOptions struct {
+	// Probe runs the pre-flight checks before the device is added.  They
+	// are always run when enabled in the config.
+	Probe bool
+	// ProbeOnly runs the pre-flight checks without adding the device
+	ProbeOnly bool
+}
+
+// preflight probes ip with the profile's SNMP credentials and records
+// the diagnostic in the journal of the Netbox object
+func (s *Service) preflight(ip string, model string, modelID int64, profile config.DeviceProfile) probe.Result {
+	result := probe.Run(ip, s.probeOptions(profile))
+	level := netbox.InfoLevel
+	if !result.OK() {
+		level = netbox.WarningLevel
+		s.logger.Warn("pre-flight check failed", "address", ip, "failure", result.Failure, "profile", profile.Name)
+	}
+	if err := s.netbox.AddJournalEntry(model, modelID, level, "%s\n\nprofile=%s", result, profile.Name); err != nil {
+		s.logger.Error(fmt.Sprintf("could not add journal entry: %v", err), "service", "service")
+	}
+	for _, line := range strings.Split(result.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			s.result.Summaryf("%s", line)
+		}
+	}
+	return result
+}
+
+// probeOptions returns the probe settings for the profile's credentials
+func (s *Service) probeOptions(profile config.DeviceProfile) probe.Options {
+	cfg := s.config.LibreNMS.Preflight
+	return probe.Options{
+		TCPPorts:    cfg.TCPPorts,
+		NoSNMP:      profile.SNMPDisable,
+		SNMPVersion: profile.SNMPVersion,
+		Community:   profile.Community,
+		USM: probe.USM{
+			Level:    profile.AuthLevel,
+			User:     profile.AuthName,
+			AuthPass: profile.AuthPass,
+			AuthAlgo: profile.AuthAlgo,
+			PrivPass: profile.CryptoPass,
+			PrivAlgo: profile.CryptoAlgo,
+		},
+		SNMPPort:  profile.Port,
+		Transport: profile.Transport,
+		Timeout:   cfg.Timeout.Duration,
+	}
+}
+
+// preflightError returns the error for a failed pre-flight check
+func preflightError(result probe.Result) error {
+	if result.Failure == probe.FailureAuth {
+		return ErrPreflightAuth
+	}
+	return ErrPreflightFailed
+}
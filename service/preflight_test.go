@@ -0,0 +1,34 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rsapc/hookcmd/config"
+	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/hookcmd/probe"
+)
+
+func TestPreflightError(t *testing.T) {
+	tests := []struct {
+		failure string
+		want    error
+	}{
+		{probe.FailureAuth, models.ErrAuth},
+		{probe.FailureUnreachable, models.ErrUnavailable},
+		{probe.FailureSNMP, models.ErrUnavailable},
+	}
+	for _, tt := range tests {
+		if err := preflightError(probe.Result{Failure: tt.failure}); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.failure, err, tt.want)
+		}
+	}
+}
+
+func TestProbeOptionsTransport(t *testing.T) {
+	ts := newTestService(t, nil)
+	opts := ts.probeOptions(config.DeviceProfile{SNMPVersion: "v3", Transport: "tcp6", Port: 1161, AuthName: "probe"})
+	if opts.Transport != "tcp6" || opts.SNMPPort != 1161 || opts.USM.User != "probe" {
+		t.Errorf("got %+v", opts)
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/rsapc/hookcmd/librenms"
+	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/hookcmd/probe"
+	"github.com/rsapc/hookcmd/results"
+	"github.com/rsapc/netbox"
+)
+
+// PrimaryIPChange handles a Netbox device or VM webhook.  When the
+// primary IP changes the device is probed at the new address and, if it
+// answers, LibreNMS is pointed at it.  A LibreNMS hostname that is an IP
+// address is renamed; otherwise the overwrite_ip is set.  The outcome is
+// recorded in the Netbox journal and the LibreNMS device notes.
+//
+// The IPv4 primary is preferred; the IPv6 primary is only used when the
+// object has no IPv4 primary.
+func (s *Service) PrimaryIPChange(payload string) error {
+	hook, err := models.ParseWebhook(payload)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return err
+	}
+	if hook.Model != "device" && hook.Model != "virtualmachine" {
+		return fmt.Errorf("%w: primaryip expects a device or virtualmachine webhook, got %s", models.ErrValidation, hook.Model)
+	}
+	if hook.Event != models.EventUpdated || hook.Pre() == nil {
+		return nil
+	}
+	pre, post := hook.Pre(), hook.Post()
+	ipID := post.Int("primary_ip4")
+	changed := ipID != pre.Int("primary_ip4")
+	if ipID == 0 {
+		ipID = post.Int("primary_ip6")
+		changed = changed || ipID != pre.Int("primary_ip6")
+	}
+	if !changed {
+		return nil
+	}
+	if ipID == 0 {
+		s.logger.Info("primary IP removed, LibreNMS not changed", "model", hook.Model, "id", hook.ID())
+		return nil
+	}
+	monitoringID := post.CustomFields().Int("monitoring_id")
+	if monitoringID == 0 {
+		monitoringID = hook.Data.CustomFields().Int("monitoring_id")
+	}
+	if monitoringID == 0 {
+		s.logger.Info("object is not monitored", "model", hook.Model, "id", hook.ID())
+		return nil
+	}
+
+	nbip, err := s.nbapi.GetIPAddress(ipID)
+	if err != nil {
+		s.logger.Error("could not get primary IP", "id", ipID, "error", err)
+		return err
+	}
+	addr := netbox.IPfromCIDR(nbip.Address)
+	device, err := s.librenms.GetDevice(monitoringID)
+	if err != nil {
+		s.logger.Error("could not get LibreNMS device", "device", monitoringID, "error", err)
+		return err
+	}
+	if device.Hostname == addr || device.IP == addr {
+		return nil
+	}
+
+	obj, err := s.nbapi.GetObjectContext(hook.Model, hook.ID())
+	if err != nil {
+		s.logger.Warn("could not get netbox object, using LibreNMS defaults", "model", hook.Model, "id", hook.ID(), "error", err)
+	}
+	profile, _ := s.selectProfile(obj)
+	result := probe.Run(addr, s.probeOptions(profile))
+	if err = verifyDevice(device, result); err != nil {
+		s.netbox.AddJournalEntry(hook.Model, hook.ID(), netbox.WarningLevel, "LibreNMS device %d not moved to new primary IP %s: %v\n\n%s", monitoringID, addr, err, result)
+		return err
+	}
+
+	var change string
+	if _, parseErr := netip.ParseAddr(device.Hostname); parseErr == nil {
+		if err = s.librenms.RenameDevice(monitoringID, addr); err == nil {
+			s.recordUpdate(results.LibreNMS, "device", int64(monitoringID), s.librenms.DeviceURL(monitoringID), toMap(device), map[string]any{"hostname": addr})
+		}
+		change = fmt.Sprintf("hostname changed from %s to %s", device.Hostname, addr)
+	} else {
+		err = s.updateLibreDevice(monitoringID, map[string]interface{}{"overwrite_ip": addr})
+		change = fmt.Sprintf("overwrite_ip set to %s for %s", addr, device.Hostname)
+	}
+	if err != nil {
+		s.logger.Error("could not update LibreNMS device", "device", monitoringID, "address", addr, "error", err)
+		s.netbox.AddJournalEntry(hook.Model, hook.ID(), netbox.WarningLevel, "could not update LibreNMS device %d for new primary IP %s: %v", monitoringID, addr, err)
+		return err
+	}
+	s.logger.Info("moved LibreNMS device to new primary IP", "device", monitoringID, "address", addr)
+	s.appendLibreNote(device, fmt.Sprintf("Netbox primary IP changed: %s", change))
+	return s.netbox.AddJournalEntry(hook.Model, hook.ID(), netbox.SuccessLevel, "LibreNMS device %d %s", monitoringID, change)
+}
+
+// verifyDevice checks the device answered at its new address and, when
+// both are known, that its sysName matches the one LibreNMS has
+func verifyDevice(device librenms.LibreDevice, result probe.Result) error {
+	if !result.OK() {
+		return fmt.Errorf("%w: %s", preflightError(result), result.Failure)
+	}
+	if device.SysName != nil && *device.SysName != "" && result.SysName != "" && !strings.EqualFold(*device.SysName, result.SysName) {
+		return fmt.Errorf("the new address answers as %s, not %s", result.SysName, *device.SysName)
+	}
+	return nil
+}
+
+// appendLibreNote adds a dated line to the LibreNMS device notes
+func (s *Service) appendLibreNote(device librenms.LibreDevice, note string) {
+	line := fmt.Sprintf("%s hookcmd: %s", time.Now().Format(time.DateTime), note)
+	notes := line
+	if device.Notes != nil && *device.Notes != "" {
+		notes = *device.Notes + "\n" + line
+	}
+	if err := s.updateLibreDevice(device.DeviceID, map[string]interface{}{"notes": notes}); err != nil {
+		s.logger.Warn("could not update LibreNMS device notes", "device", device.DeviceID, "error", err)
+	}
+}
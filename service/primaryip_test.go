@@ -0,0 +1,115 @@
+package service
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// newSNMPAgent returns the port of an SNMP v2c agent on 127.0.0.1 that
+// answers every GET with sysName
+func newSNMPAgent(t *testing.T, sysName string) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 65535)
+		decoder := &gosnmp.GoSNMP{Version: gosnmp.Version2c}
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req, err := decoder.SnmpDecodePacket(buf[:n])
+			if err != nil {
+				continue
+			}
+			resp := &gosnmp.SnmpPacket{Version: req.Version, Community: req.Community, PDUType: gosnmp.GetResponse, RequestID: req.RequestID}
+			for _, v := range req.Variables {
+				resp.Variables = append(resp.Variables, gosnmp.SnmpPDU{Name: v.Name, Type: gosnmp.OctetString, Value: []byte(sysName)})
+			}
+			if b, err := resp.MarshalMsg(); err == nil {
+				conn.WriteTo(b, addr)
+			}
+		}
+	}()
+	_, port, _ := net.SplitHostPort(conn.LocalAddr().String())
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+func TestPrimaryIPChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostname string
+		sysName  string
+		// route is the LibreNMS update, empty when nothing is changed
+		route string
+		level string
+	}{
+		{"renamed", "10.0.0.5", "sw1", "PATCH /api/v0/devices/12/rename/127.0.0.1", "success"},
+		{"overwrite_ip", "sw1.example.com", "SW1", "PATCH /api/v0/devices/12", "success"},
+		{"other device", "10.0.0.5", "sw2", "", "warning"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles := []any{map[string]any{"name": "default", "snmp_version": "v2c", "community": "public", "port": newSNMPAgent(t, tt.sysName)}}
+			ts := newTestService(t, map[string]any{"librenms": map[string]any{"profiles": profiles, "preflight": map[string]any{"timeout": "1s"}}})
+			ts.netbox.handle("GET /api/ipam/ip-addresses/31/", http.StatusOK, map[string]any{"id": 31, "address": "127.0.0.1/8"})
+			ts.netbox.handle("GET /api/dcim/devices/5/", http.StatusOK, map[string]any{"id": 5, "name": "sw1"})
+			ts.netbox.handle("POST /api/extras/journal-entries/", http.StatusCreated, map[string]any{"id": 1})
+			ts.librenms.handle("GET /api/v0/devices/12", http.StatusOK, libreDevice(map[string]any{"device_id": 12, "hostname": tt.hostname, "ip": "10.0.0.5", "sysName": "sw1"}))
+			ts.librenms.handle("PATCH /api/v0/devices/12", http.StatusOK, map[string]any{"status": "ok"})
+			ts.librenms.handle("PATCH /api/v0/devices/12/rename/127.0.0.1", http.StatusOK, map[string]any{"status": "ok"})
+
+			pre := map[string]any{"id": 5, "primary_ip4": map[string]any{"id": 30}, "custom_fields": map[string]any{"monitoring_id": 12}}
+			post := map[string]any{"id": 5, "primary_ip4": map[string]any{"id": 31}, "custom_fields": map[string]any{"monitoring_id": 12}}
+			err := ts.PrimaryIPChange(webhook(t, "updated", "device", "admin", pre, post))
+			if (err != nil) != (tt.route == "") {
+				t.Fatalf("got %v", err)
+			}
+
+			var updates []string
+			for _, req := range ts.librenms.writes() {
+				fields, _ := req.Body["field"].([]any)
+				data, _ := req.Body["data"].([]any)
+				if len(fields) == 1 && fields[0] == "notes" {
+					continue
+				}
+				updates = append(updates, req.Method+" "+req.Path)
+				if len(fields) == 1 && (fields[0] != "overwrite_ip" || data[0] != "127.0.0.1") {
+					t.Errorf("updated %v to %v, want overwrite_ip 127.0.0.1", fields, data)
+				}
+			}
+			if tt.route == "" && len(updates) != 0 || tt.route != "" && (len(updates) != 1 || updates[0] != tt.route) {
+				t.Errorf("got LibreNMS updates %v, want %q", updates, tt.route)
+			}
+			journal := ts.netbox.called(http.MethodPost, "/api/extras/journal-entries/")
+			if len(journal) != 1 || journal[0].Body["kind"] != tt.level {
+				t.Fatalf("got journal %+v, want one %s entry", journal, tt.level)
+			}
+			if comments, _ := journal[0].Body["comments"].(string); tt.level == "warning" && !strings.Contains(comments, "answers as sw2") {
+				t.Errorf("journal %q does not give the sysName", comments)
+			}
+		})
+	}
+}
+
+func TestPrimaryIPChangeUnchanged(t *testing.T) {
+	ts := newTestService(t, nil)
+	pre := map[string]any{"id": 5, "name": "old", "primary_ip4": map[string]any{"id": 31}, "custom_fields": map[string]any{"monitoring_id": 12}}
+	post := map[string]any{"id": 5, "name": "new", "primary_ip4": map[string]any{"id": 31}, "custom_fields": map[string]any{"monitoring_id": 12}}
+	if err := ts.PrimaryIPChange(webhook(t, "updated", "device", "admin", pre, post)); err != nil {
+		t.Fatal(err)
+	}
+	if len(ts.netbox.requests) != 0 || len(ts.librenms.requests) != 0 {
+		t.Errorf("got requests %+v %+v, want none", ts.netbox.requests, ts.librenms.requests)
+	}
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/rsapc/hookcmd/config"
+	"github.com/rsapc/hookcmd/librenms"
+	"github.com/rsapc/hookcmd/nbapi"
+)
+
+const (
+	defaultProfileContextKey = "librenms_profile"
+	defaultProfileName       = "default"
+)
+
+// selectProfile returns the LibreNMS device profile for the Netbox object.
+// A profile named in the object's config context wins, then the first
+// profile whose match criteria fit, then the profile named "default".
+func (s *Service) selectProfile(obj nbapi.ObjectContext) (config.DeviceProfile, bool) {
+	profiles := s.config.LibreNMS.Profiles
+	key := s.config.LibreNMS.ProfileContextKey
+	if key == "" {
+		key = defaultProfileContextKey
+	}
+	if name, ok := obj.ConfigContext[key].(string); ok && name != "" {
+		if p, ok := findProfile(profiles, name); ok {
+			return p, true
+		}
+		s.logger.Warn("profile named in config context not found", "profile", name, "object", obj.Name)
+	}
+	for _, p := range profiles {
+		if p.Name != defaultProfileName && profileMatches(p.Match, obj) {
+			return p, true
+		}
+	}
+	return findProfile(profiles, defaultProfileName)
+}
+
+func findProfile(profiles []config.DeviceProfile, name string) (config.DeviceProfile, bool) {
+	for _, p := range profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return config.DeviceProfile{}, false
+}
+
+// profileMatches returns true if every non-empty list in match contains the
+// object's value
+func profileMatches(match config.ProfileMatch, obj nbapi.ObjectContext) bool {
+	if len(match.Sites) > 0 && !slices.Contains(match.Sites, obj.SiteSlug()) {
+		return false
+	}
+	if len(match.Roles) > 0 && !slices.Contains(match.Roles, obj.RoleSlug()) {
+		return false
+	}
+	if len(match.Platforms) > 0 && !slices.Contains(match.Platforms, obj.PlatformSlug()) {
+		return false
+	}
+	if len(match.Tags) > 0 {
+		found := false
+		for _, tag := range obj.TagSlugs() {
+			if slices.Contains(match.Tags, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// newDevice builds the LibreNMS add request for ip using the profile.
+// LibreNMS only takes the OS of a ping only device.
+func newDevice(ip string, name string, p config.DeviceProfile) librenms.NewDevice {
+	device := librenms.NewDevice{
+		Hostname:     ip,
+		Display:      strings.ReplaceAll(p.Display, "{name}", name),
+		Port:         p.Port,
+		Transport:    p.Transport,
+		SNMPVersion:  p.SNMPVersion,
+		Community:    p.Community,
+		AuthLevel:    p.AuthLevel,
+		AuthName:     p.AuthName,
+		AuthPass:     p.AuthPass,
+		AuthAlgo:     p.AuthAlgo,
+		CryptoPass:   p.CryptoPass,
+		CryptoAlgo:   p.CryptoAlgo,
+		PollerGroup:  p.PollerGroup,
+		ForceAdd:     p.ForceAdd,
+		SNMPDisable:  p.SNMPDisable,
+		PingFallback: true,
+	}
+	if p.SNMPDisable {
+		device.Os = p.Os
+	}
+	return device
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/rsapc/hookcmd/nbapi"
+)
+
+var testProfiles = []any{
+	map[string]any{"name": "default", "snmp_version": "v2c", "community": "public"},
+	map[string]any{"name": "core", "match": map[string]any{"roles": []string{"core-switch"}, "sites": []string{"hq"}},
+		"snmp_version": "v3", "auth_level": "authPriv", "auth_name": "librenms", "auth_pass": "authsecret", "auth_algo": "SHA",
+		"crypto_pass": "privsecret", "crypto_algo": "AES", "transport": "udp6", "poller_group": 2, "display": "{name}.core"},
+	map[string]any{"name": "switches", "match": map[string]any{"roles": []string{"core-switch", "access-switch"}}},
+	map[string]any{"name": "ups", "match": map[string]any{"tags": []string{"ups", "pdu"}}, "snmp_disable": true, "os": "ping"},
+}
+
+func TestSelectProfile(t *testing.T) {
+	ts := newTestService(t, map[string]any{"librenms": map[string]any{"profiles": testProfiles}})
+	slug := func(s string) *nbapi.NestedSlug { return &nbapi.NestedSlug{Slug: s} }
+	tests := []struct {
+		name string
+		obj  nbapi.ObjectContext
+		want string
+	}{
+		{"all criteria", nbapi.ObjectContext{Site: slug("hq"), Role: slug("core-switch")}, "core"},
+		{"first match wins", nbapi.ObjectContext{Site: slug("branch"), Role: slug("core-switch")}, "switches"},
+		{"legacy device_role", nbapi.ObjectContext{DeviceRole: slug("access-switch")}, "switches"},
+		{"any tag", nbapi.ObjectContext{Tags: []nbapi.Tag{{Slug: "rack"}, {Slug: "pdu"}}}, "ups"},
+		{"config context", nbapi.ObjectContext{Role: slug("core-switch"), ConfigContext: map[string]any{"librenms_profile": "ups"}}, "ups"},
+		{"unknown context profile", nbapi.ObjectContext{Role: slug("access-switch"), ConfigContext: map[string]any{"librenms_profile": "gone"}}, "switches"},
+		{"default", nbapi.ObjectContext{Role: slug("server")}, "default"},
+	}
+	for _, tt := range tests {
+		p, ok := ts.selectProfile(tt.obj)
+		if !ok || p.Name != tt.want {
+			t.Errorf("%s: got %q (%t), want %s", tt.name, p.Name, ok, tt.want)
+		}
+	}
+
+	ts = newTestService(t, map[string]any{"librenms": map[string]any{"profiles": testProfiles[1:2]}})
+	if p, ok := ts.selectProfile(nbapi.ObjectContext{}); ok {
+		t.Errorf("got %q without a default profile, want none", p.Name)
+	}
+}
+
+func TestAddToLibreNMSProfile(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  map[string]any
+		want map[string]any
+	}{
+		{"v3", map[string]any{"id": 5, "name": "core1", "role": map[string]any{"slug": "core-switch"}, "site": map[string]any{"slug": "hq"}},
+			map[string]any{"hostname": "10.0.0.5", "display": "core1.core", "transport": "udp6", "version": "v3",
+				"authlevel": "authPriv", "authname": "librenms", "authpass": "authsecret", "authalgo": "SHA",
+				"cryptopass": "privsecret", "cryptoalgo": "AES", "poller_group": float64(2), "ping_fallback": true}},
+		{"ping only", map[string]any{"id": 5, "name": "ups1", "tags": []any{map[string]any{"slug": "ups"}}},
+			map[string]any{"hostname": "10.0.0.5", "snmp_disable": true, "os": "ping", "ping_fallback": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestService(t, map[string]any{"librenms": map[string]any{"profiles": testProfiles}})
+			ts.netbox.handle("GET /api/dcim/devices/5/", http.StatusOK, tt.obj)
+			ts.netbox.handle("PATCH /api/dcim/devices/5/", http.StatusOK, tt.obj)
+			ts.netbox.handle("POST /api/extras/journal-entries/", http.StatusCreated, map[string]any{"id": 1})
+			ts.librenms.handle("POST /api/v0/devices", http.StatusOK, map[string]any{"status": "ok", "devices": []any{map[string]any{"device_id": 42}}})
+
+			if err := ts.AddToLibreNMS("10.0.0.5/24", "device", 5, AddOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			posts := ts.librenms.called(http.MethodPost, "/api/v0/devices")
+			if len(posts) != 1 {
+				t.Fatalf("got %d adds, want 1", len(posts))
+			}
+			body := posts[0].Body
+			if len(body) != len(tt.want) {
+				t.Errorf("got body %v, want %v", body, tt.want)
+			}
+			for key, value := range tt.want {
+				if body[key] != value {
+					t.Errorf("%s = %v, want %v", key, body[key], value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rsapc/hookcmd/results"
+)
+
+// Result returns what the command has done so far
+func (s *Service) Result() *results.Result {
+	return s.result
+}
+
+// linkObjects links the result to the Netbox object and LibreNMS device
+func (s *Service) linkObjects(model string, id int64, deviceID int) {
+	s.result.AddLink(fmt.Sprintf("Netbox %s %d", model, id), s.nbapi.ObjectURL(model, id))
+	s.result.AddLink(fmt.Sprintf("LibreNMS device %d", deviceID), s.librenms.DeviceURL(deviceID))
+}
+
+// updateObject patches the Netbox object and records each changed field
+// with its previous value.  The object is not changed if it cannot be
+// read first, as the previous values would be lost to undo.
+func (s *Service) updateObject(model string, id int64, data map[string]interface{}) error {
+	before, err := s.nbapi.GetObject(model, id)
+	if err != nil {
+		s.logger.Error("could not get object before update", "model", model, "id", id, "error", err)
+		err = fmt.Errorf("could not get %s %d before update: %w", model, id, err)
+		s.auditFailure(results.Netbox, model, id, data, err)
+		return err
+	}
+	if err = s.nbapi.UpdateObject(model, id, data); err != nil {
+		s.auditFailure(results.Netbox, model, id, data, err)
+		return err
+	}
+	s.recordUpdate(results.Netbox, model, id, s.nbapi.ObjectURL(model, id), before, data)
+	return nil
+}
+
+// updateLibreDevice sets the fields of the LibreNMS device and records
+// each changed field with its previous value.  Like updateObject, the
+// device is not changed if it cannot be read first.
+func (s *Service) updateLibreDevice(deviceID int, fields map[string]interface{}) error {
+	device, err := s.librenms.GetDevice(deviceID)
+	if err != nil {
+		s.logger.Error("could not get LibreNMS device before update", "device", deviceID, "error", err)
+		err = fmt.Errorf("could not get LibreNMS device %d before update: %w", deviceID, err)
+		s.auditFailure(results.LibreNMS, "device", int64(deviceID), fields, err)
+		return err
+	}
+	before := toMap(device)
+	if err := s.librenms.UpdateDevice(deviceID, fields); err != nil {
+		s.auditFailure(results.LibreNMS, "device", int64(deviceID), fields, err)
+		return err
+	}
+	s.recordUpdate(results.LibreNMS, "device", int64(deviceID), s.librenms.DeviceURL(deviceID), before, fields)
+	return nil
+}
+
+// recordUpdate adds a change for each field in data that differs from
+// before.  Custom fields are recorded individually.
+func (s *Service) recordUpdate(system string, model string, id int64, url string, before map[string]any, data map[string]any) {
+	name := objectName(before)
+	var changes []results.Change
+	add := func(field string, old any, new any) {
+		old = flatten(old)
+		if sameValue(old, new) {
+			return
+		}
+		changes = append(changes, results.Change{Action: results.Update, System: system, Model: model, ID: id,
+			Name: name, Field: field, Old: old, New: new, URL: url})
+	}
+	for field, new := range data {
+		if cf, ok := new.(map[string]interface{}); ok && field == "custom_fields" {
+			oldCF, _ := before["custom_fields"].(map[string]any)
+			for key, value := range cf {
+				add("custom_fields."+key, oldCF[key], value)
+			}
+			continue
+		}
+		add(field, before[field], new)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	for _, c := range changes {
+		s.result.AddChange(c)
+	}
+	s.auditChanges(nil, changes...)
+}
+
+// recordCreate records a created object
+func (s *Service) recordCreate(system string, model string, id int64, name string) {
+	var url string
+	switch {
+	case id == 0:
+	case system == results.Netbox:
+		url = s.nbapi.ObjectURL(model, id)
+	case model == "device":
+		url = s.librenms.DeviceURL(int(id))
+	}
+	s.addChange(results.Change{Action: results.Create, System: system, Model: model, ID: id, Name: name, URL: url})
+}
+
+// recordDelete records a deleted object
+func (s *Service) recordDelete(system string, model string, id int64, name string) {
+	s.addChange(results.Change{Action: results.Delete, System: system, Model: model, ID: id, Name: name})
+}
+
+// toMap converts a struct to a map keyed by its JSON field names
+func toMap(v any) map[string]any {
+	var m map[string]any
+	data, err := json.Marshal(v)
+	if err == nil {
+		json.Unmarshal(data, &m)
+	}
+	return m
+}
+
+// objectName returns the name of a decoded Netbox or LibreNMS object
+func objectName(obj map[string]any) string {
+	for _, key := range []string{"display", "name", "hostname"} {
+		if name, ok := obj[key].(string); ok && name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// sameValue returns true if the values are the same once written
+func sameValue(a any, b any) bool {
+	return (a == nil) == (b == nil) && fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// fieldValue returns the flattened value of the field of a decoded
+// object.  Custom fields are given as custom_fields.name.
+func fieldValue(obj map[string]any, field string) any {
+	if name, ok := strings.CutPrefix(field, "custom_fields."); ok {
+		cf, _ := obj["custom_fields"].(map[string]any)
+		return flatten(cf[name])
+	}
+	return flatten(obj[field])
+}
+
+// flatten reduces the nested objects Netbox returns for choice and
+// related fields to the value that is written
+func flatten(v any) any {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	if value, ok := obj["value"]; ok {
+		return value
+	}
+	if id, ok := obj["id"]; ok {
+		return id
+	}
+	return v
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rsapc/hookcmd/audit"
+)
+
+func TestUpdateObjectNeedsBefore(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.netbox.handle("GET /api/dcim/devices/5/", http.StatusServiceUnavailable, map[string]any{"detail": "maintenance"})
+	ts.netbox.handle("PATCH /api/dcim/devices/5/", http.StatusOK, map[string]any{"id": 5})
+
+	if err := ts.updateObject("device", 5, map[string]any{"serial": "FOC1234"}); err == nil {
+		t.Fatal("the update was made without the previous values")
+	}
+	if patches := ts.netbox.called(http.MethodPatch, "/api/dcim/devices/5/"); len(patches) != 0 {
+		t.Errorf("device 5 was patched %d times", len(patches))
+	}
+	entries := ts.auditEntries(t)
+	if len(entries) != 1 || entries[0].Field != "serial" || entries[0].Result != audit.ResultFailed {
+		t.Errorf("got %+v, want the serial update failed", entries)
+	}
+}
+
+func TestUpdateLibreDeviceNeedsBefore(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.librenms.handle("GET /api/v0/devices/12", http.StatusInternalServerError, map[string]any{"status": "error", "message": "database unavailable"})
+	ts.librenms.handle("PATCH /api/v0/devices/12", http.StatusOK, map[string]any{"status": "ok"})
+
+	if err := ts.updateLibreDevice(12, map[string]any{"disabled": 1}); err == nil {
+		t.Fatal("the update was made without the previous values")
+	}
+	if patches := ts.librenms.called(http.MethodPatch, "/api/v0/devices/12"); len(patches) != 0 {
+		t.Errorf("device 12 was patched %d times", len(patches))
+	}
+	entries := ts.auditEntries(t)
+	if len(entries) != 1 || entries[0].Field != "disabled" || entries[0].Result != audit.ResultFailed {
+		t.Errorf("got %+v, want the disabled update failed", entries)
+	}
+}
+
+func TestUpdateObjectHTML(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.netbox.handle("GET /api/dcim/devices/5/", http.StatusOK, map[string]any{"id": 5, "name": "<b>sw1</b>", "description": "<script>alert(1)</script>"})
+	ts.netbox.handle("PATCH /api/dcim/devices/5/", http.StatusOK, map[string]any{"id": 5})
+
+	if err := ts.updateObject("device", 5, map[string]any{"description": "core & <edge>"}); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := ts.Result().WriteHTML(&out); err != nil {
+		t.Fatal(err)
+	}
+	page := out.String()
+	if strings.Contains(page, "<b>") || strings.Contains(page, "<script>") || strings.Contains(page, "<edge>") {
+		t.Errorf("the Netbox values were not escaped:\n%s", page)
+	}
+	for _, escaped := range []string{"device &lt;b&gt;sw1&lt;/b&gt;", "&lt;script&gt;alert(1)&lt;/script&gt;", "core &amp; &lt;edge&gt;"} {
+		if !strings.Contains(page, escaped) {
+			t.Errorf("the page does not contain %s:\n%s", escaped, page)
+		}
+	}
+}
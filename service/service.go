@@ -5,76 +5,154 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net"
 	"os"
+	"strings"
+	"sync"
 
 	"golang.org/x/exp/slog"
 
+	"github.com/rsapc/hookcmd/audit"
+	"github.com/rsapc/hookcmd/config"
+	"github.com/rsapc/hookcmd/dnsupdate"
 	"github.com/rsapc/hookcmd/librenms"
 	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/hookcmd/nbapi"
+	"github.com/rsapc/hookcmd/notify"
+	"github.com/rsapc/hookcmd/resolver"
+	"github.com/rsapc/hookcmd/results"
 	"github.com/rsapc/netbox"
 )
 
 var ErrUnimplemented = errors.New("method has not been implemented")
 
 type Service struct {
-	getenv   func(string) string
-	logger   models.Logger
-	netbox   *netbox.Client
-	librenms *librenms.Client
+	getenv    func(string) string
+	logger    models.Logger
+	config    *config.Config
+	resolvers *resolver.Set
+	dnsupdate *dnsupdate.Client
+	netbox    *netbox.Client
+	nbapi     *nbapi.Client
+	librenms  *librenms.Client
+	notify    *notify.Dispatcher
+	result    *results.Result
+	audit     *audit.Log
+	auditOnce sync.Once
+	// Netbox version, fetched when first needed
+	nbStatus   nbapi.Status
+	statusOnce sync.Once
+	// command and event that started the run
+	command string
+	event   string
 }
 
 // NewService creates a new instance of the service.
 //
 //	getenv: a function to return envvars.  If nil
 //	        gets set to os.GetEnv
+//
+// The config file is read from HOOKCMD_CONFIG when set.
 func NewService(getenv func(string) string, logger models.Logger) *Service {
-	s := &Service{}
+	s := &Service{result: &results.Result{RunID: audit.NewRunID()}}
 	if getenv == nil {
 		s.getenv = os.Getenv
 	} else {
 		s.getenv = getenv
 	}
 	if logger == nil {
-		s.logger = slog.Default()
+		s.logger = slog.New(results.NewLogHandler(slog.Default().Handler(), s.result))
 	} else {
 		s.logger = logger
 	}
+	cfg, err := config.Load(s.getenv("HOOKCMD_CONFIG"))
+	if err != nil {
+		s.logger.Error("could not load config", "error", err)
+	}
+	s.config = cfg
+	s.resolvers = resolver.NewSet(cfg.DNS)
+	s.dnsupdate = dnsupdate.NewClient(cfg.DNS.Updates, s.logger)
 	s.netbox = netbox.NewClient(s.getenv("NETBOX_URL"), s.getenv("NETBOX_TOKEN"), s.logger)
+	s.nbapi = nbapi.NewClient(s.getenv("NETBOX_URL"), s.getenv("NETBOX_TOKEN"), s.logger)
 	s.librenms = librenms.NewClient(s.getenv("LIBRENMS_URL"), s.getenv("LIBRENMS_TOKEN"), s.logger)
+	s.notify = notify.New(cfg.Notify, s.logger)
 	return s
 }
 
+// Config returns the settings loaded from the config file
+func (s *Service) Config() *config.Config {
+	return s.config
+}
+
+// IPdnsUpdate does a forward-confirmed reverse lookup of the address.
+// An empty dns_name in Netbox is set to the confirmed name and the
+// dns_status custom field records whether the records match.
 func (s *Service) IPdnsUpdate(addr string) error {
 	ip := netbox.IPfromCIDR(addr)
-	addrs, err := net.LookupAddr(ip)
+	if err := s.ensureDNSField(); err != nil {
+		return err
+	}
+	nbips, err := s.nbapi.ListIPAddresses("address=" + ip)
 	if err != nil {
-		slog.Error("Could not find address", "err", err)
-		os.Exit(1)
+		s.logger.Error(fmt.Sprintf("Failed to find Netbox IPAddress record: %v", err))
+		return fmt.Errorf("failed to find Netbox IPAddress record: %w", err)
 	}
-
-	if len(addrs) > 0 {
-		err = s.netbox.SetIPDNS(ip, addrs[0])
-		if err != nil {
-			s.logger.Error(fmt.Sprintf("Failed to update Netbox IPAddress record: %v", err))
-			return fmt.Errorf("failed to update Netbox IPAddress record")
+	for _, nbip := range nbips {
+		if err = s.refreshIPDNS(nbip); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-// AddToLibreNMS adds the IP to libre and updates Netbox
-func (s *Service) AddToLibreNMS(addr string, model string, modelID int64) error {
+// AddToLibreNMS adds the IP to libre and updates Netbox.  The SNMP
+// credentials and add options come from the device profile selected for
+// the Netbox object.  Nothing is done if the object already has a
+// monitoring_id that exists in LibreNMS.
+//
+// With opts.Probe (or preflight enabled in the config) the address is
+// probed first and the diagnostic is written to the journal.  The device
+// is not added if the probe fails unless the profile forces the add.
+func (s *Service) AddToLibreNMS(addr string, model string, modelID int64, opts AddOptions) error {
 	ip := netbox.IPfromCIDR(addr)
-	devid, err := s.librenms.AddDevice(ip)
+	if nbdev, err := s.netbox.GetDeviceOrVMbyType(model, modelID); err == nil && nbdev.CustomFields.MonitoringID != nil && !opts.ProbeOnly {
+		if _, err = s.librenms.GetDevice(*nbdev.CustomFields.MonitoringID); err == nil {
+			s.logger.Info("device is already in LibreNMS", "model", model, "id", modelID, "monitoring_id", *nbdev.CustomFields.MonitoringID)
+			return nil
+		}
+	}
+	obj, err := s.nbapi.GetObjectContext(model, modelID)
+	if err != nil {
+		s.logger.Warn("could not get netbox object, using LibreNMS defaults", "model", model, "id", modelID, "error", err)
+	}
+	profile, _ := s.selectProfile(obj)
+	s.result.AddLink(fmt.Sprintf("Netbox %s %d", model, modelID), s.nbapi.ObjectURL(model, modelID))
+	if opts.Probe || opts.ProbeOnly || s.config.LibreNMS.Preflight.Enabled {
+		result := s.preflight(ip, model, modelID, profile)
+		if !result.OK() && (opts.ProbeOnly || !profile.ForceAdd) {
+			return fmt.Errorf("%w for %s: %s", preflightError(result), ip, result.Failure)
+		}
+		if opts.ProbeOnly {
+			return nil
+		}
+	}
+	devid, err := s.librenms.AddDevice(newDevice(ip, obj.Name, profile))
 	if err != nil {
 		s.netbox.AddJournalEntry(model, modelID, netbox.WarningLevel, err.Error())
+		s.auditCreateFailure(results.LibreNMS, "device", ip, err)
 		return err
 	}
-	if err = s.netbox.AddJournalEntry(model, modelID, netbox.InfoLevel, fmt.Sprintf("added device to LibreNMS.  id=%d", devid)); err != nil {
+	s.recordCreate(results.LibreNMS, "device", int64(devid), ip)
+	if err = s.netbox.AddJournalEntry(model, modelID, netbox.InfoLevel, fmt.Sprintf("added device to LibreNMS.  id=%d profile=%s", devid, profile.Name)); err != nil {
 		s.logger.Error(fmt.Sprintf("could not add journal entry: %v", err), "service", "service")
 	}
-	return s.netbox.SetMonitoringID(model, modelID, devid)
+	s.notify.Send(notify.Event{Type: notify.DeviceAdded, Model: model, ID: modelID, DeviceID: devid,
+		Subject: fmt.Sprintf("%s added to LibreNMS", ip), Message: fmt.Sprintf("LibreNMS device %d, profile %s", devid, profile.Name)})
+	if err = s.netbox.SetMonitoringID(model, modelID, devid); err != nil {
+		return err
+	}
+	s.recordUpdate(results.Netbox, model, modelID, s.nbapi.ObjectURL(model, modelID), toMap(obj),
+		map[string]any{"custom_fields": map[string]any{"monitoring_id": devid}})
+	return nil
 }
 
 // DeviceDown will set the device status in Netbox based on the
@@ -107,15 +185,17 @@ func (s *Service) DeviceDown(payload string) error {
 	case librenms.AlertFiring:
 		// if this is the first occurance of the alert
 		if alert.ID == alert.UID {
-			err = s.netbox.UpdateObject(objectType, objectID, data)
+			err = s.updateObject(objectType, objectID, data)
 			if err != nil {
 				return err
 			}
+			s.notify.Send(notify.Event{Type: notify.DeviceOffline, Model: objectType, ID: objectID, DeviceID: alert.DeviceID,
+				Subject: fmt.Sprintf("%s is offline", alert.SysName), Message: alert.Subject})
 			return s.netbox.AddJournalEntry(objectType, objectID, netbox.DangerLevel, journalEntry)
 		}
 	case librenms.AlertCleared:
 		data["status"] = "active"
-		err = s.netbox.UpdateObject(objectType, objectID, data)
+		err = s.updateObject(objectType, objectID, data)
 		if err != nil {
 			return err
 		}
@@ -124,12 +204,14 @@ func (s *Service) DeviceDown(payload string) error {
 	return nil
 }
 
-func (s *Service) GetDeviceInfo(deviceID int) error {
+func (s *Service) GetDeviceInfo(deviceID int) (err error) {
+	defer s.notifyFailure("device", deviceID, &err)
 	netboxType, netboxID, err := s.netbox.FindMonitoredObject(deviceID)
 	if err != nil {
 		s.logger.Error("could not find netbox device", "device_id", deviceID, "error", err)
 		return err
 	}
+	s.linkObjects(netboxType, netboxID, deviceID)
 	device, err := s.librenms.GetDevice(deviceID)
 	if err != nil {
 		return err
@@ -158,6 +240,14 @@ func (s *Service) updateDeviceInfo(device librenms.LibreDevice, netboxType strin
 	}
 	s.netbox.AddJournalEntry(netboxType, netboxID, netbox.SuccessLevel, "device updated with values from LibreNMS\n\nUpdate Data:\n%s", data)
 	s.logger.Info("successfully updated device from LibreNMS", "deviceType", netboxType, "ID", netboxID)
+	if err = s.trackUptime(device, netboxType, netboxID); err != nil {
+		s.logger.Warn("could not track uptime", "ID", netboxID, "error", err)
+	}
+	if netboxType == "virtualmachine" {
+		if err = s.updateVMResources(device.DeviceID, netboxID); err != nil {
+			s.logger.Warn("could not update VM resources", "ID", netboxID, "error", err)
+		}
+	}
 	return s.UpdatePortDescriptions(netboxType, nbdev.ID, device.DeviceID)
 }
 
@@ -188,15 +278,15 @@ func (s *Service) updateNetboxDevice(device librenms.LibreDevice, nbdev netbox.D
 		data["serial"] = *device.Serial
 	}
 
-	if device.Lat != nil {
-		data["latitude"] = *device.Lat
-	}
-	if device.Lng != nil {
-		data["longitude"] = *device.Lng
+	// coordinates are not copied; the Netbox site is authoritative and
+	// locationsync pushes them to LibreNMS
+	model := "device"
+	if strings.Contains(nbdev.URL, "/virtualization/") {
+		model = "virtualmachine"
 	}
 
 	d, _ := json.Marshal(data)
-	return string(d), s.netbox.UpdateObjectByURL(nbdev.URL, data)
+	return string(d), s.updateObject(model, int64(nbdev.ID), data)
 }
 
 // FindDevice searches for a device by IP
@@ -218,6 +308,7 @@ func (s *Service) FindDevice(addr string) error {
 	if err != nil {
 		return err
 	}
+	s.result.AddLink(fmt.Sprintf("LibreNMS device %d", device.DeviceID), s.librenms.DeviceURL(device.DeviceID))
 	_, err = s.updateNetboxDevice(device, nbdev)
 	if err != nil {
 		errMsg := fmt.Sprintf("could not update Netbox device: %v", err)
@@ -276,6 +367,9 @@ func (s *Service) UpdatePortDescriptions(netboxType string, netboxDevice int, li
 			s.logger.Error("could not load interfaces from netbox", "error", err)
 		}
 	}
+	if netboxType == "virtualmachine" {
+		return s.updateVMInterfaces(netboxDevice, ports, intfs)
+	}
 	// create a map keyed by interface name for referencing / updating
 	nbInts := make(map[string]netbox.Interface)
 	for _, intf := range intfs {
@@ -299,8 +393,10 @@ func (s *Service) UpdatePortDescriptions(netboxType string, netboxDevice int, li
 				body, _ := json.Marshal(ifUpd)
 				if err = s.netbox.UpdateInterface(netboxType, int64(intf.ID), *ifUpd); err != nil {
 					s.logger.Error("failed to update interface", "device", netboxDevice, "interface", port.IfName, "error", err)
+					s.auditFailure(results.Netbox, "interface", int64(intf.ID), toMap(ifUpd), err)
 					s.netbox.AddJournalEntry("interface", int64(intf.ID), netbox.InfoLevel, "failed to update interface %s: %v\n\n```json%s\n```", port.IfName, err, string(body))
 				} else {
+					s.recordUpdate(results.Netbox, "interface", int64(intf.ID), s.nbapi.ObjectURL("interface", int64(intf.ID)), toMap(intf), toMap(ifUpd))
 					s.netbox.AddJournalEntry("interface", int64(intf.ID), netbox.SuccessLevel, "updated interface: [%s](/dcim/interfaces/%d)\n\n```json\n%s\n```", port.IfName, intf.ID, string(body))
 				}
 			}
@@ -319,11 +415,16 @@ func (s *Service) UpdatePortDescriptions(netboxType string, netboxDevice int, li
 			}
 			ifUpd.SetMac(port.GetPhysAddress())
 			body, _ := json.Marshal(ifUpd)
-			if err = s.netbox.AddInterface(netboxType, int64(netboxDevice), *ifUpd); err != nil {
+			added, err := s.nbapi.AddInterface(*ifUpd)
+			if err != nil {
 				s.logger.Error("failed to add interface", "device", netboxDevice, "interface", port.IfName, "error", err)
+				s.auditCreateFailure(results.Netbox, "interface", port.IfName, err)
 				s.netbox.AddJournalEntry("device", int64(netboxDevice), netbox.InfoLevel, "failed to add interface %s: %v\n\n```json\n%s\n```", port.IfName, err, string(body))
+				s.notify.Send(notify.Event{Type: notify.UnmappedInterface, Model: "device", ID: int64(netboxDevice), DeviceID: libreDevice,
+					Subject: fmt.Sprintf("could not add interface %s to Netbox", port.IfName), Message: err.Error()})
 			} else {
 				s.netbox.AddJournalEntry("device", int64(netboxDevice), netbox.SuccessLevel, "added new interface: %s\n\n```json\n%s\n```", port.IfName, string(body))
+				s.recordCreate(results.Netbox, "interface", int64(added.ID), port.IfName)
 			}
 		}
 	}
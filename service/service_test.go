@@ -0,0 +1,188 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/rsapc/hookcmd/audit"
+)
+
+// fakeAPI is a Netbox or LibreNMS server that answers "METHOD path?query"
+// or "METHOD path" with canned JSON and records the requests made.
+// Anything else is a 404.
+type fakeAPI struct {
+	mu        sync.Mutex
+	responses map[string]fakeResponse
+	requests  []fakeRequest
+}
+
+type fakeResponse struct {
+	status int
+	body   any
+	// fn answers instead of status and body when set
+	fn func(req fakeRequest) (int, any)
+}
+
+type fakeRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Body   map[string]any
+}
+
+func newFakeAPI(t *testing.T) (*fakeAPI, string) {
+	api := &fakeAPI{responses: make(map[string]fakeResponse)}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	return api, srv.URL
+}
+
+// handle sets the response to "METHOD path" or "METHOD path?query"
+func (api *fakeAPI) handle(route string, status int, body any) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.responses[route] = fakeResponse{status: status, body: body}
+}
+
+// handleFunc answers "METHOD path" or "METHOD path?query" with fn
+func (api *fakeAPI) handleFunc(route string, fn func(req fakeRequest) (int, any)) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.responses[route] = fakeResponse{fn: fn}
+}
+
+func (api *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, _ := io.ReadAll(r.Body)
+	req := fakeRequest{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery}
+	json.Unmarshal(data, &req.Body)
+	api.mu.Lock()
+	api.requests = append(api.requests, req)
+	resp, ok := api.responses[r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery]
+	if !ok {
+		resp, ok = api.responses[r.Method+" "+r.URL.Path]
+	}
+	api.mu.Unlock()
+	if !ok {
+		resp = fakeResponse{status: http.StatusNotFound, body: map[string]any{"detail": "Not found."}}
+	}
+	if resp.fn != nil {
+		resp.status, resp.body = resp.fn(req)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.status)
+	json.NewEncoder(w).Encode(resp.body)
+}
+
+// called returns the requests made with the method to the path
+func (api *fakeAPI) called(method string, path string) []fakeRequest {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	var reqs []fakeRequest
+	for _, req := range api.requests {
+		if req.Method == method && req.Path == path {
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs
+}
+
+// writes returns the requests that changed something
+func (api *fakeAPI) writes() []fakeRequest {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	var reqs []fakeRequest
+	for _, req := range api.requests {
+		if req.Method != http.MethodGet {
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs
+}
+
+type testService struct {
+	*Service
+	netbox   *fakeAPI
+	librenms *fakeAPI
+}
+
+// newTestService returns a service using fake Netbox and LibreNMS
+// servers, the config and an audit log in a temporary directory
+func newTestService(t *testing.T, cfg map[string]any) *testService {
+	t.Helper()
+	dir := t.TempDir()
+	if cfg == nil {
+		cfg = make(map[string]any)
+	}
+	cfg["audit"] = map[string]any{"file": filepath.Join(dir, "audit.log")}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfgFile := filepath.Join(dir, "config.json")
+	if err = os.WriteFile(cfgFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ts := &testService{}
+	var netboxURL, libreURL string
+	ts.netbox, netboxURL = newFakeAPI(t)
+	ts.librenms, libreURL = newFakeAPI(t)
+	env := map[string]string{
+		"HOOKCMD_CONFIG": cfgFile,
+		"NETBOX_URL":     netboxURL,
+		"NETBOX_TOKEN":   "token",
+		"LIBRENMS_URL":   libreURL,
+		"LIBRENMS_TOKEN": "token",
+	}
+	ts.Service = NewService(func(key string) string { return env[key] }, nil)
+	return ts
+}
+
+// auditEntries returns the entries of the run in the audit log
+func (ts *testService) auditEntries(t *testing.T) []audit.Entry {
+	t.Helper()
+	log, err := ts.AuditLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := log.Query(audit.Filter{RunID: ts.RunID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+// libreDevice is a LibreNMS get device response
+func libreDevice(device map[string]any) map[string]any {
+	return map[string]any{"status": "ok", "count": 1, "devices": []any{device}}
+}
+
+// netboxList is a single page Netbox list response
+func netboxList(results ...any) map[string]any {
+	if results == nil {
+		results = []any{}
+	}
+	return map[string]any{"count": len(results), "next": nil, "results": results}
+}
+
+// webhook returns a Netbox webhook payload
+func webhook(t *testing.T, event string, model string, username string, pre map[string]any, data map[string]any) string {
+	t.Helper()
+	payload := map[string]any{
+		"event":     event,
+		"model":     model,
+		"username":  username,
+		"data":      data,
+		"snapshots": map[string]any{"prechange": pre, "postchange": data},
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
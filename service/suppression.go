@@ -0,0 +1,149 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rsapc/hookcmd/librenms"
+	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/netbox"
+)
+
+// monitoring modes set from Netbox
+const (
+	MonitoringMuted    = "muted"
+	MonitoringIgnore   = "ignore"
+	MonitoringDisabled = "disabled"
+)
+
+const (
+	defaultSuppressionField = "monitoring"
+	// cfMonitoringState shows the flags in effect in LibreNMS
+	cfMonitoringState = "monitoring_state"
+)
+
+// monitoringFlags are the LibreNMS device flags controlled from Netbox
+type monitoringFlags struct {
+	disableNotify bool
+	ignore        bool
+	disabled      bool
+}
+
+func libreFlags(device librenms.LibreDevice) monitoringFlags {
+	return monitoringFlags{
+		disableNotify: device.DisableNotify != 0,
+		ignore:        device.Ignore != 0,
+		disabled:      device.Disabled != 0,
+	}
+}
+
+// String returns the flags as shown in the monitoring_state custom field
+func (f monitoringFlags) String() string {
+	onOff := func(b bool) string {
+		if b {
+			return "on"
+		}
+		return "off"
+	}
+	return fmt.Sprintf("notify=%s ignore=%s disabled=%s", onOff(!f.disableNotify), onOff(f.ignore), onOff(f.disabled))
+}
+
+// set turns on the flag for mode
+func (f *monitoringFlags) set(mode string) {
+	switch mode {
+	case MonitoringMuted:
+		f.disableNotify = true
+	case MonitoringIgnore:
+		f.ignore = true
+	case MonitoringDisabled:
+		f.disabled = true
+	}
+}
+
+// desiredFlags returns the flags selected by the object's tags and
+// monitoring custom field
+func (s *Service) desiredFlags(snap models.Snapshot) (flags monitoringFlags) {
+	cfg := s.config.LibreNMS.Suppression
+	field := cfg.Field
+	if field == "" {
+		field = defaultSuppressionField
+	}
+	flags.set(strings.ToLower(snap.CustomFields().Value(field)))
+	for _, slug := range snap.TagSlugs() {
+		if cfg.Tags == nil {
+			flags.set(slug)
+		} else if mode, ok := cfg.Tags[slug]; ok {
+			flags.set(mode)
+		}
+	}
+	return flags
+}
+
+// ApplyMonitoringState handles a Netbox device or VM webhook.  Tags and
+// the monitoring custom field select whether the LibreNMS device is muted
+// (disable_notify), ignored or disabled.  The LibreNMS flags are updated
+// to match and the flags in effect are written back to the
+// monitoring_state custom field.
+func (s *Service) ApplyMonitoringState(payload string) error {
+	hook, err := models.ParseWebhook(payload)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return err
+	}
+	if hook.Model != "device" && hook.Model != "virtualmachine" {
+		return fmt.Errorf("%w: monitoring expects a device or virtualmachine webhook, got %s", models.ErrValidation, hook.Model)
+	}
+	post := hook.Post()
+	if post == nil {
+		return nil
+	}
+	monitoringID := post.CustomFields().Int("monitoring_id")
+	if monitoringID == 0 {
+		s.logger.Info("object is not monitored", "model", hook.Model, "id", hook.ID())
+		return nil
+	}
+	device, err := s.librenms.GetDevice(monitoringID)
+	if err != nil {
+		s.logger.Error("could not get LibreNMS device", "device", monitoringID, "error", err)
+		return err
+	}
+	current := libreFlags(device)
+	want := s.desiredFlags(post)
+
+	if want != current {
+		fields := make(map[string]interface{})
+		if want.disableNotify != current.disableNotify {
+			fields["disable_notify"] = boolInt(want.disableNotify)
+		}
+		if want.ignore != current.ignore {
+			fields["ignore"] = boolInt(want.ignore)
+		}
+		if want.disabled != current.disabled {
+			fields["disabled"] = boolInt(want.disabled)
+		}
+		if err = s.updateLibreDevice(monitoringID, fields); err != nil {
+			s.netbox.AddJournalEntry(hook.Model, hook.ID(), netbox.WarningLevel, "could not update LibreNMS device %d to %s: %v", monitoringID, want, err)
+			return err
+		}
+		s.logger.Info("updated LibreNMS monitoring flags", "device", monitoringID, "from", current.String(), "to", want.String())
+		s.netbox.AddJournalEntry(hook.Model, hook.ID(), netbox.InfoLevel, "LibreNMS device %d changed from %s to %s", monitoringID, current, want)
+		current = want
+	}
+
+	if post.CustomFields().String(cfMonitoringState) == current.String() {
+		return nil
+	}
+	if err = s.nbapi.EnsureCustomField(cfMonitoringState, "Monitoring state", "text", "dcim.device", "virtualization.virtualmachine"); err != nil {
+		s.logger.Error("could not add custom field", "field", cfMonitoringState, "error", err)
+		return err
+	}
+	data := map[string]interface{}{"custom_fields": map[string]interface{}{cfMonitoringState: current.String()}}
+	return s.updateObject(hook.Model, hook.ID(), data)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
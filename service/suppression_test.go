@@ -0,0 +1,76 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/rsapc/hookcmd/models"
+)
+
+// snapshot returns a webhook snapshot with the tags and custom fields
+func snapshot(cf map[string]any, tags ...any) models.Snapshot {
+	return models.Snapshot{"id": float64(5), "custom_fields": cf, "tags": tags}
+}
+
+func TestDesiredFlags(t *testing.T) {
+	tag := func(slug string) any { return map[string]any{"slug": slug} }
+	tests := []struct {
+		name string
+		cfg  map[string]any
+		snap models.Snapshot
+		want monitoringFlags
+	}{
+		{"none", nil, snapshot(nil), monitoringFlags{}},
+		{"field", nil, snapshot(map[string]any{"monitoring": "Muted"}), monitoringFlags{disableNotify: true}},
+		{"field choice", nil, snapshot(map[string]any{"monitoring": map[string]any{"value": "disabled", "label": "Disabled"}}), monitoringFlags{disabled: true}},
+		{"default tags", nil, snapshot(nil, tag("ignore"), tag("muted"), tag("rack")), monitoringFlags{disableNotify: true, ignore: true}},
+		{"tag and field", nil, snapshot(map[string]any{"monitoring": "ignore"}, "disabled"), monitoringFlags{ignore: true, disabled: true}},
+		{"custom field name", map[string]any{"field": "alerting"}, snapshot(map[string]any{"monitoring": "muted", "alerting": "ignore"}), monitoringFlags{ignore: true}},
+		{"mapped tags", map[string]any{"tags": map[string]any{"maintenance": "muted", "lab": "ignore"}},
+			snapshot(nil, tag("maintenance"), tag("disabled")), monitoringFlags{disableNotify: true}},
+		{"unknown mode", map[string]any{"tags": map[string]any{"lab": "paused"}}, snapshot(map[string]any{"monitoring": "off"}, tag("lab")), monitoringFlags{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestService(t, map[string]any{"librenms": map[string]any{"suppression": tt.cfg}})
+			if got := ts.desiredFlags(tt.snap); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyMonitoringState(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.librenms.handle("GET /api/v0/devices/12", http.StatusOK, libreDevice(map[string]any{"device_id": 12, "hostname": "sw1", "disable_notify": 0, "ignore": 1, "disabled": 0}))
+	ts.librenms.handle("PATCH /api/v0/devices/12", http.StatusOK, map[string]any{"status": "ok"})
+	ts.netbox.handle("GET /api/extras/custom-fields/", http.StatusOK, netboxList(map[string]any{"id": 1}))
+	ts.netbox.handle("GET /api/dcim/devices/5/", http.StatusOK, map[string]any{"id": 5, "name": "sw1"})
+	ts.netbox.handle("PATCH /api/dcim/devices/5/", http.StatusOK, map[string]any{"id": 5})
+	ts.netbox.handle("POST /api/extras/journal-entries/", http.StatusCreated, map[string]any{"id": 1})
+
+	data := map[string]any{"id": 5, "custom_fields": map[string]any{"monitoring_id": 12, "monitoring": "muted"}}
+	if err := ts.ApplyMonitoringState(webhook(t, "updated", "device", "admin", data, data)); err != nil {
+		t.Fatal(err)
+	}
+	patches := ts.librenms.called(http.MethodPatch, "/api/v0/devices/12")
+	if len(patches) != 1 {
+		t.Fatalf("got %d LibreNMS updates, want 1", len(patches))
+	}
+	fields, _ := patches[0].Body["field"].([]any)
+	values, _ := patches[0].Body["data"].([]any)
+	got := make(map[any]any)
+	for i := range fields {
+		got[fields[i]] = values[i]
+	}
+	if len(got) != 2 || got["disable_notify"] != float64(1) || got["ignore"] != float64(0) {
+		t.Errorf("got %v, want disable_notify on and ignore off", got)
+	}
+	nbPatches := ts.netbox.called(http.MethodPatch, "/api/dcim/devices/5/")
+	if len(nbPatches) != 1 {
+		t.Fatalf("got %d Netbox updates, want 1", len(nbPatches))
+	}
+	if cf, _ := nbPatches[0].Body["custom_fields"].(map[string]any); cf[cfMonitoringState] != "notify=off ignore=off disabled=off" {
+		t.Errorf("monitoring_state = %v", cf[cfMonitoringState])
+	}
+}
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rsapc/hookcmd/audit"
+	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/hookcmd/nbapi"
+	"github.com/rsapc/hookcmd/results"
+)
+
+// undo step actions
+const (
+	UndoRestore = "restore"
+	UndoDelete  = "delete"
+)
+
+// undo step statuses
+const (
+	UndoPlanned  = "planned"
+	UndoDone     = "done"
+	UndoConflict = "conflict"
+	UndoSkipped  = "skipped"
+	UndoFailed   = "failed"
+)
+
+// clockSkew is allowed between hookcmd and Netbox when checking if a
+// created object was changed after the run
+const clockSkew = time.Minute
+
+// UndoStep is a field restored or an object deleted to undo a run
+type UndoStep struct {
+	Action     string `json:"action"`
+	ObjectType string `json:"object_type"`
+	ID         int64  `json:"id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Field      string `json:"field,omitempty"`
+	// Current is the value now and Restore the value before the run
+	Current any    `json:"current,omitempty"`
+	Restore any    `json:"restore,omitempty"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Object returns the object as type:id
+func (step UndoStep) Object() string {
+	if step.ID == 0 {
+		return step.ObjectType
+	}
+	return fmt.Sprintf("%s:%d", step.ObjectType, step.ID)
+}
+
+// undoObject is an object changed by the run being undone
+type undoObject struct {
+	system  string
+	model   string
+	id      int64
+	name    string
+	created bool
+	deleted bool
+	// last is when the run last changed the object
+	last   time.Time
+	fields []string
+	old    map[string]any
+	new    map[string]any
+}
+
+func (obj *undoObject) step(action string, field string) UndoStep {
+	return UndoStep{Action: action, ObjectType: objectType(obj.system, obj.model), ID: obj.id, Name: obj.name, Field: field}
+}
+
+// Undo restores the fields changed by the run to their values before it
+// and deletes the Netbox objects it created, most recent change first.
+// A field that has changed since the run is a conflict and is left alone
+// unless force is set.  With dryRun nothing is changed and the steps are
+// planned.  Deleted objects cannot be restored.
+func (s *Service) Undo(runID string, dryRun bool, force bool) ([]UndoStep, error) {
+	log, err := s.AuditLog()
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit log: %w", err)
+	}
+	entries, err := log.Query(audit.Filter{RunID: runID})
+	if err != nil {
+		return nil, err
+	}
+	objects := undoObjects(entries)
+	if len(objects) == 0 {
+		return nil, models.WithKind(fmt.Errorf("no changes were recorded for run %s", runID), models.ErrNotFound)
+	}
+	var steps []UndoStep
+	var errs []error
+	for i := len(objects) - 1; i >= 0; i-- {
+		obj := objects[i]
+		var objSteps []UndoStep
+		switch {
+		case obj.deleted:
+			step := obj.step(UndoDelete, "")
+			step.Status, step.Reason = UndoSkipped, "deleted objects cannot be restored"
+			objSteps = []UndoStep{step}
+		case obj.created:
+			objSteps, err = s.undoCreate(obj, dryRun, force)
+		default:
+			objSteps, err = s.undoUpdate(obj, dryRun, force)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		steps = append(steps, objSteps...)
+	}
+	conflicts := 0
+	for _, step := range steps {
+		if step.Status == UndoConflict {
+			conflicts++
+		}
+	}
+	if conflicts > 0 {
+		s.logger.Warn("fields changed since the run were not undone", "run", runID, "conflicts", conflicts)
+	}
+	return steps, errors.Join(errs...)
+}
+
+// undoObjects groups the successful changes of a run by object in the
+// order they were first changed.  The old value of a field is from its
+// first change and the new value from its last.
+func undoObjects(entries []audit.Entry) []*undoObject {
+	var objects []*undoObject
+	byKey := make(map[string]*undoObject)
+	for _, e := range entries {
+		if e.Result != audit.ResultOK {
+			continue
+		}
+		key := fmt.Sprintf("%s:%s:%d", e.System, e.Model, e.ID)
+		if e.ID == 0 {
+			key += ":" + e.Name
+		}
+		obj, ok := byKey[key]
+		if !ok {
+			obj = &undoObject{system: e.System, model: e.Model, id: e.ID, name: e.Name,
+				old: make(map[string]any), new: make(map[string]any)}
+			byKey[key] = obj
+			objects = append(objects, obj)
+		}
+		if obj.name == "" {
+			obj.name = e.Name
+		}
+		obj.last = e.Time
+		switch e.Action {
+		case results.Create:
+			obj.created = true
+		case results.Delete:
+			obj.deleted = true
+		case results.Update:
+			if _, seen := obj.new[e.Field]; !seen {
+				obj.fields = append(obj.fields, e.Field)
+				obj.old[e.Field] = e.Old
+			}
+			obj.new[e.Field] = e.New
+		}
+	}
+	return objects
+}
+
+// undoCreate deletes a Netbox object created by the run unless it has
+// been changed since
+func (s *Service) undoCreate(obj *undoObject, dryRun bool, force bool) ([]UndoStep, error) {
+	step := obj.step(UndoDelete, "")
+	switch {
+	case obj.system == results.DNS:
+		step.Status, step.Reason = UndoSkipped, "DNS records are not removed"
+		return []UndoStep{step}, nil
+	case obj.system != results.Netbox:
+		step.Status, step.Reason = UndoSkipped, "objects created in LibreNMS are not deleted"
+		return []UndoStep{step}, nil
+	case obj.id == 0:
+		step.Status, step.Reason = UndoSkipped, "the ID of the created object was not recorded"
+		return []UndoStep{step}, nil
+	}
+	current, err := s.nbapi.GetObject(obj.model, obj.id)
+	if err != nil {
+		if errors.Is(err, nbapi.ErrNotFound) {
+			step.Status, step.Reason = UndoSkipped, "already deleted"
+			return []UndoStep{step}, nil
+		}
+		step.Status, step.Reason = UndoFailed, err.Error()
+		return []UndoStep{step}, err
+	}
+	updated, _ := time.Parse(time.RFC3339Nano, fmt.Sprint(current["last_updated"]))
+	if updated.After(obj.last.Add(clockSkew)) && !force {
+		step.Status, step.Reason = UndoConflict, fmt.Sprintf("changed at %s, after the run", updated.Local().Format(time.DateTime))
+		return []UndoStep{step}, nil
+	}
+	if dryRun {
+		step.Status = UndoPlanned
+		return []UndoStep{step}, nil
+	}
+	if err = s.nbapi.DeleteObject(obj.model, obj.id); err != nil {
+		s.auditDeleteFailure(obj.system, obj.model, obj.id, obj.name, err)
+		step.Status, step.Reason = UndoFailed, err.Error()
+		return []UndoStep{step}, err
+	}
+	s.recordDelete(obj.system, obj.model, obj.id, obj.name)
+	step.Status = UndoDone
+	return []UndoStep{step}, nil
+}
+
+// undoUpdate restores the fields of an object changed by the run.  Fields
+// whose value is no longer the one the run set are conflicts, and fields
+// whose current value cannot be read are skipped.
+func (s *Service) undoUpdate(obj *undoObject, dryRun bool, force bool) ([]UndoStep, error) {
+	steps := make([]UndoStep, 0, len(obj.fields))
+	for _, field := range obj.fields {
+		step := obj.step(UndoRestore, field)
+		step.Restore = obj.old[field]
+		steps = append(steps, step)
+	}
+	setAll := func(status string, reason string) {
+		for i := range steps {
+			steps[i].Status, steps[i].Reason = status, reason
+		}
+	}
+
+	var current map[string]any
+	var err error
+	switch {
+	case obj.system == results.Netbox:
+		current, err = s.nbapi.GetObject(obj.model, obj.id)
+	case obj.model == "device":
+		device, getErr := s.librenms.GetDevice(int(obj.id))
+		current, err = toMap(device), getErr
+	default:
+		setAll(UndoSkipped, fmt.Sprintf("changes to LibreNMS %ss are not undone", obj.model))
+		return steps, nil
+	}
+	if err != nil {
+		setAll(UndoFailed, err.Error())
+		return steps, err
+	}
+
+	data := make(map[string]any)
+	restoring := make([]int, 0, len(steps))
+	for i := range steps {
+		step := &steps[i]
+		step.Current = fieldValue(current, step.Field)
+		switch {
+		case !hasField(current, step.Field):
+			step.Status, step.Reason = UndoSkipped, "the current value could not be read"
+			continue
+		case sameValue(step.Current, step.Restore):
+			step.Status, step.Reason = UndoSkipped, "already restored"
+			continue
+		case !sameValue(step.Current, obj.new[step.Field]) && !force:
+			step.Status, step.Reason = UndoConflict, "changed since the run"
+			continue
+		}
+		restoring = append(restoring, i)
+		if name, ok := strings.CutPrefix(step.Field, "custom_fields."); ok {
+			cf, _ := data["custom_fields"].(map[string]any)
+			if cf == nil {
+				cf = make(map[string]any)
+				data["custom_fields"] = cf
+			}
+			cf[name] = step.Restore
+			continue
+		}
+		data[step.Field] = step.Restore
+	}
+	if len(restoring) == 0 {
+		return steps, nil
+	}
+	status := UndoPlanned
+	if !dryRun {
+		status = UndoDone
+		if err = s.restoreFields(obj, data); err != nil {
+			status = UndoFailed
+		}
+	}
+	for _, i := range restoring {
+		steps[i].Status = status
+		if err != nil {
+			steps[i].Reason = err.Error()
+		}
+	}
+	return steps, err
+}
+
+// hasField returns true if the decoded object has the field, so its
+// current value is known.  Custom fields are given as custom_fields.name.
+func hasField(obj map[string]any, field string) bool {
+	if name, ok := strings.CutPrefix(field, "custom_fields."); ok {
+		obj, _ = obj["custom_fields"].(map[string]any)
+		field = name
+	}
+	_, ok := obj[field]
+	return ok
+}
+
+// restoreFields writes the values before the run back to the object.  A
+// LibreNMS hostname is restored by renaming the device.
+func (s *Service) restoreFields(obj *undoObject, data map[string]any) error {
+	if obj.system == results.Netbox {
+		return s.updateObject(obj.model, obj.id, data)
+	}
+	deviceID := int(obj.id)
+	if hostname, ok := data["hostname"]; ok {
+		delete(data, "hostname")
+		before, _ := s.librenms.GetDevice(deviceID)
+		if err := s.librenms.RenameDevice(deviceID, fmt.Sprint(hostname)); err != nil {
+			s.auditFailure(results.LibreNMS, "device", obj.id, map[string]any{"hostname": hostname}, err)
+			return err
+		}
+		s.recordUpdate(results.LibreNMS, "device", obj.id, s.librenms.DeviceURL(deviceID), toMap(before), map[string]any{"hostname": hostname})
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return s.updateLibreDevice(deviceID, data)
+}
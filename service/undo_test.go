@@ -0,0 +1,206 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestUndoAddedInterface(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.librenms.handle("GET /api/v0/ports/search/device_id/42", http.StatusOK, map[string]any{"status": "ok", "ports": []any{
+		map[string]any{"port_id": 1201, "device_id": 42, "ifName": "Gi1/0/1", "ifType": "ethernetCsmacd", "ifAlias": "uplink"},
+	}})
+	ts.netbox.handle("GET /api/dcim/interfaces/", http.StatusOK, netboxList())
+	ts.netbox.handle("POST /api/dcim/interfaces/", http.StatusCreated, map[string]any{"id": 77, "name": "Gi1/0/1"})
+	ts.netbox.handle("GET /api/dcim/interfaces/77/", http.StatusOK, map[string]any{"id": 77, "name": "Gi1/0/1", "last_updated": "2020-01-01T00:00:00Z"})
+	ts.netbox.handle("POST /api/extras/journal-entries/", http.StatusCreated, map[string]any{"id": 1})
+
+	if err := ts.UpdatePortDescriptions("device", 7, 42); err != nil {
+		t.Fatal(err)
+	}
+	if posts := ts.netbox.called(http.MethodPost, "/api/dcim/interfaces/"); len(posts) != 1 || posts[0].Body["device"] != float64(7) {
+		t.Fatalf("got %+v, want Gi1/0/1 added to device 7", posts)
+	}
+	steps, err := ts.Undo(ts.RunID(), true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 1 || steps[0].Action != UndoDelete || steps[0].ID != 77 || steps[0].Status != UndoPlanned {
+		t.Errorf("got %+v, want interface 77 deleted", steps)
+	}
+}
+
+// statefulObject serves obj at path on api and applies the updates made
+// to it.  LibreNMS updates and renames are applied to a LibreNMS device.
+func statefulObject(api *fakeAPI, path string, obj map[string]any) *sync.Mutex {
+	var mu sync.Mutex
+	libre := strings.HasPrefix(path, "/api/v0/")
+	api.handleFunc("GET "+path, func(fakeRequest) (int, any) {
+		mu.Lock()
+		defer mu.Unlock()
+		data, _ := json.Marshal(obj)
+		var current map[string]any
+		json.Unmarshal(data, &current)
+		if libre {
+			return http.StatusOK, libreDevice(current)
+		}
+		return http.StatusOK, current
+	})
+	api.handleFunc("PATCH "+path, func(req fakeRequest) (int, any) {
+		mu.Lock()
+		defer mu.Unlock()
+		if libre {
+			fields, _ := req.Body["field"].([]any)
+			data, _ := req.Body["data"].([]any)
+			for i := range fields {
+				obj[fields[i].(string)] = data[i]
+			}
+			return http.StatusOK, map[string]any{"status": "ok"}
+		}
+		for field, value := range req.Body {
+			if cf, ok := value.(map[string]any); ok && field == "custom_fields" {
+				for key, v := range cf {
+					obj["custom_fields"].(map[string]any)[key] = v
+				}
+				continue
+			}
+			obj[field] = value
+		}
+		return http.StatusOK, obj
+	})
+	return &mu
+}
+
+func TestUndoUpdate(t *testing.T) {
+	tests := []struct {
+		name  string
+		force bool
+		// edit changes the device after the run
+		edit func(device map[string]any)
+		// serial and asset are the statuses of the undo steps
+		serial, asset string
+		// restored are the fields written back
+		restored map[string]any
+	}{
+		{"restore", false, nil, UndoDone, UndoDone,
+			map[string]any{"serial": "FOC1", "custom_fields": map[string]any{"asset": "A1"}}},
+		{"conflict", false, func(device map[string]any) { device["serial"] = "FOC3" }, UndoConflict, UndoDone,
+			map[string]any{"custom_fields": map[string]any{"asset": "A1"}}},
+		{"force", true, func(device map[string]any) { device["serial"] = "FOC3" }, UndoDone, UndoDone,
+			map[string]any{"serial": "FOC1", "custom_fields": map[string]any{"asset": "A1"}}},
+		{"already restored", false, func(device map[string]any) { device["serial"] = "FOC1" }, UndoSkipped, UndoDone,
+			map[string]any{"custom_fields": map[string]any{"asset": "A1"}}},
+		{"field removed", true, func(device map[string]any) { delete(device["custom_fields"].(map[string]any), "asset") }, UndoDone, UndoSkipped,
+			map[string]any{"serial": "FOC1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestService(t, nil)
+			device := map[string]any{"id": 5, "name": "sw1", "serial": "FOC1", "custom_fields": map[string]any{"asset": "A1"}}
+			mu := statefulObject(ts.netbox, "/api/dcim/devices/5/", device)
+
+			if err := ts.updateObject("device", 5, map[string]any{"serial": "FOC2", "custom_fields": map[string]any{"asset": "A2"}}); err != nil {
+				t.Fatal(err)
+			}
+			if tt.edit != nil {
+				mu.Lock()
+				tt.edit(device)
+				mu.Unlock()
+			}
+			steps, err := ts.Undo(ts.RunID(), false, tt.force)
+			if err != nil {
+				t.Fatal(err)
+			}
+			status := make(map[string]string)
+			for _, step := range steps {
+				status[step.Field] = step.Status
+			}
+			if len(steps) != 2 || status["serial"] != tt.serial || status["custom_fields.asset"] != tt.asset {
+				t.Errorf("got %+v, want serial %s and asset %s", steps, tt.serial, tt.asset)
+			}
+			patches := ts.netbox.called(http.MethodPatch, "/api/dcim/devices/5/")
+			if len(patches) != 2 {
+				t.Fatalf("got %d updates, want the run and the undo", len(patches))
+			}
+			if got, want := fmt.Sprint(patches[1].Body), fmt.Sprint(tt.restored); got != want {
+				t.Errorf("restored %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestUndoPrimaryIPChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostname string
+		// field is the one changed for the new address
+		field string
+		// route is the LibreNMS request that restores it
+		route   string
+		restore any
+	}{
+		{"rename", "10.0.0.5", "hostname", "PATCH /api/v0/devices/12/rename/10.0.0.5", "10.0.0.5"},
+		{"overwrite_ip", "sw1.example.com", "overwrite_ip", "PATCH /api/v0/devices/12", "10.0.0.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles := []any{map[string]any{"name": "default", "snmp_version": "v2c", "community": "public", "port": newSNMPAgent(t, "sw1")}}
+			ts := newTestService(t, map[string]any{"librenms": map[string]any{"profiles": profiles, "preflight": map[string]any{"timeout": "1s"}}})
+			ts.netbox.handle("GET /api/ipam/ip-addresses/31/", http.StatusOK, map[string]any{"id": 31, "address": "127.0.0.1/8"})
+			ts.netbox.handle("GET /api/dcim/devices/5/", http.StatusOK, map[string]any{"id": 5, "name": "sw1"})
+			ts.netbox.handle("POST /api/extras/journal-entries/", http.StatusCreated, map[string]any{"id": 1})
+			device := map[string]any{"device_id": 12, "hostname": tt.hostname, "ip": "10.0.0.5", "sysName": "sw1",
+				"overwrite_ip": "10.0.0.9", "notes": "racked in A1"}
+			mu := statefulObject(ts.librenms, "/api/v0/devices/12", device)
+			for _, host := range []string{"127.0.0.1", "10.0.0.5"} {
+				host := host
+				ts.librenms.handleFunc("PATCH /api/v0/devices/12/rename/"+host, func(fakeRequest) (int, any) {
+					mu.Lock()
+					defer mu.Unlock()
+					device["hostname"] = host
+					return http.StatusOK, map[string]any{"status": "ok"}
+				})
+			}
+
+			pre := map[string]any{"id": 5, "primary_ip4": map[string]any{"id": 30}, "custom_fields": map[string]any{"monitoring_id": 12}}
+			post := map[string]any{"id": 5, "primary_ip4": map[string]any{"id": 31}, "custom_fields": map[string]any{"monitoring_id": 12}}
+			if err := ts.PrimaryIPChange(webhook(t, "updated", "device", "admin", pre, post)); err != nil {
+				t.Fatal(err)
+			}
+			if device[tt.field] != "127.0.0.1" {
+				t.Fatalf("the run did not set %s: %v", tt.field, device)
+			}
+			before := len(ts.librenms.writes())
+
+			steps, err := ts.Undo(ts.RunID(), false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(steps) != 2 {
+				t.Fatalf("got %+v, want %s and notes restored", steps, tt.field)
+			}
+			for _, step := range steps {
+				if step.Status != UndoDone || step.Field != tt.field && step.Field != "notes" {
+					t.Errorf("got %+v, want %s and notes restored", step, tt.field)
+				}
+				if step.Field == tt.field && (step.Current != "127.0.0.1" || step.Restore != tt.restore) {
+					t.Errorf("got %s %v, want %v restored over 127.0.0.1", step.Field, step.Restore, tt.restore)
+				}
+			}
+			var undo []string
+			for _, req := range ts.librenms.writes()[before:] {
+				undo = append(undo, req.Method+" "+req.Path)
+			}
+			if len(undo) == 0 || undo[0] != tt.route {
+				t.Errorf("got LibreNMS updates %v, want %s first", undo, tt.route)
+			}
+			if device[tt.field] != tt.restore || device["notes"] != "racked in A1" {
+				t.Errorf("got %v, want %s %v and the notes restored", device, tt.field, tt.restore)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"time"
+
+	"github.com/rsapc/hookcmd/librenms"
+	"github.com/rsapc/netbox"
+)
+
+// custom field written by trackUptime
+const cfLastBoot = "last_boot"
+
+const (
+	// bootTolerance is how far the estimated boot time moves with the
+	// poll time without being a reboot
+	bootTolerance = 15 * time.Minute
+	// uptimeWrap is when the 32-bit sysUpTime, in hundredths of a
+	// second, wraps to zero (about 497 days)
+	uptimeWrap = time.Duration(1<<32) * 10 * time.Millisecond
+)
+
+// trackUptime keeps the boot time of the device, estimated from its
+// LibreNMS uptime, in the last_boot custom field of the Netbox object.
+// The uptime drops on a reboot so the estimated boot time moves forward:
+// a warning is journalled with the new boot time and last_boot is
+// updated.  Nothing is written while the estimate stays within
+// bootTolerance of last_boot, or when it moved by a whole number of
+// sysUpTime wraps.
+func (s *Service) trackUptime(device librenms.LibreDevice, netboxType string, netboxID int64) error {
+	if device.Uptime <= 0 {
+		// not polled yet, or a ping only device
+		return nil
+	}
+	cf, err := s.nbapi.GetCustomFields(netboxType, netboxID)
+	if err != nil {
+		return err
+	}
+	uptime := time.Duration(device.Uptime) * time.Second
+	boot := time.Now().UTC().Add(-uptime).Truncate(time.Second)
+
+	current, _ := cf[cfLastBoot].(string)
+	lastBoot, err := time.Parse(time.RFC3339, current)
+	if err == nil {
+		moved := boot.Sub(lastBoot)
+		switch {
+		case moved.Abs() <= bootTolerance:
+			return nil
+		case uptimeWrapped(moved):
+			s.logger.Info("uptime counter wrapped", "model", netboxType, "id", netboxID, "uptime", uptime, "last_boot", current)
+			return nil
+		case moved > 0:
+			s.logger.Warn("device rebooted", "model", netboxType, "id", netboxID, "uptime", uptime, "boot", boot)
+			s.netbox.AddJournalEntry(netboxType, netboxID, netbox.WarningLevel, "device rebooted at about %s\n\nuptime %s, the previous boot was at %s", boot.Format(time.RFC3339), uptime, current)
+		}
+		// an earlier boot time corrects last_boot without a reboot
+	}
+	if err = s.nbapi.EnsureCustomField(cfLastBoot, "Last boot", "text", "dcim.device", "virtualization.virtualmachine"); err != nil {
+		s.logger.Error("could not add custom field", "field", cfLastBoot, "error", err)
+		return err
+	}
+	data := map[string]interface{}{"custom_fields": map[string]interface{}{cfLastBoot: boot.Format(time.RFC3339)}}
+	if err = s.updateObject(netboxType, netboxID, data); err != nil {
+		s.logger.Error("could not update last boot", "model", netboxType, "id", netboxID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// uptimeWrapped returns true if the boot time moved forward by a whole
+// number of sysUpTime wraps, give or take bootTolerance
+func uptimeWrapped(moved time.Duration) bool {
+	wraps := (moved + uptimeWrap/2) / uptimeWrap
+	return wraps > 0 && (moved-wraps*uptimeWrap).Abs() <= bootTolerance
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rsapc/hookcmd/librenms"
+)
+
+func TestTrackUptime(t *testing.T) {
+	day := 24 * time.Hour
+	ago := func(d time.Duration) string {
+		return time.Now().UTC().Add(-d).Truncate(time.Second).Format(time.RFC3339)
+	}
+	tests := []struct {
+		name     string
+		lastBoot any
+		uptime   time.Duration
+		// write is true when last_boot is set and reboot when it is
+		// journalled
+		write, reboot bool
+	}{
+		{"first sync", nil, 3 * day, true, false},
+		{"same boot", ago(3 * day), 3*day - 4*time.Minute, false, false},
+		{"rebooted", ago(3 * day), 2 * time.Hour, true, true},
+		{"counter wrapped", ago(uptimeWrap + 3*day), 3*day + 2*time.Minute, false, false},
+		{"wrapped twice", ago(2*uptimeWrap + day), day, false, false},
+		{"rebooted after a wrap", ago(uptimeWrap + 3*day), 2 * time.Hour, true, true},
+		{"earlier boot", ago(2 * day), 40 * day, true, false},
+		{"unreadable", "yesterday", day, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestService(t, nil)
+			ts.netbox.handle("GET /api/dcim/devices/5/", http.StatusOK, map[string]any{"id": 5, "name": "sw1", "custom_fields": map[string]any{cfLastBoot: tt.lastBoot}})
+			ts.netbox.handle("PATCH /api/dcim/devices/5/", http.StatusOK, map[string]any{"id": 5})
+			ts.netbox.handle("GET /api/extras/custom-fields/", http.StatusOK, netboxList(map[string]any{"id": 1}))
+			ts.netbox.handle("POST /api/extras/journal-entries/", http.StatusCreated, map[string]any{"id": 1})
+
+			if err := ts.trackUptime(librenms.LibreDevice{DeviceID: 12, Uptime: int(tt.uptime.Seconds())}, "device", 5); err != nil {
+				t.Fatal(err)
+			}
+			patches := ts.netbox.called(http.MethodPatch, "/api/dcim/devices/5/")
+			if tt.write != (len(patches) == 1) || len(patches) > 1 {
+				t.Fatalf("got %d updates, want write %t", len(patches), tt.write)
+			}
+			if tt.write {
+				cf, _ := patches[0].Body["custom_fields"].(map[string]any)
+				if len(cf) != 1 || cf[cfLastBoot] != ago(tt.uptime) && cf[cfLastBoot] != ago(tt.uptime+time.Second) {
+					t.Errorf("got %v, want last_boot %s", cf, ago(tt.uptime))
+				}
+			}
+			journal := ts.netbox.called(http.MethodPost, "/api/extras/journal-entries/")
+			if tt.reboot != (len(journal) == 1) || len(journal) > 1 {
+				t.Fatalf("got %d journal entries, want reboot %t", len(journal), tt.reboot)
+			}
+			if tt.reboot {
+				if comments, _ := journal[0].Body["comments"].(string); journal[0].Body["kind"] != "warning" || !strings.Contains(comments, "rebooted") {
+					t.Errorf("got journal %v", journal[0].Body)
+				}
+			}
+		})
+	}
+}
+
+func TestTrackUptimeNotPolled(t *testing.T) {
+	ts := newTestService(t, nil)
+	if err := ts.trackUptime(librenms.LibreDevice{DeviceID: 12}, "device", 5); err != nil {
+		t.Fatal(err)
+	}
+	if len(ts.netbox.requests) != 0 {
+		t.Errorf("got requests %+v, want none", ts.netbox.requests)
+	}
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rsapc/hookcmd/librenms"
+	"github.com/rsapc/hookcmd/models"
+	"github.com/rsapc/hookcmd/nbapi"
+	"github.com/rsapc/hookcmd/results"
+	"github.com/rsapc/netbox"
+)
+
+const (
+	bytesPerMB = 1024 * 1024
+	mbPerGB    = 1024
+)
+
+// updateVMInterfaces is UpdatePortDescriptions for virtual machines.  VM
+// interfaces belong to a virtual_machine rather than a device and have no
+// type, speed or duplex so only the description, MAC address and parent
+// are synced.  Journal entries go on the VM as Netbox does not journal VM
+// interfaces.
+func (s *Service) updateVMInterfaces(vmID int, ports []librenms.Port, intfs []netbox.Interface) error {
+	nbInts := make(map[string]netbox.Interface)
+	for _, intf := range intfs {
+		nbInts[intf.Name] = intf
+	}
+	for _, port := range ports {
+		_, parent := GetInterfaceTypeFromIfType(port.IfType, port.IfName)
+		intf, ok := nbInts[port.IfName]
+		if !ok {
+			description := port.IfAlias
+			edit := nbapi.VMInterfaceEdit{
+				VirtualMachine: vmID,
+				Name:           port.IfName,
+				Description:    &description,
+				MacAddress:     port.GetPhysAddress(),
+			}
+			if pIntf, ok := nbInts[parent]; ok && parent != "" {
+				edit.Parent = pIntf.ID
+			}
+			body, _ := json.Marshal(edit)
+			added, err := s.nbapi.AddVMInterface(edit)
+			if err != nil {
+				s.logger.Error("failed to add interface", "vm", vmID, "interface", port.IfName, "error", err)
+				s.auditCreateFailure(results.Netbox, "vminterface", port.IfName, err)
+				s.netbox.AddJournalEntry("virtualmachine", int64(vmID), netbox.InfoLevel, "failed to add interface %s: %v\n\n```json\n%s\n```", port.IfName, err, string(body))
+			} else {
+				s.netbox.AddJournalEntry("virtualmachine", int64(vmID), netbox.SuccessLevel, "added new interface: %s\n\n```json\n%s\n```", port.IfName, string(body))
+				s.recordCreate(results.Netbox, "vminterface", int64(added.ID), port.IfName)
+			}
+			continue
+		}
+
+		edit := nbapi.VMInterfaceEdit{}
+		update := false
+		if intf.Description != port.IfAlias {
+			edit.Description = &port.IfAlias
+			update = true
+		}
+		if mac := port.GetPhysAddress(); mac != "" && intf.GetMacAddress() != mac {
+			edit.MacAddress = mac
+			update = true
+		}
+		if pIntf, ok := nbInts[parent]; ok && parent != "" && intf.Parent == nil {
+			edit.Parent = pIntf.ID
+			update = true
+		}
+		if !update {
+			continue
+		}
+		body, _ := json.Marshal(edit)
+		if err := s.nbapi.UpdateVMInterface(intf.ID, edit); err != nil {
+			s.logger.Error("failed to update interface", "vm", vmID, "interface", port.IfName, "error", err)
+			s.auditFailure(results.Netbox, "vminterface", int64(intf.ID), toMap(edit), err)
+			s.netbox.AddJournalEntry("virtualmachine", int64(vmID), netbox.InfoLevel, "failed to update interface %s: %v\n\n```json\n%s\n```", port.IfName, err, string(body))
+		} else {
+			s.netbox.AddJournalEntry("virtualmachine", int64(vmID), netbox.SuccessLevel, "updated interface: [%s](/virtualization/interfaces/%d)\n\n```json\n%s\n```", port.IfName, intf.ID, string(body))
+			s.recordUpdate(results.Netbox, "vminterface", int64(intf.ID), s.nbapi.ObjectURL("vminterface", int64(intf.ID)), toMap(intf), toMap(edit))
+		}
+	}
+	return nil
+}
+
+// vmResources are the sizes Netbox records for a VM
+type vmResources struct {
+	vcpus  int
+	memory int // MB
+	disk   int // MB
+}
+
+// libreResources totals the processors, physical memory and fixed disks
+// LibreNMS has discovered on the device.  Zero values were not found.
+func (s *Service) libreResources(deviceID int) (res vmResources, err error) {
+	processors, err := s.librenms.GetHealth(deviceID, "device_processor")
+	if err != nil && !errors.Is(err, librenms.ErrNotFound) {
+		return res, err
+	}
+	res.vcpus = len(processors)
+
+	var memory float64
+	mempools, err := s.librenms.GetHealth(deviceID, "device_mempool")
+	if err != nil && !errors.Is(err, librenms.ErrNotFound) {
+		return res, err
+	}
+	for _, graph := range mempools {
+		pool, err := s.librenms.GetHealthSensor(deviceID, "device_mempool", graph.SensorID)
+		if err != nil {
+			return res, err
+		}
+		if pool.String("mempool_class") == "system" {
+			memory += pool.Float("mempool_total")
+		}
+	}
+	res.memory = int(memory / bytesPerMB)
+
+	var disk float64
+	storage, err := s.librenms.GetHealth(deviceID, "device_storage")
+	if err != nil && !errors.Is(err, librenms.ErrNotFound) {
+		return res, err
+	}
+	for _, graph := range storage {
+		st, err := s.librenms.GetHealthSensor(deviceID, "device_storage", graph.SensorID)
+		if err != nil {
+			return res, err
+		}
+		if st.String("storage_type") == "hrStorageFixedDisk" {
+			disk += st.Float("storage_size")
+		}
+	}
+	res.disk = int(disk / bytesPerMB)
+	return res, nil
+}
+
+// netboxStatus returns the Netbox version.  An unknown version is
+// treated as current.
+func (s *Service) netboxStatus() nbapi.Status {
+	s.statusOnce.Do(func() {
+		var err error
+		if s.nbStatus, err = s.nbapi.GetStatus(); err != nil {
+			s.logger.Warn("could not get the Netbox version", "error", err)
+		}
+	})
+	return s.nbStatus
+}
+
+// resourceUpdate returns the fields of vm that differ from res
+func resourceUpdate(vm nbapi.VirtualMachine, res vmResources) map[string]interface{} {
+	data := make(map[string]interface{})
+	if res.vcpus > 0 && (vm.VCPUs == nil || int(*vm.VCPUs) != res.vcpus) {
+		data["vcpus"] = res.vcpus
+	}
+	if res.memory > 0 && (vm.Memory == nil || *vm.Memory != res.memory) {
+		data["memory"] = res.memory
+	}
+	if res.disk > 0 && (vm.Disk == nil || *vm.Disk != res.disk) {
+		data["disk"] = res.disk
+	}
+	return data
+}
+
+// updateVMResources sets the vCPUs, memory and disk of the Netbox VM from
+// the hardware LibreNMS has discovered on it
+func (s *Service) updateVMResources(deviceID int, vmID int64) error {
+	vm, err := s.nbapi.GetVirtualMachine(vmID)
+	if err != nil {
+		return err
+	}
+	res, err := s.libreResources(deviceID)
+	if err != nil {
+		s.logger.Error("could not get VM resources from LibreNMS", "device", deviceID, "error", err)
+		return err
+	}
+	if !s.netboxStatus().AtLeast(4, 1) {
+		// Netbox before 4.1 records the disk in GB
+		res.disk /= mbPerGB
+	}
+	data := resourceUpdate(vm, res)
+	if len(data) == 0 {
+		return nil
+	}
+	if err = s.updateObject("virtualmachine", vmID, data); err != nil {
+		s.netbox.AddJournalEntry("virtualmachine", vmID, netbox.WarningLevel, "could not update resources:\n\n%s", err.Error())
+		return err
+	}
+	body, _ := json.Marshal(data)
+	return s.netbox.AddJournalEntry("virtualmachine", vmID, netbox.SuccessLevel, "resources updated from LibreNMS\n\n```json\n%s\n```", string(body))
+}
+
+// SyncHypervisorVMs places the Netbox VMs that LibreNMS discovered on the
+// hypervisor on that host and in its cluster.  VMs that are not monitored
+// themselves also get their vCPUs and memory from the hypervisor.  VMs
+// are matched to Netbox by name.
+func (s *Service) SyncHypervisorVMs(deviceID int) (err error) {
+	defer s.notifyFailure("VM", deviceID, &err)
+	vms, err := s.librenms.GetVMInfo(deviceID)
+	if err != nil {
+		if errors.Is(err, librenms.ErrNotFound) {
+			s.logger.Warn("no virtual machines found on hypervisor", "device", deviceID)
+			return nil
+		}
+		return err
+	}
+	hostType, hostID, err := s.netbox.FindMonitoredObject(deviceID)
+	if err != nil {
+		s.logger.Error("could not find netbox device", "device_id", deviceID, "error", err)
+		return err
+	}
+	s.linkObjects(hostType, hostID, deviceID)
+	if hostType != "device" {
+		return fmt.Errorf("%w: hypervisor %d is a %s in Netbox, not a device", models.ErrValidation, deviceID, hostType)
+	}
+	cluster, err := s.nbapi.GetDeviceCluster(hostID)
+	if err != nil {
+		return err
+	}
+	if cluster == nil {
+		s.netbox.AddJournalEntry(hostType, hostID, netbox.WarningLevel, "LibreNMS found %d virtual machines on this host but it is not in a cluster", len(vms))
+		return fmt.Errorf("hypervisor %d is not in a Netbox cluster", deviceID)
+	}
+
+	var placed, missing []string
+	for _, info := range vms {
+		nbvms, err := s.nbapi.FindVirtualMachines(info.DisplayName)
+		if err != nil {
+			return err
+		}
+		if len(nbvms) != 1 {
+			s.logger.Info("VM not found in Netbox", "vm", info.DisplayName, "matches", len(nbvms))
+			missing = append(missing, info.DisplayName)
+			continue
+		}
+		vm := nbvms[0]
+		data := make(map[string]interface{})
+		if !vm.Monitored() {
+			data = resourceUpdate(vm, vmResources{vcpus: info.CPUs, memory: info.MemSize})
+		}
+		if vm.Cluster == nil || vm.Cluster.ID != cluster.ID {
+			data["cluster"] = cluster.ID
+		}
+		if vm.Device == nil || int64(vm.Device.ID) != hostID {
+			data["device"] = hostID
+		}
+		if len(data) == 0 {
+			continue
+		}
+		if err = s.updateObject("virtualmachine", int64(vm.ID), data); err != nil {
+			s.logger.Error("could not update VM", "vm", vm.Name, "error", err)
+			s.netbox.AddJournalEntry("virtualmachine", int64(vm.ID), netbox.WarningLevel, "could not place VM on hypervisor %s:\n\n%s", cluster.Name, err.Error())
+			continue
+		}
+		body, _ := json.Marshal(data)
+		s.netbox.AddJournalEntry("virtualmachine", int64(vm.ID), netbox.SuccessLevel, "updated from hypervisor in cluster %s (%s %s)\n\n```json\n%s\n```", cluster.Name, info.VMType, info.State, string(body))
+		placed = append(placed, vm.Name)
+	}
+	s.logger.Info("synced hypervisor VMs", "device", deviceID, "updated", len(placed), "missing", len(missing))
+	msg := fmt.Sprintf("updated %d of %d virtual machines found by LibreNMS", len(placed), len(vms))
+	if len(missing) > 0 {
+		msg += fmt.Sprintf("\n\nnot in Netbox: %s", strings.Join(missing, ", "))
+	}
+	return s.netbox.AddJournalEntry(hostType, hostID, netbox.InfoLevel, "%s", msg)
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestUpdateVMResourcesDiskUnit(t *testing.T) {
+	tests := []struct {
+		version string
+		disk    float64
+	}{
+		{"4.1.2", 40960},
+		{"v4.2-beta1", 40960},
+		{"4.0.11", 40},
+		{"3.7.8", 40},
+		// the version could not be read
+		{"", 40960},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			ts := newTestService(t, nil)
+			if tt.version != "" {
+				ts.netbox.handle("GET /api/status/", http.StatusOK, map[string]any{"netbox-version": tt.version})
+			}
+			ts.netbox.handle("GET /api/virtualization/virtual-machines/7/", http.StatusOK, map[string]any{"id": 7, "name": "vm1", "vcpus": 2, "memory": 4096})
+			ts.netbox.handle("PATCH /api/virtualization/virtual-machines/7/", http.StatusOK, map[string]any{"id": 7})
+			ts.netbox.handle("POST /api/extras/journal-entries/", http.StatusCreated, map[string]any{"id": 1})
+			ts.librenms.handle("GET /api/v0/devices/12/health/device_processor", http.StatusOK, map[string]any{"status": "ok", "graphs": []any{
+				map[string]any{"sensor_id": 1}, map[string]any{"sensor_id": 2},
+			}})
+			ts.librenms.handle("GET /api/v0/devices/12/health/device_mempool", http.StatusOK, map[string]any{"status": "ok", "graphs": []any{}})
+			ts.librenms.handle("GET /api/v0/devices/12/health/device_storage", http.StatusOK, map[string]any{"status": "ok", "graphs": []any{
+				map[string]any{"sensor_id": 5}, map[string]any{"sensor_id": 6},
+			}})
+			ts.librenms.handle("GET /api/v0/devices/12/health/device_storage/5", http.StatusOK, map[string]any{"status": "ok", "graphs": []any{
+				map[string]any{"storage_type": "hrStorageFixedDisk", "storage_size": 40 * 1024 * bytesPerMB},
+			}})
+			ts.librenms.handle("GET /api/v0/devices/12/health/device_storage/6", http.StatusOK, map[string]any{"status": "ok", "graphs": []any{
+				map[string]any{"storage_type": "hrStorageRam", "storage_size": 4 * 1024 * bytesPerMB},
+			}})
+
+			if err := ts.updateVMResources(12, 7); err != nil {
+				t.Fatal(err)
+			}
+			patches := ts.netbox.called(http.MethodPatch, "/api/virtualization/virtual-machines/7/")
+			if len(patches) != 1 {
+				t.Fatalf("got %d updates, want 1", len(patches))
+			}
+			if body := patches[0].Body; body["disk"] != tt.disk || len(body) != 1 {
+				t.Errorf("got %v, want disk %v only", body, tt.disk)
+			}
+		})
+	}
+}